@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var JWT_SIGNATURE_KEY = []byte(os.Getenv("JWT_SIGNATURE_KEY"))
+var INTERNAL_API_TOKEN = []byte(os.Getenv("INTERNAL_API_TOKEN"))
+var ADMIN_API_TOKEN = []byte(os.Getenv("ADMIN_API_TOKEN"))
+
+// ParseToken verifies a user JWT and returns its claims. The HTTP and gRPC
+// servers both use it so they accept the same tokens.
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if method, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("invalid signing method")
+		} else if method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("invalid signing method")
+		}
+		return JWT_SIGNATURE_KEY, nil
+	})
+
+	if err != nil {
+		log.Printf("[Server.tokenHandler] unable to parse token with error %v \n", err)
+		return nil, domain.ErrUnauthorized.Wrap(err)
+	}
+
+	claim, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		log.Printf("[Server.tokenHandler] token is invalid \n")
+		return nil, domain.ErrUnauthorized
+	}
+
+	return claim, nil
+}
+
+func UploaderFromClaim(claim jwt.MapClaims) domain.Uploader {
+	uploader := domain.Uploader{
+		Email: fmt.Sprint(claim["email"]),
+	}
+	if tier, ok := claim["tier"].(string); ok {
+		uploader.Tier = tier
+	}
+	if organization, ok := claim["organization"].(string); ok {
+		uploader.Organization = organization
+	}
+	return uploader
+}
+
+// VerifyStaticToken authenticates backend services and operators, which use
+// a shared token instead of a user JWT.
+func VerifyStaticToken(token string, expected []byte) error {
+	if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(token), expected) != 1 {
+		return domain.ErrUnauthorized
+	}
+	return nil
+}
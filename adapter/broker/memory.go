@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"context"
+	"image-service/core/domain"
+	"sync"
+)
+
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	nextID      int
+	subscribers map[int]func(domain.DetectionEvent)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: map[int]func(domain.DetectionEvent){},
+	}
+}
+
+func (m *MemoryBroker) Publish(event domain.DetectionEvent) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, handler := range m.subscribers {
+		handler(event)
+	}
+	return nil
+}
+
+func (m *MemoryBroker) Subscribe(ctx context.Context, handler func(domain.DetectionEvent)) error {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.subscribers[id] = handler
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	delete(m.subscribers, id)
+	m.mu.Unlock()
+	return nil
+}
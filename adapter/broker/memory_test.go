@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"context"
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+// subscribe starts a subscription and waits until the broker registered it.
+func subscribe(t *testing.T, m *MemoryBroker) (chan domain.DetectionEvent, context.CancelFunc, chan error) {
+	t.Helper()
+	m.mu.RLock()
+	before := len(m.subscribers)
+	m.mu.RUnlock()
+	events := make(chan domain.DetectionEvent, 8)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Subscribe(ctx, func(event domain.DetectionEvent) {
+			events <- event
+		})
+	}()
+	for {
+		m.mu.RLock()
+		n := len(m.subscribers)
+		m.mu.RUnlock()
+		if n > before {
+			return events, cancel, done
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryBrokerFansOut(t *testing.T) {
+	m := NewMemoryBroker()
+	first, cancelFirst, _ := subscribe(t, m)
+	defer cancelFirst()
+	second, cancelSecond, _ := subscribe(t, m)
+	defer cancelSecond()
+
+	if err := m.Publish(domain.DetectionEvent{ID: "1", Email: "user@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []chan domain.DetectionEvent{first, second} {
+		if event := <-events; event.ID != "1" || event.Email != "user@example.com" {
+			t.Fatalf("event = %+v", event)
+		}
+	}
+}
+
+func TestMemoryBrokerUnsubscribesOnCancel(t *testing.T) {
+	m := NewMemoryBroker()
+	events, cancel, done := subscribe(t, m)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Publish(domain.DetectionEvent{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("cancelled subscriber received %+v", event)
+	default:
+	}
+}
@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"os"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/uuid"
+	"google.golang.org/api/option"
+)
+
+// PubsubBroker fans events out to every replica. Each replica receives all
+// events through a subscription of its own, which expires when the replica
+// goes away without cleaning up.
+type PubsubBroker struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+// eventEnvelope keeps the owner's email, which DetectionEvent hides from API
+// responses.
+type eventEnvelope struct {
+	Email string                `json:"email"`
+	Event domain.DetectionEvent `json:"event"`
+}
+
+func NewPubsubBroker(ctx context.Context, topicID string) (*PubsubBroker, error) {
+	opt := option.WithCredentialsFile("pubsub-sa-key.json")
+	projectId := os.Getenv("CAPSTONE_PROJECT_ID")
+	client, err := pubsub.NewClient(ctx, projectId, opt)
+	if err != nil {
+		log.Printf("[NewPubsubBroker] failed to initialize pubsub client with error %v \n", err)
+		return nil, err
+	}
+	return &PubsubBroker{
+		client: client,
+		topic:  client.Topic(topicID),
+	}, nil
+}
+
+func (p *PubsubBroker) Publish(event domain.DetectionEvent) error {
+	data, err := json.Marshal(eventEnvelope{
+		Email: event.Email,
+		Event: event,
+	})
+	if err != nil {
+		return err
+	}
+	res := p.topic.Publish(context.Background(), &pubsub.Message{
+		Data: data,
+	})
+	if _, err = res.Get(context.Background()); err != nil {
+		log.Printf("[PubsubBroker.Publish] error when publish event with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (p *PubsubBroker) Subscribe(ctx context.Context, handler func(domain.DetectionEvent)) error {
+	id := fmt.Sprintf("%v-%v", p.topic.ID(), uuid.NewString())
+	sub, err := p.client.CreateSubscription(ctx, id, pubsub.SubscriptionConfig{
+		Topic:            p.topic,
+		AckDeadline:      10 * time.Second,
+		ExpirationPolicy: 24 * time.Hour,
+	})
+	if err != nil {
+		log.Printf("[PubsubBroker.Subscribe] error when create subscription with error %v \n", err)
+		return err
+	}
+	defer func() {
+		if err := sub.Delete(context.Background()); err != nil {
+			log.Printf("[PubsubBroker.Subscribe] error when delete subscription with error %v \n", err)
+		}
+	}()
+
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		msg.Ack()
+		var envelope eventEnvelope
+		if err := json.Unmarshal(msg.Data, &envelope); err != nil {
+			log.Printf("[PubsubBroker.Subscribe] error when decode event with error %v \n", err)
+			return
+		}
+		envelope.Event.Email = envelope.Email
+		handler(envelope.Event)
+	})
+}
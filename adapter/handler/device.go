@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (i *ImageHttpHandler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.RegisterDevice] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	var payload domain.RegisterDevicePayload
+	if err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&payload); err != nil {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("invalid device payload"), "")
+		return
+	}
+	res, err := i.imageService.RegisterDevice(fmt.Sprint(claim["email"]), payload)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.RegisterDevice] error when register device with error %v \n", err)
+		httpWriteError(w, r, err, "Error register device")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+// UnregisterDevice removes the device token in the path, which is expected
+// to be URL-escaped.
+func (i *ImageHttpHandler) UnregisterDevice(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.UnregisterDevice] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	token, err := url.PathUnescape(chi.URLParam(r, "token"))
+	if err != nil || token == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("device token should be filled"), "")
+		return
+	}
+	if err = i.imageService.UnregisterDevice(fmt.Sprint(claim["email"]), token); err != nil {
+		log.Printf("[ImageHttpHandler.UnregisterDevice] error when unregister device with error %v \n", err)
+		httpWriteError(w, r, err, "Error unregister device")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+	}, http.StatusOK)
+}
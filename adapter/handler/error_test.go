@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHttpWriteErrorHidesCauses(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		"domain error": {
+			err:    domain.ErrImageNotFound,
+			status: http.StatusNotFound,
+			code:   "image_not_found",
+			detail: "image not found",
+		},
+		"wrapped cause": {
+			err:    domain.ErrUnavailable.Wrap(errors.New("dial tcp 10.0.0.3:443: connection refused")),
+			status: http.StatusServiceUnavailable,
+			code:   "unavailable",
+			detail: "service is temporarily unavailable",
+		},
+		"wrapped domain error": {
+			err:    fmt.Errorf("read firestore projects/internal: %w", domain.ErrForbidden),
+			status: http.StatusForbidden,
+			code:   "forbidden",
+			detail: "image belongs to another user",
+		},
+		"internal error": {
+			err:    errors.New("rpc error: code = Internal desc = projects/internal"),
+			status: http.StatusInternalServerError,
+			code:   "internal_error",
+			detail: "something went wrong",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			httpWriteError(rec, httptest.NewRequest(http.MethodGet, "/v1/images/a.jpg", nil), tc.err, "something went wrong")
+
+			var problem domain.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tc.status || problem.Code != tc.code || problem.Detail != tc.detail {
+				t.Fatalf("problem = %v %+v, want %v %v %q", rec.Code, problem, tc.status, tc.code, tc.detail)
+			}
+			if strings.Contains(problem.Detail, "10.0.0.3") || strings.Contains(problem.Detail, "projects/internal") {
+				t.Fatalf("detail leaks the cause: %q", problem.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"image-service/core/util"
+	"log"
+	"net/http"
+	"time"
+)
+
+const DefaultSSEHeartbeatInterval = 15 * time.Second
+
+var SSE_HEARTBEAT_INTERVAL = util.GetEnvDuration("SSE_HEARTBEAT_INTERVAL", DefaultSSEHeartbeatInterval)
+
+func newHeartbeat() *time.Ticker {
+	return time.NewTicker(SSE_HEARTBEAT_INTERVAL)
+}
+
+func writeSSEEvent(w http.ResponseWriter, event domain.DetectionEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// StreamDetectionEvents pushes the caller's detection events as Server-Sent
+// Events. Clients reconnecting with Last-Event-ID receive what they missed
+// while it is still in the hub's backlog.
+func (i *ImageHttpHandler) StreamDetectionEvents(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.StreamDetectionEvents] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpWriteProblem(w, r, http.StatusInternalServerError, "internal_error", "streaming is not supported")
+		return
+	}
+
+	email := fmt.Sprint(claim["email"])
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	backlog, events, unsubscribe := i.imageService.SubscribeDetectionEvents(email, lastEventID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	for _, event := range backlog {
+		if err := writeSSEEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := newHeartbeat()
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// the hub dropped this stream for falling behind, the client
+				// reconnects with Last-Event-ID and replays the backlog
+				fmt.Fprintf(w, "event: %s\ndata: {}\n\n", domain.EventStreamLagged)
+				flusher.Flush()
+				return
+			}
+			if err := writeSSEEvent(w, event); err != nil {
+				log.Printf("[ImageHttpHandler.StreamDetectionEvents] error when write event with error %v \n", err)
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"image-service/core/util"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeCSV    = "text/csv"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+var detectionCSVHeader = []string{
+	"filename", "status", "label", "confidence", "modelVersion",
+	"createdAt", "detectedAt", "inferenceTime",
+}
+
+// negotiateExportType picks CSV or NDJSON from the Accept header. Each type
+// takes the q-value of the most specific range matching it, a type with q=0
+// is refused, and CSV wins ties since it is the default.
+func negotiateExportType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeCSV
+	}
+
+	type match struct {
+		specificity int
+		q           float64
+	}
+	matches := map[string]match{}
+	consider := func(contentType string, specificity int, q float64) {
+		if current, ok := matches[contentType]; !ok || specificity > current.specificity {
+			matches[contentType] = match{specificity: specificity, q: q}
+		}
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case contentTypeCSV:
+			consider(contentTypeCSV, 2, q)
+		case contentTypeNDJSON, "application/ndjson":
+			consider(contentTypeNDJSON, 2, q)
+		case "text/*":
+			consider(contentTypeCSV, 1, q)
+		case "application/*":
+			consider(contentTypeNDJSON, 1, q)
+		case "*/*":
+			consider(contentTypeCSV, 0, q)
+			consider(contentTypeNDJSON, 0, q)
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, contentType := range []string{contentTypeCSV, contentTypeNDJSON} {
+		if m, ok := matches[contentType]; ok && m.q > bestQ {
+			best, bestQ = contentType, m.q
+		}
+	}
+	return best
+}
+
+func detectionCSVRecord(img domain.Image, signedURLs bool) []string {
+	record := []string{
+		img.Filename,
+		string(img.Status),
+		img.Label,
+		strconv.FormatFloat(img.Confidence, 'f', -1, 64),
+		img.ModelVersion,
+		strconv.FormatInt(img.CreatedAt, 10),
+		strconv.FormatInt(img.DetectedAt, 10),
+		strconv.FormatInt(img.InferenceTime, 10),
+	}
+	if signedURLs {
+		record = append(record, img.FileURL)
+	}
+	return record
+}
+
+func (i *ImageHttpHandler) ExportDetections(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ExportDetections] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	contentType := negotiateExportType(r.Header.Get("Accept"))
+	if contentType == "" {
+		httpWriteProblem(w, r, http.StatusNotAcceptable, "not_acceptable", "Accept must be text/csv or application/x-ndjson")
+		return
+	}
+
+	filter, err := util.PageFilter(r)
+	if err != nil {
+		httpWriteError(w, r, err, "")
+		return
+	}
+	signedURLs := false
+	if raw := r.URL.Query().Get("signedUrls"); raw != "" {
+		if signedURLs, err = strconv.ParseBool(raw); err != nil {
+			httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("signedUrls should be a boolean"), "")
+			return
+		}
+	}
+
+	// the first page is held back so an error while loading it is still
+	// sent as a problem, later pages are streamed as they load
+	email := fmt.Sprint(claim["email"])
+	var body bytes.Buffer
+	committed := false
+	flusher, _ := w.(http.Flusher)
+	csvWriter := csv.NewWriter(&body)
+	encoder := json.NewEncoder(&body)
+	flush := func() error {
+		csvWriter.Flush()
+		if !committed {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", "attachment")
+			w.WriteHeader(http.StatusOK)
+			committed = true
+		}
+		if _, err := w.Write(body.Bytes()); err != nil {
+			return err
+		}
+		body.Reset()
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	if contentType == contentTypeCSV {
+		header := append([]string{}, detectionCSVHeader...)
+		if signedURLs {
+			header = append(header, "fileURL")
+		}
+		_ = csvWriter.Write(header)
+	}
+
+	rows := 0
+	err = i.imageService.ExportDetections(email, filter, func(img domain.Image) error {
+		if contentType == contentTypeCSV {
+			if err := csvWriter.Write(detectionCSVRecord(img, signedURLs)); err != nil {
+				return err
+			}
+		} else {
+			if !signedURLs {
+				img.FileURL = ""
+			}
+			if err := encoder.Encode(img); err != nil {
+				return err
+			}
+		}
+		rows++
+		if rows%util.MaxPageSize == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil && !committed {
+		log.Printf("[ImageHttpHandler.ExportDetections] error when export detections with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+	if err != nil {
+		// the status line is already sent, aborting the response leaves the
+		// chunked body unterminated so the client sees the export failed
+		// instead of a complete looking file
+		log.Printf("[ImageHttpHandler.ExportDetections] error when export detections after %v rows with error %v \n", rows, err)
+		panic(http.ErrAbortHandler)
+	}
+	if err = flush(); err != nil {
+		log.Printf("[ImageHttpHandler.ExportDetections] error when write export with error %v \n", err)
+		return
+	}
+	log.Printf("[ImageHttpHandler.ExportDetections] [/v1/images/export] success export %v rows \n", rows)
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"image-service/core/util"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateExportType(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                      contentTypeCSV,
+		"*/*":                                   contentTypeCSV,
+		"text/*":                                contentTypeCSV,
+		"text/csv":                              contentTypeCSV,
+		"application/x-ndjson":                  contentTypeNDJSON,
+		"application/ndjson":                    contentTypeNDJSON,
+		"application/json, application/*;q=0.5": contentTypeNDJSON,
+		"text/csv;q=0.5, application/x-ndjson":  contentTypeNDJSON,
+		"text/csv;q=0, */*":                     contentTypeNDJSON,
+		"text/csv;q=0":                          "",
+		"*/*;q=0":                               "",
+		"application/json":                      "",
+		"text/csv;q=oops, application/x-ndjson": contentTypeNDJSON,
+	} {
+		if got := negotiateExportType(accept); got != want {
+			t.Errorf("negotiateExportType(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func exportImages(n int) []domain.Image {
+	images := make([]domain.Image, 0, n)
+	for i := 0; i < n; i++ {
+		img := testImage(fmt.Sprintf("%04d.jpg", i))
+		img.FileURL = "https://storage.test/" + img.Filename
+		images = append(images, img)
+	}
+	return images
+}
+
+func requestExport(t *testing.T, serverURL, query, accept string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, serverURL+"/v1/images/export"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+newTestToken(t, testEmail))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestExportDetectionsCSV(t *testing.T) {
+	rows := 2*util.MaxPageSize + 1
+	server := newTestServer(t, newFakeImageService(exportImages(rows)...))
+	headerLen := len(detectionCSVHeader)
+
+	res := requestExport(t, server.URL, "?signedUrls=true", "text/csv")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != contentTypeCSV {
+		t.Fatalf("export = %v %v", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+
+	if len(records) != rows+1 {
+		t.Fatalf("got %v records, want a header and %v rows", len(records), rows)
+	}
+	if header := records[0]; header[len(header)-1] != "fileURL" {
+		t.Fatalf("header = %v, want the fileURL column", header)
+	}
+	if last := records[rows]; last[0] != "0200.jpg" || last[len(last)-1] != "https://storage.test/0200.jpg" {
+		t.Fatalf("last row = %v", last)
+	}
+	if len(detectionCSVHeader) != headerLen {
+		t.Fatalf("signed export changed the shared header to %v", detectionCSVHeader)
+	}
+}
+
+func TestExportDetectionsNDJSON(t *testing.T) {
+	server := newTestServer(t, newFakeImageService(exportImages(3)...))
+
+	res := requestExport(t, server.URL, "", "application/x-ndjson")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != contentTypeNDJSON {
+		t.Fatalf("export = %v %v", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var images []domain.Image
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var img domain.Image
+		if err := json.Unmarshal(scanner.Bytes(), &img); err != nil {
+			t.Fatalf("decode line %q: %v", scanner.Text(), err)
+		}
+		images = append(images, img)
+	}
+
+	if len(images) != 3 || images[0].Filename != "0000.jpg" {
+		t.Fatalf("images = %+v", images)
+	}
+	if images[0].FileURL != "" {
+		t.Fatalf("fileURL = %q, want it left out without signedUrls", images[0].FileURL)
+	}
+}
+
+func TestExportDetectionsNotAcceptable(t *testing.T) {
+	server := newTestServer(t, newFakeImageService(exportImages(1)...))
+
+	res := requestExport(t, server.URL, "", "text/csv;q=0, application/json")
+	if res.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("status = %v, want 406", res.StatusCode)
+	}
+}
+
+func TestExportDetectionsFailingFirstPageIsProblem(t *testing.T) {
+	service := newFakeImageService(exportImages(3)...)
+	service.exportErr = domain.ErrUnavailable
+	service.exportErrAfter = 2
+	server := newTestServer(t, service)
+
+	res := requestExport(t, server.URL, "", "text/csv")
+	if res.StatusCode != http.StatusServiceUnavailable || res.Header.Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("export = %v %v, want a 503 problem", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+}
+
+func TestExportDetectionsFailingLaterPageAbortsBody(t *testing.T) {
+	service := newFakeImageService(exportImages(util.MaxPageSize + 10)...)
+	service.exportErr = domain.ErrUnavailable
+	service.exportErrAfter = util.MaxPageSize + 5
+	server := newTestServer(t, service)
+
+	res := requestExport(t, server.URL, "", "text/csv")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want the committed 200", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err == nil {
+		t.Fatal("read a complete body, want the truncated export to fail")
+	}
+	if lines := strings.Count(string(body), "\n"); lines != util.MaxPageSize+1 {
+		t.Fatalf("got %v lines before the abort, want the first page", lines)
+	}
+}
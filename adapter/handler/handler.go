@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"image-service/adapter/auth"
 	"image-service/core/domain"
-	"image-service/core/service"
+	"image-service/core/port"
 	"image-service/core/util"
 	_ "image/jpeg"
 	_ "image/png"
@@ -12,48 +14,40 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v4"
-	"google.golang.org/api/iterator"
 )
 
-var JWT_SIGNATURE_KEY = []byte(os.Getenv("JWT_SIGNATURE_KEY"))
+// shutdownTimeout bounds how long in-flight requests may take to finish once
+// the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
 
 type ImageHttpHandler struct {
-	imageService service.ImageService
+	imageService port.ImageService
 }
 
 func checkToken(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if !strings.Contains(authHeader, "Bearer") {
-		return nil, fmt.Errorf("invalid signing method")
+		return nil, domain.ErrUnauthorized.Errorf("missing bearer token")
 	}
 
 	tokenString := strings.Replace(authHeader, "Bearer ", "", -1)
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if method, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid signing method")
-		} else if method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("invalid signing method")
-		}
-		return JWT_SIGNATURE_KEY, nil
-	})
-
-	if err != nil {
-		log.Printf("[Server.tokenHandler] unable to parse token with error %v \n", err)
-		return nil, fmt.Errorf(err.Error())
-	}
+	return auth.ParseToken(tokenString)
+}
 
-	claim, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		log.Printf("[Server.tokenHandler] token is invalid %v \n", err)
-		return nil, fmt.Errorf(err.Error())
+// checkStaticToken reads the shared token of backend services and operators
+// from the Authorization header.
+func checkStaticToken(r *http.Request, expected []byte) error {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return domain.ErrUnauthorized
 	}
-
-	return claim, nil
+	return auth.VerifyStaticToken(strings.TrimPrefix(authHeader, "Bearer "), expected)
 }
 
 func httpWriteResponse(w http.ResponseWriter, response interface{}, statusCode int) {
@@ -62,15 +56,87 @@ func httpWriteResponse(w http.ResponseWriter, response interface{}, statusCode i
 	_ = json.NewEncoder(w).Encode(response)
 }
 
-func NewImageHttpHandler(imageService service.ImageService) *ImageHttpHandler {
+var errorKindStatusCodes = map[domain.ErrorKind]int{
+	domain.ErrorKindNotFound:     http.StatusNotFound,
+	domain.ErrorKindUnauthorized: http.StatusUnauthorized,
+	domain.ErrorKindForbidden:    http.StatusForbidden,
+	domain.ErrorKindValidation:   http.StatusBadRequest,
+	domain.ErrorKindConflict:     http.StatusConflict,
+	domain.ErrorKindUnavailable:  http.StatusServiceUnavailable,
+	domain.ErrorKindRateLimited:  http.StatusTooManyRequests,
+}
+
+func errorStatusCode(err error) int {
+	if e := domain.AsError(err); e != nil {
+		if statusCode, ok := errorKindStatusCodes[e.Kind]; ok {
+			return statusCode
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func problemType(code string) string {
+	return "urn:image-service:problem:" + code
+}
+
+// filenameParam prefers the image in the path of versioned routes over the
+// filename form field the legacy routes use.
+func filenameParam(r *http.Request, data url.Values) string {
+	if id := chi.URLParam(r, "id"); id != "" {
+		return id
+	}
+	return data.Get("filename")
+}
+
+func httpWriteProblem(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	if statusCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(domain.Problem{
+		Type:     problemType(code),
+		Title:    http.StatusText(statusCode),
+		Status:   statusCode,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+// clientErrorMessage is the part of err a client may see.
+func clientErrorMessage(err error) string {
+	if e := domain.AsError(err); e != nil {
+		return e.Message
+	}
+	return "internal error"
+}
+
+// httpWriteError writes err as an RFC 7807 problem. Internal errors are
+// reported with message instead of their details, and domain errors with
+// their message only, the cause is logged.
+func httpWriteError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if e := domain.AsError(err); e != nil {
+		if e.Err != nil {
+			log.Printf("[httpWriteError] %v %v failed with error %v \n", r.Method, r.URL.Path, err)
+		}
+		httpWriteProblem(w, r, errorStatusCode(err), e.Code, e.Message)
+		return
+	}
+	httpWriteProblem(w, r, http.StatusInternalServerError, "internal_error", message)
+}
+
+func NewImageHttpHandler(imageService port.ImageService) *ImageHttpHandler {
 	return &ImageHttpHandler{
 		imageService: imageService,
 	}
 }
 
 func (i *ImageHttpHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("unable to retrieve token claim with error %v \n", err)
+		httpWriteError(w, r, err, "")
 		return
 	}
 
@@ -78,45 +144,38 @@ func (i *ImageHttpHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 	file, h, err := r.FormFile("image")
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UploadImage] fail to read from file with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "error read image",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("error read image: %v", err), "")
 		return
 	}
 	defer file.Close()
 	fileContentType := h.Header.Get("Content-Type")
 	if fileContentType != "image/jpg" && fileContentType != "image/jpeg" {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Content-Type must be image/jmg or image/jpeg",
-		}, http.StatusBadRequest)
-		return
-	}
-
-	claim, err := checkToken(w, r)
-	if err != nil {
-		log.Printf("unable to retrieve token claim with error %v \n", err)
-		httpWriteResponse(w, domain.ServerResponse{
-			Message: "error retrieve claim",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("Content-Type must be image/jmg or image/jpeg"), "")
 		return
 	}
 
 	email := fmt.Sprint(claim["email"])
 	if email == "" {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "email should be filled",
-		}, http.StatusBadRequest)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("email should be filled"), "")
 		return
 	}
 
-	res, err := i.imageService.UploadImage(email, file)
+	uploader := auth.UploaderFromClaim(claim)
+	var res *domain.UploadImageResponse
+	replayed := false
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		res, replayed, err = i.imageService.UploadImageWithKey(uploader, key, file)
+	} else {
+		res, err = i.imageService.UploadImage(uploader, file)
+	}
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UploadImage] error when uploading image with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error upload image to database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, err, "Error upload image to database")
 		return
 	}
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 
 	log.Printf("[ImageHttpHandler.UploadImage] [/image-detections/create] success upload image to database from payload: %v \n", res)
 
@@ -186,35 +245,24 @@ func (i *ImageHttpHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i *ImageHttpHandler) GetDetectionResults(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.GetDetectionResults] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
 		return
 	}
 
-	claim, err := checkToken(w, r)
+	filter, err := util.PageFilter(r)
 	if err != nil {
-		log.Printf("[ImageHttpHandler.GetDetectionResults] error when checking token with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: err.Error(),
-		}, http.StatusUnauthorized)
+		httpWriteError(w, r, err, "")
 		return
 	}
 
-	filter := util.PageFilter(r)
 	email := fmt.Sprint(claim["email"])
 	res, err := i.imageService.GetDetectionResults(email, &filter)
-	if err == iterator.Done {
-		log.Println("[ImageHttpHanndler.GetSingleDetection]unable to iterate next document, the cursor reached the end of documents")
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "error when read document, the cursor has reach the limit",
-		}, http.StatusNotFound)
-		return
-	}
 	if err != nil {
 		log.Printf("[ImageHttpHandler.GetDetectionResults] error when retrieve detection results with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error read image from database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, err, "Error read image from database")
 		return
 	}
 
@@ -225,9 +273,38 @@ func (i *ImageHttpHandler) GetDetectionResults(w http.ResponseWriter, r *http.Re
 	}, http.StatusOK)
 }
 
+func (i *ImageHttpHandler) GetDetectionStats(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.GetDetectionStats] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	filter, err := util.StatsFilter(r)
+	if err != nil {
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	email := fmt.Sprint(claim["email"])
+	res, err := i.imageService.GetDetectionStats(email, filter)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.GetDetectionStats] error when retrieve detection stats with error %v \n", err)
+		httpWriteError(w, r, err, "Error read detection stats from database")
+		return
+	}
+
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
 func (i *ImageHttpHandler) UpdateImageResult(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	if err := checkStaticToken(r, auth.INTERNAL_API_TOKEN); err != nil {
+		log.Printf("[ImageHttpHandler.UpdateImageResult] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
 		return
 	}
 
@@ -235,22 +312,18 @@ func (i *ImageHttpHandler) UpdateImageResult(w http.ResponseWriter, r *http.Requ
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UpdateImageResult] error read request body with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error read request body",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, err, "Error read request body")
 		return
 	}
 
 	data, err := url.ParseQuery(string(body))
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UpdateImageResult] error parsequery  %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error parse form",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("Error parse form"), "")
 		return
 	}
 
-	filename := data.Get("filename")
+	filename := filenameParam(r, data)
 	confidence := data.Get("confidence")
 	detectedAt := data.Get("detectedAt")
 	inferenceTime := data.Get("inferenceTime")
@@ -259,62 +332,46 @@ func (i *ImageHttpHandler) UpdateImageResult(w http.ResponseWriter, r *http.Requ
 	fConfidence, err := strconv.ParseFloat(confidence, 64)
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UpdateImageResult] error when convert confident from string to float64 with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error update result to database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("confidence should be a number"), "")
 		return
 	}
 
 	fDetectedAt, err := strconv.ParseFloat(detectedAt, 32)
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UpdateImageResult] error when convert detected from string to float32 with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error update result to database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("detectedAt should be a number"), "")
 		return
 	}
 
 	fInferenceTime, err := strconv.ParseFloat(inferenceTime, 32)
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UpdateImageResult] error when convert inferenceTime from string to float32 with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error update result to database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("inferenceTime should be a number"), "")
 		return
 	}
 
 	if filename == "" {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "filename should be filled",
-		}, http.StatusBadRequest)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("filename should be filled"), "")
 		return
 	}
 
 	if label == "" {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "label should be filled",
-		}, http.StatusBadRequest)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("label should be filled"), "")
 		return
 	}
 
 	if fInferenceTime == 0 {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "inferenceTime should be filled",
-		}, http.StatusBadRequest)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("inferenceTime should be filled"), "")
 		return
 	}
 
 	if fDetectedAt == 0 {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "detectedAt should be filled",
-		}, http.StatusBadRequest)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("detectedAt should be filled"), "")
 		return
 	}
 
 	if fConfidence == 0 {
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "detectedAt should be filled",
-		}, http.StatusBadRequest)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("confidence should be filled"), "")
 		return
 	}
 
@@ -323,13 +380,12 @@ func (i *ImageHttpHandler) UpdateImageResult(w http.ResponseWriter, r *http.Requ
 	payload.DetectedAt = float32(fDetectedAt)
 	payload.InferenceTime = float32(fInferenceTime)
 	payload.Confidence = fConfidence
+	payload.ModelVersion = data.Get("modelVersion")
 
 	err = i.imageService.UpdateImageResult(payload)
 	if err != nil {
 		log.Printf("[ImageHttpHandler.UpdateImageResult] error when update detection with error %v \n", err)
-		httpWriteResponse(w, &domain.ServerResponse{
-			Message: "Error update result to database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, err, "Error update result to database")
 		return
 	}
 
@@ -339,65 +395,341 @@ func (i *ImageHttpHandler) UpdateImageResult(w http.ResponseWriter, r *http.Requ
 	}, http.StatusOK)
 }
 
-func (i *ImageHttpHandler) GetSingleDetection(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		httpWriteResponse(w, domain.ServerResponse{
-			Message: "invalid method",
-		}, http.StatusMethodNotAllowed)
+func (i *ImageHttpHandler) UpdateImageStatus(w http.ResponseWriter, r *http.Request) {
+	if err := checkStaticToken(r, auth.INTERNAL_API_TOKEN); err != nil {
+		log.Printf("[ImageHttpHandler.UpdateImageStatus] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.UpdateImageStatus] error read request body with error %v \n", err)
+		httpWriteError(w, r, err, "Error read request body")
+		return
+	}
+
+	data, err := url.ParseQuery(string(body))
+	if err != nil {
+		log.Printf("[ImageHttpHandler.UpdateImageStatus] error parsequery  %v \n", err)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("Error parse form"), "")
+		return
+	}
+
+	payload := domain.UpdateImageStatusPayload{
+		Filename: chi.URLParam(r, "id"),
+		Status:   domain.ImageStatus(data.Get("status")),
+	}
+
+	if payload.Filename == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("filename should be filled"), "")
+		return
+	}
+
+	err = i.imageService.UpdateImageStatus(payload)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.UpdateImageStatus] error when update status with error %v \n", err)
+		httpWriteError(w, r, err, "Error update status to database")
 		return
 	}
 
+	log.Printf("[ImageHttpHandler.UpdateImageStatus] [/v1/images/{id}/status] success update status from payload: %v \n", payload)
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) ReportImageFailure(w http.ResponseWriter, r *http.Request) {
+	if err := checkStaticToken(r, auth.INTERNAL_API_TOKEN); err != nil {
+		log.Printf("[ImageHttpHandler.ReportImageFailure] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ReportImageFailure] error read request body with error %v \n", err)
+		httpWriteError(w, r, err, "Error read request body")
+		return
+	}
+
+	data, err := url.ParseQuery(string(body))
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ReportImageFailure] error parsequery  %v \n", err)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("Error parse form"), "")
+		return
+	}
+
+	payload := domain.UpdateImageFailurePayload{
+		Filename:  chi.URLParam(r, "id"),
+		ErrorCode: data.Get("errorCode"),
+		Message:   data.Get("message"),
+	}
+
+	if payload.Filename == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("filename should be filled"), "")
+		return
+	}
+
+	if payload.ErrorCode == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("errorCode should be filled"), "")
+		return
+	}
+
+	if retryable := data.Get("retryable"); retryable != "" {
+		payload.Retryable, err = strconv.ParseBool(retryable)
+		if err != nil {
+			httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("retryable should be a boolean"), "")
+			return
+		}
+	}
+
+	err = i.imageService.ReportImageFailure(payload)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ReportImageFailure] error when report failure with error %v \n", err)
+		httpWriteError(w, r, err, "Error update failure to database")
+		return
+	}
+
+	log.Printf("[ImageHttpHandler.ReportImageFailure] [/v1/images/{id}/failure] success report failure from payload: %v \n", payload)
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) GetSingleDetection(w http.ResponseWriter, r *http.Request) {
 	claim, err := checkToken(w, r)
 	if err != nil {
 		log.Printf("[ImageHttpHandler.GetSingleDetection] error when checking token with error %v \n", err.Error())
-		httpWriteResponse(w, domain.ServerResponse{
-			Message: "error checking token",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, err, "")
 		return
 	}
 
 	email := fmt.Sprint(claim["email"])
 
-	path := strings.Split(r.URL.Path, "/image-detections/fetch/")
-
-	res, err := i.imageService.GetSingleDetection(email, path[1])
+	res, err := i.imageService.GetSingleDetection(email, chi.URLParam(r, "id"))
 	if err != nil {
 		log.Printf("[ImageHttpHandler.GetSingleDetection] error when retireve data from database with error %v \n", err.Error())
-		httpWriteResponse(w, domain.ServerResponse{
-			Message: "error retrieve data from database",
-		}, http.StatusInternalServerError)
+		httpWriteError(w, r, err, "error retrieve data from database")
 		return
 	}
 
-	if res.Filename == "" {
-		httpWriteResponse(w, domain.ServerResponse{
-			Message: "data not found",
-		}, http.StatusNotFound)
+	log.Printf("[ImageHttpHandler.GetSingleDetection] [/image-detections/fetch/] success retrieve single document with response: %v \n", res)
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.DeleteImage] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
 		return
 	}
 
-	log.Printf("[ImageHttpHandler.GetSingleDetection] [/image-detections/fetch/] success retrieve single document with response: %v \n", res)
+	email := fmt.Sprint(claim["email"])
+	filename := chi.URLParam(r, "id")
+	if filename == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("filename should be filled"), "")
+		return
+	}
+
+	res, err := i.imageService.DeleteImage(email, filename)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.DeleteImage] error when delete image with error %v \n", err)
+		httpWriteError(w, r, err, "Error delete image from database")
+		return
+	}
+
+	log.Printf("[ImageHttpHandler.DeleteImage] [/v1/images/{id}] success delete image: %v \n", res)
 	httpWriteResponse(w, domain.ServerResponse{
-		Message: "success",
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) RestoreImage(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.RestoreImage] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	email := fmt.Sprint(claim["email"])
+	filename := chi.URLParam(r, "id")
+	if filename == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("filename should be filled"), "")
+		return
+	}
+
+	res, err := i.imageService.RestoreImage(email, filename)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.RestoreImage] error when restore image with error %v \n", err)
+		httpWriteError(w, r, err, "Error restore image to database")
+		return
+	}
+
+	log.Printf("[ImageHttpHandler.RestoreImage] [/v1/images/{id}/restore] success restore image: %v \n", res.Filename)
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.CreateExport] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	email := fmt.Sprint(claim["email"])
+	res, err := i.imageService.CreateExport(email)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.CreateExport] error when create export with error %v \n", err)
+		httpWriteError(w, r, err, "Error create export")
+		return
+	}
+
+	log.Printf("[ImageHttpHandler.CreateExport] [/v1/exports] success create export: %v \n", res.ID)
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusAccepted)
+}
+
+func (i *ImageHttpHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.GetExport] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	email := fmt.Sprint(claim["email"])
+	id := chi.URLParam(r, "id")
+	res, err := i.imageService.GetExport(email, id)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.GetExport] error when retrieve export with error %v \n", err)
+		httpWriteError(w, r, err, "Error retrieve export")
+		return
+	}
+
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
 		Data:    res,
 	}, http.StatusOK)
 }
 
-func InitHttpServer(imageService service.ImageService) {
-	mux := http.NewServeMux()
+func (i *ImageHttpHandler) EraseAccount(w http.ResponseWriter, r *http.Request) {
+	if err := checkStaticToken(r, auth.INTERNAL_API_TOKEN); err != nil {
+		log.Printf("[ImageHttpHandler.EraseAccount] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	var event domain.AccountDeletedEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		log.Printf("[ImageHttpHandler.EraseAccount] error decode request body with error %v \n", err)
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("Error parse request body"), "")
+		return
+	}
+
+	if event.EventID == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("eventId should be filled"), "")
+		return
+	}
+
+	if event.Email == "" {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("email should be filled"), "")
+		return
+	}
+
+	res, err := i.imageService.EraseAccount(event)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.EraseAccount] error when erase account with error %v \n", err)
+		httpWriteError(w, r, err, "Error erase account")
+		return
+	}
+
+	log.Printf("[ImageHttpHandler.EraseAccount] [/v1/internal/accounts/deleted] accepted erasure job: %v \n", res.ID)
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusAccepted)
+}
+
+func (i *ImageHttpHandler) GetRetentionRules(w http.ResponseWriter, r *http.Request) {
+	if err := checkStaticToken(r, auth.ADMIN_API_TOKEN); err != nil {
+		log.Printf("[ImageHttpHandler.GetRetentionRules] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    i.imageService.GetRetentionRules(),
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) GetRetentionSweeps(w http.ResponseWriter, r *http.Request) {
+	if err := checkStaticToken(r, auth.ADMIN_API_TOKEN); err != nil {
+		log.Printf("[ImageHttpHandler.GetRetentionSweeps] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	limit := util.MinPageSize
+	if raw := util.ParseQueryParam(r.URL.Query().Get("limit")); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > util.MaxPageSize {
+			httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("limit should be a positive integer not greater than %v", util.MaxPageSize), "")
+			return
+		}
+	}
+
+	res, err := i.imageService.GetRetentionSweeps(limit)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.GetRetentionSweeps] error when retrieve retention sweeps with error %v \n", err)
+		httpWriteError(w, r, err, "Error read retention sweeps from database")
+		return
+	}
+
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+// InitHttpServer serves the API until ctx is cancelled and returns once the
+// in-flight requests finished or shutdownTimeout passed.
+func InitHttpServer(ctx context.Context, imageService port.ImageService) {
 	imageHandler := NewImageHttpHandler(imageService)
-	mux.HandleFunc("/image-detections/create", imageHandler.UploadImage)
-	mux.HandleFunc("/image-detections/fetch", imageHandler.GetDetectionResults)
-	mux.HandleFunc("/image-detections/update", imageHandler.UpdateImageResult)
-	mux.HandleFunc("/image-detections/fetch/", imageHandler.GetSingleDetection)
 	server := http.Server{
 		Addr:    ":8080",
-		Handler: mux,
-	}
+		Handler: NewRouter(imageHandler),
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("error shutting down port 8080 with error %v \n", err)
+		}
+	}()
+
 	log.Println("serving at port 8080")
 	err := server.ListenAndServe()
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		log.Printf("error listening to port 8080 with error %v \n", err)
 		return
 	}
+	<-stopped
 }
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"image-service/adapter/auth"
+	"image-service/core/domain"
+	"image-service/core/port"
+	"image-service/core/util"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testEmail = "user@example.com"
+
+func TestMain(m *testing.M) {
+	auth.JWT_SIGNATURE_KEY = []byte("test-signature-key")
+	os.Exit(m.Run())
+}
+
+// fakeImageService serves images from memory. Methods a test doesn't set up
+// panic through the nil embedded interface.
+type fakeImageService struct {
+	port.ImageService
+
+	mu      sync.Mutex
+	images  map[string]domain.Image
+	events  chan domain.DetectionEvent
+	results []domain.UpdateImagePayloadData
+	limits  []int
+
+	// exportErr fails the export once exportErrAfter rows were sent
+	exportErr      error
+	exportErrAfter int
+}
+
+func newFakeImageService(images ...domain.Image) *fakeImageService {
+	f := &fakeImageService{
+		images: map[string]domain.Image{},
+		events: make(chan domain.DetectionEvent, 16),
+	}
+	for _, img := range images {
+		f.images[img.Filename] = img
+	}
+	return f
+}
+
+func (f *fakeImageService) GetSingleDetection(email, filename string) (*domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.images[filename]
+	if !ok {
+		return nil, domain.ErrImageNotFound
+	}
+	if img.Email != email {
+		return nil, domain.ErrForbidden
+	}
+	return &img, nil
+}
+
+func (f *fakeImageService) UpdateImageResult(payload domain.UpdateImagePayloadData) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, payload)
+	return nil
+}
+
+func (f *fakeImageService) GetRetentionSweeps(limit int) ([]domain.RetentionSweep, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limits = append(f.limits, limit)
+	return []domain.RetentionSweep{}, nil
+}
+
+func (f *fakeImageService) ExportDetections(email string, filter domain.PageFilter, fn func(domain.Image) error) error {
+	f.mu.Lock()
+	images := make([]domain.Image, 0, len(f.images))
+	for _, img := range f.images {
+		if img.Email == email {
+			images = append(images, img)
+		}
+	}
+	f.mu.Unlock()
+	sort.Slice(images, func(a, b int) bool { return images[a].Filename < images[b].Filename })
+
+	for n, img := range images {
+		if f.exportErr != nil && n == f.exportErrAfter {
+			return f.exportErr
+		}
+		if err := fn(img); err != nil {
+			return err
+		}
+	}
+	if f.exportErr != nil && len(images) == f.exportErrAfter {
+		return f.exportErr
+	}
+	return nil
+}
+
+func (f *fakeImageService) SubscribeDetectionEvents(email, lastEventID string) ([]domain.DetectionEvent, <-chan domain.DetectionEvent, func()) {
+	return nil, f.events, func() {}
+}
+
+func newTestServer(t *testing.T, service port.ImageService) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(NewRouter(NewImageHttpHandler(service)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestToken(t *testing.T, email string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+	}).SignedString(auth.JWT_SIGNATURE_KEY)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestUpdateImageResultRequiresInternalToken(t *testing.T) {
+	auth.INTERNAL_API_TOKEN = []byte("test-internal-token")
+	t.Cleanup(func() { auth.INTERNAL_API_TOKEN = nil })
+	service := newFakeImageService()
+	server := newTestServer(t, service)
+	form := "confidence=0.9&detectedAt=1&inferenceTime=2&label=rust"
+
+	for _, path := range []string{"/v1/images/a.jpg/result", "/image-detections/update"} {
+		for token, want := range map[string]int{
+			"":                         http.StatusUnauthorized,
+			newTestToken(t, testEmail): http.StatusUnauthorized,
+			"test-internal-token":      http.StatusOK,
+		} {
+			body := form
+			if path == "/image-detections/update" {
+				body += "&filename=a.jpg"
+			}
+			req, err := http.NewRequest(http.MethodPut, server.URL+path, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != want {
+				t.Errorf("%v with token %q = %v, want %v", path, token, res.StatusCode, want)
+			}
+		}
+	}
+	if len(service.results) != 2 || service.results[0].Filename != "a.jpg" {
+		t.Fatalf("results = %+v, want only the authenticated ones", service.results)
+	}
+}
+
+func TestGetRetentionSweepsBoundsLimit(t *testing.T) {
+	auth.ADMIN_API_TOKEN = []byte("test-admin-token")
+	t.Cleanup(func() { auth.ADMIN_API_TOKEN = nil })
+	service := newFakeImageService()
+	server := newTestServer(t, service)
+
+	for query, want := range map[string]int{
+		"":           http.StatusOK,
+		"?limit=100": http.StatusOK,
+		"?limit=101": http.StatusBadRequest,
+		"?limit=0":   http.StatusBadRequest,
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/admin/retention/sweeps"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer test-admin-token")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Errorf("sweeps%v = %v, want %v", query, res.StatusCode, want)
+		}
+	}
+	sort.Ints(service.limits)
+	if len(service.limits) != 2 || service.limits[0] != util.MinPageSize || service.limits[1] != util.MaxPageSize {
+		t.Fatalf("limits = %v, want the default and the maximum", service.limits)
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed docs/openapi.json docs/index.html
+var docsFS embed.FS
+
+const docsPagePolicy = "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; base-uri 'none'; form-action 'none'"
+
+// openAPIDocument loads the embedded spec and adds the legacy aliases of the
+// versioned operations, so they are documented without being written twice.
+func openAPIDocument(rts []route) ([]byte, error) {
+	raw, err := docsFS.ReadFile("docs/openapi.json")
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, err
+	}
+	paths, ok := spec["paths"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("openapi document has no paths")
+	}
+
+	for _, rt := range rts {
+		if rt.Legacy == "" {
+			continue
+		}
+		item, _ := paths[apiPrefix+rt.Path].(map[string]interface{})
+		op, _ := item[strings.ToLower(rt.Method)].(map[string]interface{})
+		if op == nil {
+			// reported by checkOpenAPICoverage
+			continue
+		}
+		legacy, _ := paths[rt.Legacy].(map[string]interface{})
+		if legacy == nil {
+			legacy = map[string]interface{}{}
+			paths[rt.Legacy] = legacy
+		}
+		legacy[strings.ToLower(rt.Method)] = legacyOperation(op, item["parameters"], rt)
+	}
+	return json.Marshal(spec)
+}
+
+// legacyOperation copies a versioned operation for its deprecated alias. Path
+// parameters the legacy path doesn't have are dropped, those endpoints read
+// the filename from the form instead.
+func legacyOperation(op map[string]interface{}, pathParams interface{}, rt route) map[string]interface{} {
+	clone := make(map[string]interface{}, len(op)+2)
+	for k, v := range op {
+		clone[k] = v
+	}
+	clone["operationId"] = fmt.Sprint(op["operationId"]) + "Legacy"
+	clone["deprecated"] = true
+	clone["description"] = fmt.Sprintf("Deprecated alias of %s %s.", rt.Method, apiPrefix+rt.Path)
+
+	var params []interface{}
+	if shared, ok := pathParams.([]interface{}); ok {
+		params = append(params, shared...)
+	}
+	if own, ok := op["parameters"].([]interface{}); ok {
+		params = append(params, own...)
+	}
+	kept := make([]interface{}, 0, len(params))
+	for _, p := range params {
+		param, _ := p.(map[string]interface{})
+		if param["in"] == "path" && !strings.Contains(rt.Legacy, "{"+fmt.Sprint(param["name"])+"}") {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if len(kept) > 0 {
+		clone["parameters"] = kept
+	} else {
+		delete(clone, "parameters")
+	}
+	return clone
+}
+
+// checkOpenAPICoverage returns an error listing every route registered on the
+// router that has no operation in the spec.
+func checkOpenAPICoverage(router chi.Routes, doc []byte) error {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(doc, &spec); err != nil {
+		return err
+	}
+
+	var missing []string
+	err := chi.Walk(router, func(method string, path string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+			missing = append(missing, method+" "+path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes missing from the openapi document: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// serveOpenAPIDocument reports a document that failed to load as an internal
+// error instead of taking the API down with it.
+func serveOpenAPIDocument(doc []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if doc == nil {
+			httpWriteProblem(w, r, http.StatusInternalServerError, "internal_error", "failed to load openapi document")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(doc)
+	}
+}
+
+func serveDocsPage(w http.ResponseWriter, r *http.Request) {
+	page, err := docsFS.ReadFile("docs/index.html")
+	if err != nil {
+		log.Printf("[serveDocsPage] error when read docs page with error %v \n", err)
+		httpWriteError(w, r, err, "failed to load docs page")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the page is self-contained, nothing outside of it may be loaded
+	w.Header().Set("Content-Security-Policy", docsPagePolicy)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(page)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const apiPrefix = "/v1"
+
+// route maps a versioned endpoint to its handler. Legacy is the path the
+// endpoint was served at before versioning, kept as a deprecated alias. Only
+// the endpoints that predate versioning have one.
+type route struct {
+	Method  string
+	Path    string
+	Legacy  string
+	Handler http.HandlerFunc
+}
+
+func routes(i *ImageHttpHandler) []route {
+	return []route{
+		{http.MethodPost, "/images", "/image-detections/create", i.UploadImage},
+		{http.MethodGet, "/images", "/image-detections/fetch", i.GetDetectionResults},
+		{http.MethodGet, "/images/stats", "", i.GetDetectionStats},
+		{http.MethodGet, "/images/export", "", i.ExportDetections},
+		{http.MethodGet, "/images/{id}", "/image-detections/fetch/{id}", i.GetSingleDetection},
+		{http.MethodDelete, "/images/{id}", "", i.DeleteImage},
+		{http.MethodPost, "/images/{id}/restore", "", i.RestoreImage},
+		{http.MethodPut, "/images/{id}/result", "/image-detections/update", i.UpdateImageResult},
+		{http.MethodPut, "/images/{id}/status", "", i.UpdateImageStatus},
+		{http.MethodPut, "/images/{id}/failure", "", i.ReportImageFailure},
+		{http.MethodGet, "/events", "", i.StreamDetectionEvents},
+		{http.MethodGet, "/events/ws", "", i.DetectionEventsSocket},
+		{http.MethodPost, "/exports", "", i.CreateExport},
+		{http.MethodGet, "/exports/{id}", "", i.GetExport},
+		{http.MethodGet, "/webhooks", "", i.ListWebhooks},
+		{http.MethodPost, "/webhooks", "", i.CreateWebhook},
+		{http.MethodDelete, "/webhooks/{id}", "", i.DeleteWebhook},
+		{http.MethodGet, "/webhooks/{id}/deliveries", "", i.ListWebhookDeliveries},
+		{http.MethodPost, "/webhooks/deliveries/{deliveryId}/redeliver", "", i.RedeliverWebhook},
+		{http.MethodPost, "/devices", "", i.RegisterDevice},
+		{http.MethodDelete, "/devices/{token}", "", i.UnregisterDevice},
+		{http.MethodPost, "/internal/accounts/deleted", "", i.EraseAccount},
+		{http.MethodGet, "/admin/retention/policies", "", i.GetRetentionRules},
+		{http.MethodGet, "/admin/retention/sweeps", "", i.GetRetentionSweeps},
+	}
+}
+
+// deprecated marks responses of legacy paths and points clients at the
+// versioned path of the same resource.
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := successor
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			for idx, key := range rctx.URLParams.Keys {
+				link = strings.ReplaceAll(link, "{"+key+"}", rctx.URLParams.Values[idx])
+			}
+		}
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+		next(w, r)
+	}
+}
+
+func NewRouter(i *ImageHttpHandler) http.Handler {
+	router := chi.NewRouter()
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		httpWriteProblem(w, r, http.StatusNotFound, "route_not_found", "no route matches the request path")
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		httpWriteProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "the route does not support the request method")
+	})
+	rts := routes(i)
+	for _, rt := range rts {
+		router.Method(rt.Method, apiPrefix+rt.Path, rt.Handler)
+		if rt.Legacy != "" {
+			router.Method(rt.Method, rt.Legacy, deprecated(apiPrefix+rt.Path, rt.Handler))
+		}
+	}
+
+	// routes missing from the document are caught by TestRoutesAreDocumented
+	doc, err := openAPIDocument(rts)
+	if err != nil {
+		log.Printf("[NewRouter] error when load openapi document with error %v \n", err)
+	}
+	router.Get("/openapi.json", serveOpenAPIDocument(doc))
+	router.Get("/docs", serveDocsPage)
+	return router
+}
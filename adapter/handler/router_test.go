@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	i := NewImageHttpHandler(newFakeImageService())
+	doc, err := openAPIDocument(routes(i))
+	if err != nil {
+		t.Fatalf("load openapi document: %v", err)
+	}
+	if err = checkOpenAPICoverage(NewRouter(i).(chi.Routes), doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyRoutesPointAtSuccessor(t *testing.T) {
+	server := newTestServer(t, newFakeImageService(testImage("a.jpg")))
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/image-detections/fetch/a.jpg", nil)
+	req.Header.Set("Authorization", "Bearer "+newTestToken(t, testEmail))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v", res.StatusCode)
+	}
+	if res.Header.Get("Deprecation") != "true" || res.Header.Get("Link") != `</v1/images/a.jpg>; rel="successor-version"` {
+		t.Fatalf("deprecation headers = %v", res.Header)
+	}
+}
+
+func TestOnlyBaselineRoutesHaveLegacyAliases(t *testing.T) {
+	baseline := map[string]bool{
+		"/image-detections/create":     true,
+		"/image-detections/fetch":      true,
+		"/image-detections/fetch/{id}": true,
+		"/image-detections/update":     true,
+	}
+	i := NewImageHttpHandler(newFakeImageService())
+	for _, rt := range routes(i) {
+		if rt.Legacy != "" && !baseline[rt.Legacy] {
+			t.Errorf("%v %v has legacy alias %v", rt.Method, rt.Path, rt.Legacy)
+		}
+	}
+
+	doc, err := openAPIDocument(routes(i))
+	if err != nil {
+		t.Fatalf("load openapi document: %v", err)
+	}
+	var spec struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	if err = json.Unmarshal(doc, &spec); err != nil {
+		t.Fatalf("decode openapi document: %v", err)
+	}
+	for path := range spec.Paths {
+		unversioned := !strings.HasPrefix(path, apiPrefix) && path != "/openapi.json" && path != "/docs"
+		if unversioned && !baseline[path] {
+			t.Errorf("document lists unversioned path %v", path)
+		}
+	}
+
+	server := newTestServer(t, newFakeImageService())
+	res, err := http.Get(server.URL + "/image-detections/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("removed alias status = %v, want 404", res.StatusCode)
+	}
+}
+
+func TestDocsPageLoadsNothingExternal(t *testing.T) {
+	server := newTestServer(t, newFakeImageService())
+	res, err := http.Get(server.URL + "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	page, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Security-Policy"), "default-src 'none'") {
+		t.Fatalf("status = %v, policy = %q", res.StatusCode, res.Header.Get("Content-Security-Policy"))
+	}
+	if strings.Contains(string(page), "<script src=") || strings.Contains(string(page), "<link") {
+		t.Fatal("docs page loads an external resource")
+	}
+}
+
+func TestServeOpenAPIDocument(t *testing.T) {
+	server := newTestServer(t, newFakeImageService())
+	res, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("openapi.json = %v %v", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	// a document that failed to load is an error response, not a crash
+	rec := httptest.NewRecorder()
+	serveOpenAPIDocument(nil)(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status without document = %v", rec.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"image-service/adapter/auth"
+	"image-service/core/domain"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (i *ImageHttpHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ListWebhooks] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	res, err := i.imageService.ListWebhooks(auth.UploaderFromClaim(claim))
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ListWebhooks] error when list webhooks with error %v \n", err)
+		httpWriteError(w, r, err, "Error retrieve webhooks")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.CreateWebhook] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	var payload domain.CreateWebhookPayload
+	if err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&payload); err != nil {
+		httpWriteError(w, r, domain.ErrInvalidRequest.Errorf("invalid webhook payload"), "")
+		return
+	}
+	res, err := i.imageService.CreateWebhook(auth.UploaderFromClaim(claim), payload)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.CreateWebhook] error when create webhook with error %v \n", err)
+		httpWriteError(w, r, err, "Error create webhook")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusCreated)
+}
+
+func (i *ImageHttpHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.DeleteWebhook] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	err = i.imageService.DeleteWebhook(auth.UploaderFromClaim(claim), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Printf("[ImageHttpHandler.DeleteWebhook] error when delete webhook with error %v \n", err)
+		httpWriteError(w, r, err, "Error delete webhook")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ListWebhookDeliveries] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	res, err := i.imageService.ListWebhookDeliveries(auth.UploaderFromClaim(claim), chi.URLParam(r, "id"))
+	if err != nil {
+		log.Printf("[ImageHttpHandler.ListWebhookDeliveries] error when list deliveries with error %v \n", err)
+		httpWriteError(w, r, err, "Error retrieve webhook deliveries")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusOK)
+}
+
+func (i *ImageHttpHandler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.RedeliverWebhook] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+
+	res, err := i.imageService.RedeliverWebhook(auth.UploaderFromClaim(claim), chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		log.Printf("[ImageHttpHandler.RedeliverWebhook] error when redeliver webhook with error %v \n", err)
+		httpWriteError(w, r, err, "Error redeliver webhook")
+		return
+	}
+	httpWriteResponse(w, domain.ServerResponse{
+		Message: "Success",
+		Data:    res,
+	}, http.StatusAccepted)
+}
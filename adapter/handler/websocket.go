@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	maxWebsocketFilenames = 100
+
+	websocketActionSubscribe   = "subscribe"
+	websocketActionUnsubscribe = "unsubscribe"
+
+	websocketTypeSubscribed = "subscribed"
+	websocketTypeSnapshot   = "image.snapshot"
+	websocketTypeHeartbeat  = "heartbeat"
+	websocketTypeError      = "error"
+)
+
+// websocketRequest is sent by clients to change what they receive. With All
+// set every image of the caller is followed, otherwise only Filenames.
+type websocketRequest struct {
+	Action    string   `json:"action"`
+	Filenames []string `json:"filenames"`
+	All       bool     `json:"all"`
+}
+
+type websocketMessage struct {
+	Type      string        `json:"type"`
+	Message   string        `json:"message,omitempty"`
+	Filenames []string      `json:"filenames,omitempty"`
+	All       bool          `json:"all,omitempty"`
+	Image     *domain.Image `json:"image,omitempty"`
+}
+
+type websocketSubscription struct {
+	all       bool
+	filenames map[string]bool
+}
+
+func (s *websocketSubscription) matches(event domain.DetectionEvent) bool {
+	return s.all || s.filenames[event.Filename]
+}
+
+func (s *websocketSubscription) apply(req websocketRequest) error {
+	switch req.Action {
+	case websocketActionSubscribe:
+		added := []string{}
+		for _, filename := range req.Filenames {
+			if filename != "" && !s.filenames[filename] {
+				s.filenames[filename] = true
+				added = append(added, filename)
+			}
+		}
+		if len(s.filenames) > maxWebsocketFilenames {
+			// a rejected request leaves names subscribed earlier alone
+			for _, filename := range added {
+				delete(s.filenames, filename)
+			}
+			return fmt.Errorf("at most %d filenames can be subscribed", maxWebsocketFilenames)
+		}
+		if req.All {
+			s.all = true
+		}
+	case websocketActionUnsubscribe:
+		if req.All {
+			s.all = false
+		}
+		for _, filename := range req.Filenames {
+			delete(s.filenames, filename)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", req.Action)
+	}
+	return nil
+}
+
+func (s *websocketSubscription) message() websocketMessage {
+	filenames := []string{}
+	for filename := range s.filenames {
+		filenames = append(filenames, filename)
+	}
+	return websocketMessage{
+		Type:      websocketTypeSubscribed,
+		Filenames: filenames,
+		All:       s.all,
+	}
+}
+
+// DetectionEventsSocket lets clients follow status transitions of selected
+// images, or all of their images, over a WebSocket. Browsers can't set the
+// Authorization header on the upgrade request, so the token is also accepted
+// as the `token` query parameter.
+func (i *ImageHttpHandler) DetectionEventsSocket(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	claim, err := checkToken(w, r)
+	if err != nil {
+		log.Printf("[ImageHttpHandler.DetectionEventsSocket] error when checking token with error %v \n", err)
+		httpWriteError(w, r, err, "")
+		return
+	}
+	email := fmt.Sprint(claim["email"])
+
+	server := websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			serveDetectionEventsSocket(i, conn, email)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func serveDetectionEventsSocket(i *ImageHttpHandler, conn *websocket.Conn, email string) {
+	_, events, unsubscribe := i.imageService.SubscribeDetectionEvents(email, "")
+	defer unsubscribe()
+
+	// only this goroutine writes to conn, the reader hands requests over
+	requests := make(chan websocketRequest)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var req websocketRequest
+			if err := websocket.JSON.Receive(conn, &req); err != nil {
+				return
+			}
+			select {
+			case requests <- req:
+			case <-conn.Request().Context().Done():
+				return
+			}
+		}
+	}()
+
+	subscription := &websocketSubscription{
+		filenames: map[string]bool{},
+	}
+	heartbeat := newHeartbeat()
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case req := <-requests:
+			err = handleWebsocketRequest(i, conn, email, subscription, req)
+		case event, ok := <-events:
+			if !ok {
+				// the hub dropped this connection for falling behind
+				_ = websocket.JSON.Send(conn, websocketMessage{
+					Type: domain.EventStreamLagged,
+				})
+				return
+			}
+			if subscription.matches(event) {
+				err = websocket.JSON.Send(conn, event)
+			}
+		case <-heartbeat.C:
+			err = websocket.JSON.Send(conn, websocketMessage{
+				Type: websocketTypeHeartbeat,
+			})
+		}
+		if err != nil {
+			log.Printf("[ImageHttpHandler.DetectionEventsSocket] error when write message with error %v \n", err)
+			return
+		}
+	}
+}
+
+func handleWebsocketRequest(i *ImageHttpHandler, conn *websocket.Conn, email string, subscription *websocketSubscription, req websocketRequest) error {
+	if err := subscription.apply(req); err != nil {
+		return websocket.JSON.Send(conn, websocketMessage{
+			Type:    websocketTypeError,
+			Message: err.Error(),
+		})
+	}
+	if err := websocket.JSON.Send(conn, subscription.message()); err != nil {
+		return err
+	}
+	if req.Action != websocketActionSubscribe {
+		return nil
+	}
+
+	// send the current state so clients don't miss transitions that happened
+	// before they subscribed
+	for _, filename := range req.Filenames {
+		img, err := i.imageService.GetSingleDetection(email, filename)
+		if err != nil {
+			if domain.AsError(err) == nil {
+				log.Printf("[ImageHttpHandler.DetectionEventsSocket] error when retrieve %v with error %v \n", filename, err)
+			}
+			err = websocket.JSON.Send(conn, websocketMessage{
+				Type:      websocketTypeError,
+				Message:   clientErrorMessage(err),
+				Filenames: []string{filename},
+			})
+		} else {
+			err = websocket.JSON.Send(conn, websocketMessage{
+				Type:  websocketTypeSnapshot,
+				Image: img,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// socketMessage holds the fields of both websocketMessage and
+// domain.DetectionEvent, the socket sends either.
+type socketMessage struct {
+	Type      string        `json:"type"`
+	Message   string        `json:"message"`
+	Filenames []string      `json:"filenames"`
+	All       bool          `json:"all"`
+	Image     *domain.Image `json:"image"`
+	Filename  string        `json:"filename"`
+	Status    string        `json:"status"`
+}
+
+func dialSocket(t *testing.T, serverURL, token string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(serverURL, "http") + "/v1/events/ws?token=" + token
+	conn, err := websocket.Dial(url, "", serverURL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, req websocketRequest) {
+	t.Helper()
+	if err := websocket.JSON.Send(conn, req); err != nil {
+		t.Fatalf("send %+v: %v", req, err)
+	}
+}
+
+// receive skips heartbeats, which arrive whenever the test is slow.
+func receive(t *testing.T, conn *websocket.Conn) socketMessage {
+	t.Helper()
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg socketMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatalf("receive: %v", err)
+		}
+		if msg.Type != websocketTypeHeartbeat {
+			return msg
+		}
+	}
+}
+
+func testImage(filename string) domain.Image {
+	return domain.Image{
+		Email:    testEmail,
+		Filename: filename,
+		Status:   domain.ImageStatusQueued,
+	}
+}
+
+func TestDetectionEventsSocketRequiresToken(t *testing.T) {
+	server := newTestServer(t, newFakeImageService())
+
+	res, err := http.Get(server.URL + "/v1/events/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %v, want %v", res.StatusCode, http.StatusUnauthorized)
+	}
+	if _, err = websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/events/ws", "", server.URL); err == nil {
+		t.Fatal("dial without token succeeded")
+	}
+}
+
+func TestDetectionEventsSocketSubscribeSendsSnapshotAndEvents(t *testing.T) {
+	service := newFakeImageService(testImage("a.jpg"), testImage("b.jpg"))
+	server := newTestServer(t, service)
+	conn := dialSocket(t, server.URL, newTestToken(t, testEmail))
+
+	send(t, conn, websocketRequest{Action: websocketActionSubscribe, Filenames: []string{"a.jpg"}})
+	msg := receive(t, conn)
+	if msg.Type != websocketTypeSubscribed || len(msg.Filenames) != 1 || msg.Filenames[0] != "a.jpg" {
+		t.Fatalf("subscribe reply = %+v", msg)
+	}
+	msg = receive(t, conn)
+	if msg.Type != websocketTypeSnapshot || msg.Image == nil || msg.Image.Filename != "a.jpg" {
+		t.Fatalf("snapshot = %+v", msg)
+	}
+
+	// events of images nobody subscribed to are filtered out
+	service.events <- domain.DetectionEvent{Type: domain.EventImageStatusChanged, Filename: "b.jpg", Status: domain.ImageStatusProcessing}
+	service.events <- domain.DetectionEvent{Type: domain.EventDetectionCompleted, Filename: "a.jpg", Status: domain.ImageStatusDetected}
+	msg = receive(t, conn)
+	if msg.Type != domain.EventDetectionCompleted || msg.Filename != "a.jpg" || msg.Status != string(domain.ImageStatusDetected) {
+		t.Fatalf("event = %+v", msg)
+	}
+}
+
+func TestDetectionEventsSocketUnsubscribe(t *testing.T) {
+	service := newFakeImageService(testImage("a.jpg"))
+	server := newTestServer(t, service)
+	conn := dialSocket(t, server.URL, newTestToken(t, testEmail))
+
+	send(t, conn, websocketRequest{Action: websocketActionSubscribe, All: true})
+	if msg := receive(t, conn); msg.Type != websocketTypeSubscribed || !msg.All {
+		t.Fatalf("subscribe reply = %+v", msg)
+	}
+	send(t, conn, websocketRequest{Action: websocketActionUnsubscribe, All: true})
+	if msg := receive(t, conn); msg.Type != websocketTypeSubscribed || msg.All {
+		t.Fatalf("unsubscribe reply = %+v", msg)
+	}
+	send(t, conn, websocketRequest{Action: websocketActionSubscribe, Filenames: []string{"a.jpg"}})
+	receive(t, conn)
+	receive(t, conn)
+
+	service.events <- domain.DetectionEvent{Type: domain.EventImageStatusChanged, Filename: "other.jpg"}
+	service.events <- domain.DetectionEvent{Type: domain.EventImageStatusChanged, Filename: "a.jpg"}
+	if msg := receive(t, conn); msg.Filename != "a.jpg" {
+		t.Fatalf("event = %+v, want a.jpg only", msg)
+	}
+}
+
+func TestDetectionEventsSocketReportsUnknownImages(t *testing.T) {
+	server := newTestServer(t, newFakeImageService())
+	conn := dialSocket(t, server.URL, newTestToken(t, testEmail))
+
+	send(t, conn, websocketRequest{Action: websocketActionSubscribe, Filenames: []string{"missing.jpg"}})
+	receive(t, conn)
+	msg := receive(t, conn)
+	if msg.Type != websocketTypeError || len(msg.Filenames) != 1 || msg.Filenames[0] != "missing.jpg" {
+		t.Fatalf("error = %+v", msg)
+	}
+}
+
+func TestDetectionEventsSocketRejectsUnknownAction(t *testing.T) {
+	server := newTestServer(t, newFakeImageService())
+	conn := dialSocket(t, server.URL, newTestToken(t, testEmail))
+
+	send(t, conn, websocketRequest{Action: "follow"})
+	if msg := receive(t, conn); msg.Type != websocketTypeError || !strings.Contains(msg.Message, "follow") {
+		t.Fatalf("reply = %+v", msg)
+	}
+}
+
+func TestDetectionEventsSocketEndsLaggingConnection(t *testing.T) {
+	service := newFakeImageService()
+	server := newTestServer(t, service)
+	conn := dialSocket(t, server.URL, newTestToken(t, testEmail))
+
+	// the hub closes the channel of subscribers that fell behind
+	close(service.events)
+	if msg := receive(t, conn); msg.Type != domain.EventStreamLagged {
+		t.Fatalf("message = %+v, want %v", msg, domain.EventStreamLagged)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var raw json.RawMessage
+	if err := websocket.JSON.Receive(conn, &raw); err == nil {
+		t.Fatalf("connection still open, received %s", raw)
+	}
+}
+
+func TestWebsocketSubscriptionLimitKeepsExistingNames(t *testing.T) {
+	subscription := &websocketSubscription{
+		filenames: map[string]bool{},
+	}
+	filenames := make([]string, maxWebsocketFilenames)
+	for n := range filenames {
+		filenames[n] = fmt.Sprintf("%d.jpg", n)
+	}
+	if err := subscription.apply(websocketRequest{Action: websocketActionSubscribe, Filenames: filenames}); err != nil {
+		t.Fatalf("subscribe %v names: %v", maxWebsocketFilenames, err)
+	}
+
+	// one name is already subscribed, one would exceed the limit
+	err := subscription.apply(websocketRequest{
+		Action:    websocketActionSubscribe,
+		Filenames: []string{"0.jpg", "extra.jpg"},
+		All:       true,
+	})
+	if err == nil {
+		t.Fatal("subscribe over the limit succeeded")
+	}
+	if len(subscription.filenames) != maxWebsocketFilenames || !subscription.filenames["0.jpg"] || subscription.filenames["extra.jpg"] {
+		t.Fatalf("filenames after rejected request = %v", subscription.filenames)
+	}
+	if subscription.all {
+		t.Fatal("rejected request subscribed to all images")
+	}
+}
@@ -0,0 +1,43 @@
+package notifier
+
+import (
+	"context"
+	"image-service/core/domain"
+	"sync"
+)
+
+// maxFakeMessages bounds the memory a long running FakeNotifier holds.
+const maxFakeMessages = 100
+
+// FakeNotifier keeps the latest messages in memory instead of sending them,
+// for tests. Tokens listed in Unregistered are rejected like FCM would.
+type FakeNotifier struct {
+	mu           sync.Mutex
+	messages     []domain.PushMessage
+	Unregistered map[string]bool
+}
+
+func NewFakeNotifier() *FakeNotifier {
+	return &FakeNotifier{
+		Unregistered: map[string]bool{},
+	}
+}
+
+func (f *FakeNotifier) Notify(ctx context.Context, msg domain.PushMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Unregistered[msg.Token] {
+		return domain.ErrUnregisteredDevice
+	}
+	if len(f.messages) == maxFakeMessages {
+		f.messages = append(f.messages[:0], f.messages[1:]...)
+	}
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func (f *FakeNotifier) Messages() []domain.PushMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]domain.PushMessage{}, f.messages...)
+}
@@ -0,0 +1,152 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	DefaultFCMEndpoint = "https://fcm.googleapis.com"
+	fcmScope           = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// FCMNotifier sends messages through the FCM HTTP v1 API, authorized with
+// the OAuth2 token of a service account.
+type FCMNotifier struct {
+	url    string
+	client *http.Client
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+type fcmErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// NewFCMNotifier reads the service account from credentialsFile, or from the
+// application default credentials when it is empty. projectID defaults to the
+// project of the service account.
+func NewFCMNotifier(ctx context.Context, endpoint, projectID, credentialsFile string) (*FCMNotifier, error) {
+	var creds *google.Credentials
+	var err error
+	if credentialsFile != "" {
+		var data []byte
+		data, err = os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, fcmScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, fcmScope)
+	}
+	if err != nil {
+		log.Printf("[NewFCMNotifier] error when read credentials with error %v \n", err)
+		return nil, err
+	}
+	if projectID == "" {
+		projectID = creds.ProjectID
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("fcm project id is not set and not part of the credentials")
+	}
+	return newFCMNotifier(endpoint, projectID, creds.TokenSource), nil
+}
+
+func newFCMNotifier(endpoint, projectID string, tokens oauth2.TokenSource) *FCMNotifier {
+	if endpoint == "" {
+		endpoint = DefaultFCMEndpoint
+	}
+	client := oauth2.NewClient(context.Background(), tokens)
+	client.Timeout = 10 * time.Second
+	return &FCMNotifier{
+		url:    fmt.Sprintf("%v/v1/projects/%v/messages:send", strings.TrimSuffix(endpoint, "/"), projectID),
+		client: client,
+	}
+}
+
+func (f *FCMNotifier) Notify(ctx context.Context, msg domain.PushMessage) error {
+	body, err := json.Marshal(fcmRequest{
+		Message: fcmMessage{
+			Token: msg.Token,
+			Notification: fcmNotification{
+				Title: msg.Title,
+				Body:  msg.Body,
+			},
+			Data: msg.Data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		log.Printf("[FCMNotifier.Notify] error when send message with error %v \n", err)
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+
+	var result fcmErrorResponse
+	if err = json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&result); err != nil {
+		return fmt.Errorf("fcm responded with status %d", res.StatusCode)
+	}
+	if isUnregisteredToken(result) {
+		return domain.ErrUnregisteredDevice
+	}
+	return fmt.Errorf("fcm rejected message with status %v: %v", result.Error.Status, result.Error.Message)
+}
+
+// isUnregisteredToken reports errors that mean the token will never work
+// again. An invalid argument may as well be a bad message field, so it is
+// reported like any other error and the token is kept.
+func isUnregisteredToken(res fcmErrorResponse) bool {
+	for _, detail := range res.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return true
+		}
+	}
+	return res.Error.Status == "NOT_FOUND"
+}
@@ -0,0 +1,25 @@
+package notifier
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+	"sync"
+)
+
+// NoopNotifier drops every message, it is used when no push provider is
+// configured.
+type NoopNotifier struct {
+	warn sync.Once
+}
+
+func NewNoopNotifier() *NoopNotifier {
+	return &NoopNotifier{}
+}
+
+func (n *NoopNotifier) Notify(ctx context.Context, msg domain.PushMessage) error {
+	n.warn.Do(func() {
+		log.Printf("[NoopNotifier.Notify] push notifications are disabled, set PUSH_NOTIFIER=fcm to send them \n")
+	})
+	return nil
+}
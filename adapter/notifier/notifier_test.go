@@ -0,0 +1,122 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func newTestFCM(t *testing.T, handler http.HandlerFunc) *FCMNotifier {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return newFCMNotifier(server.URL, "test-project", oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access-token"}))
+}
+
+func TestFCMNotifierSendsV1Message(t *testing.T) {
+	var got fcmRequest
+	notifier := newTestFCM(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/test-project/messages:send" {
+			t.Errorf("path = %v", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer access-token" {
+			t.Errorf("authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		fmt.Fprint(w, `{"name":"projects/test-project/messages/1"}`)
+	})
+
+	err := notifier.Notify(context.Background(), domain.PushMessage{
+		Token: "device-token",
+		Title: "Detection completed",
+		Body:  "a.jpg",
+		Data:  map[string]string{"filename": "a.jpg"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Message.Token != "device-token" || got.Message.Notification.Title != "Detection completed" || got.Message.Data["filename"] != "a.jpg" {
+		t.Fatalf("message = %+v", got.Message)
+	}
+}
+
+func TestFCMNotifierReportsUnregisteredTokens(t *testing.T) {
+	for name, body := range map[string]string{
+		"unregistered": `{"error":{"code":404,"status":"NOT_FOUND","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`,
+		"not found":    `{"error":{"code":404,"status":"NOT_FOUND","message":"Requested entity was not found."}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			notifier := newTestFCM(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, body)
+			})
+			if err := notifier.Notify(context.Background(), domain.PushMessage{Token: "gone"}); !errors.Is(err, domain.ErrUnregisteredDevice) {
+				t.Fatalf("Notify = %v, want %v", err, domain.ErrUnregisteredDevice)
+			}
+		})
+	}
+}
+
+func TestFCMNotifierKeepsTokenOnInvalidArgument(t *testing.T) {
+	for name, body := range map[string]string{
+		"status":     `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"The registration token is not a valid FCM registration token"}}`,
+		"error code": `{"error":{"code":400,"status":"INVALID_ARGUMENT","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"INVALID_ARGUMENT"}]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			notifier := newTestFCM(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, body)
+			})
+			err := notifier.Notify(context.Background(), domain.PushMessage{Token: "device-token"})
+			if err == nil || errors.Is(err, domain.ErrUnregisteredDevice) {
+				t.Fatalf("Notify = %v, want an error that keeps the token", err)
+			}
+		})
+	}
+}
+
+func TestFCMNotifierKeepsTokenOnServerErrors(t *testing.T) {
+	notifier := newTestFCM(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":{"code":503,"status":"UNAVAILABLE","message":"try again"}}`)
+	})
+	err := notifier.Notify(context.Background(), domain.PushMessage{Token: "device-token"})
+	if err == nil || errors.Is(err, domain.ErrUnregisteredDevice) {
+		t.Fatalf("Notify = %v, want a retryable error", err)
+	}
+}
+
+func TestFakeNotifierKeepsLatestMessages(t *testing.T) {
+	notifier := NewFakeNotifier()
+	notifier.Unregistered["gone"] = true
+	if err := notifier.Notify(context.Background(), domain.PushMessage{Token: "gone"}); !errors.Is(err, domain.ErrUnregisteredDevice) {
+		t.Fatalf("Notify = %v, want %v", err, domain.ErrUnregisteredDevice)
+	}
+	for n := 0; n < maxFakeMessages+5; n++ {
+		if err := notifier.Notify(context.Background(), domain.PushMessage{Token: fmt.Sprint(n)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := notifier.Messages()
+	if len(messages) != maxFakeMessages || messages[0].Token != "5" || messages[len(messages)-1].Token != fmt.Sprint(maxFakeMessages+4) {
+		t.Fatalf("kept %v messages from %v to %v", len(messages), messages[0].Token, messages[len(messages)-1].Token)
+	}
+}
+
+func TestNoopNotifierDropsMessages(t *testing.T) {
+	notifier := NewNoopNotifier()
+	for n := 0; n < 3; n++ {
+		if err := notifier.Notify(context.Background(), domain.PushMessage{Token: "device-token"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
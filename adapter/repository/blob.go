@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+const imageBlobPrefix = "images/"
+
+func (i *ImageRepository) ListImageBlobs() ([]domain.BlobInfo, error) {
+	result := []domain.BlobInfo{}
+
+	ctx := context.Background()
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	objects := i.gcsClient.Bucket(bktName).Objects(ctx, &storage.Query{Prefix: imageBlobPrefix})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.ListImageBlobs] error when iterate objects with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, domain.BlobInfo{
+			Name:      attrs.Name,
+			Filename:  strings.TrimPrefix(attrs.Name, imageBlobPrefix),
+			Size:      attrs.Size,
+			CreatedAt: attrs.Created.UnixMilli(),
+		})
+	}
+	return result, nil
+}
+
+func (i *ImageRepository) ListImageFilenames() ([]string, error) {
+	result := []string{}
+
+	ctx := context.Background()
+	// soft-deleted images still own their blob until they are purged, images
+	// whose original was removed by retention do not own one anymore
+	for _, collection := range []string{"images", "deleted-images"} {
+		docs := i.firestoreClient.Collection(collection).Select("originalDeletedAt").Documents(ctx)
+		for {
+			doc, err := docs.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Printf("[ImageRepository.ListImageFilenames] error when iterate documents with error %v \n", err)
+				return nil, err
+			}
+			if deletedAt, ok := doc.Data()["originalDeletedAt"].(int64); ok && deletedAt > 0 {
+				continue
+			}
+			result = append(result, doc.Ref.ID)
+		}
+	}
+	return result, nil
+}
+
+// deleteImageBlobs removes the original and every variant stored under the
+// same name.
+func deleteImageBlobs(i *ImageRepository, ctx context.Context, filename string) error {
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	bucket := i.gcsClient.Bucket(bktName)
+	objects := bucket.Objects(ctx, &storage.Query{Prefix: imageBlobPrefix + filename})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = bucket.Object(attrs.Name).Delete(ctx)
+		if err != nil && err != storage.ErrObjectNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *ImageRepository) DeleteImageBlob(filename string) error {
+	ctx := context.Background()
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	err := i.gcsClient.Bucket(bktName).Object(imageBlobPrefix + filename).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteImageBlob] error when delete object with error %v \n", err)
+		return err
+	}
+	return nil
+}
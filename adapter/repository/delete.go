@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// moveImage copies the image document between the live and the trash
+// collection and removes the source in one transaction.
+func moveImage(i *ImageRepository, filename, from, to string, updates map[string]interface{}) error {
+	ctx := context.Background()
+	src := i.firestoreClient.Collection(from).Doc(filename)
+	dst := i.firestoreClient.Collection(to).Doc(filename)
+	return i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(src)
+		if status.Code(err) == codes.NotFound {
+			return domain.ErrImageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		data := doc.Data()
+		for key, value := range updates {
+			if value == nil {
+				delete(data, key)
+				continue
+			}
+			data[key] = value
+		}
+		if err = tx.Create(dst, data); err != nil {
+			return err
+		}
+		return tx.Delete(src)
+	})
+}
+
+func (i *ImageRepository) SoftDeleteImage(filename string, deletedAt, purgeAt int64) error {
+	err := moveImage(i, filename, "images", "deleted-images", map[string]interface{}{
+		"deletedAt": deletedAt,
+		"purgeAt":   purgeAt,
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.SoftDeleteImage] error when move image to trash with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) RestoreImage(filename string) error {
+	err := moveImage(i, filename, "deleted-images", "images", map[string]interface{}{
+		"deletedAt": nil,
+		"purgeAt":   nil,
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.RestoreImage] error when restore image from trash with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetDeletedImage(filename string) (*domain.Image, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("deleted-images").Doc(filename).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrImageNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetDeletedImage] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var data domain.Image
+	if err = doc.DataTo(&data); err != nil {
+		log.Printf("[ImageRepository.GetDeletedImage] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (i *ImageRepository) GetExpiredDeletedImages(before int64, limit int) ([]domain.Image, error) {
+	result := []domain.Image{}
+
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("deleted-images").
+		Where("purgeAt", "<=", before).
+		OrderBy("purgeAt", firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.GetExpiredDeletedImages] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var data domain.Image
+		if err = doc.DataTo(&data); err != nil {
+			log.Printf("[ImageRepository.GetExpiredDeletedImages] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+// DeleteImage permanently removes the image document, its trash entry, its
+// dispatch history in the outbox and every blob stored for it.
+func (i *ImageRepository) DeleteImage(filename string) error {
+	ctx := context.Background()
+	if err := deleteImageBlobs(i, ctx, filename); err != nil {
+		log.Printf("[ImageRepository.DeleteImage] error when delete blobs with error %v \n", err)
+		return err
+	}
+
+	batch := i.firestoreClient.Batch()
+	batch.Delete(i.firestoreClient.Collection("images").Doc(filename))
+	batch.Delete(i.firestoreClient.Collection("deleted-images").Doc(filename))
+	entries := i.firestoreClient.Collection("outbox").Where("filename", "==", filename).Select().Documents(ctx)
+	for {
+		doc, err := entries.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.DeleteImage] error when iterate outbox entries with error %v \n", err)
+			return err
+		}
+		batch.Delete(doc.Ref)
+	}
+
+	if _, err := batch.Commit(ctx); err != nil {
+		log.Printf("[ImageRepository.DeleteImage] error when delete documents with error %v \n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image-service/core/domain"
+	"log"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deviceDocID keeps provider tokens, which may contain characters Firestore
+// rejects in document IDs, out of the document path.
+func deviceDocID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (i *ImageRepository) SaveDeviceToken(device domain.DeviceToken) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("device-tokens").Doc(deviceDocID(device.Token)).Set(ctx, device)
+	if err != nil {
+		log.Printf("[ImageRepository.SaveDeviceToken] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetDeviceToken(token string) (*domain.DeviceToken, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("device-tokens").Doc(deviceDocID(token)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrDeviceNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetDeviceToken] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var device domain.DeviceToken
+	if err = doc.DataTo(&device); err != nil {
+		log.Printf("[ImageRepository.GetDeviceToken] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (i *ImageRepository) GetDeviceTokens(email string) ([]domain.DeviceToken, error) {
+	result := []domain.DeviceToken{}
+
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("device-tokens").Where("email", "==", email).Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.GetDeviceTokens] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var device domain.DeviceToken
+		if err = doc.DataTo(&device); err != nil {
+			log.Printf("[ImageRepository.GetDeviceTokens] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, device)
+	}
+	return result, nil
+}
+
+func (i *ImageRepository) DeleteDeviceToken(token string) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("device-tokens").Doc(deviceDocID(token)).Delete(ctx)
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteDeviceToken] error when delete document with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) DeleteUserDeviceTokens(email string) (int, error) {
+	ctx := context.Background()
+	deleted, err := deleteDocuments(i, ctx, i.firestoreClient.Collection("device-tokens").Where("email", "==", email))
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteUserDeviceTokens] error when delete documents with error %v \n", err)
+		return deleted, err
+	}
+	return deleted, nil
+}
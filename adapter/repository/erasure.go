@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetUserImageBatch returns up to limit images of the user, live images
+// first and then the ones in the trash.
+func (i *ImageRepository) GetUserImageBatch(email string, limit int) ([]domain.Image, error) {
+	result := []domain.Image{}
+
+	ctx := context.Background()
+	for _, collection := range []string{"images", "deleted-images"} {
+		docs := i.firestoreClient.Collection(collection).Where("email", "==", email).Limit(limit - len(result)).Documents(ctx)
+		for {
+			doc, err := docs.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Printf("[ImageRepository.GetUserImageBatch] error when iterate documents with error %v \n", err)
+				return nil, err
+			}
+
+			var data domain.Image
+			if err = doc.DataTo(&data); err != nil {
+				log.Printf("[ImageRepository.GetUserImageBatch] error when read document with error %v \n", err)
+				return nil, err
+			}
+			result = append(result, data)
+		}
+		if len(result) >= limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// AnonymizeImage removes the blobs of the image and replaces the owner, the
+// detection result itself is kept.
+func (i *ImageRepository) AnonymizeImage(filename, owner string) error {
+	ctx := context.Background()
+	if err := deleteImageBlobs(i, ctx, filename); err != nil {
+		log.Printf("[ImageRepository.AnonymizeImage] error when delete blobs with error %v \n", err)
+		return err
+	}
+	_, err := i.firestoreClient.Collection("images").Doc(filename).Update(ctx, []firestore.Update{
+		{
+			Path:  "email",
+			Value: owner,
+		},
+		{
+			Path:  "fileURL",
+			Value: "",
+		},
+		{
+			Path:  "blurHash",
+			Value: "",
+		},
+		{
+			Path:  "originalDeletedAt",
+			Value: time.Now().UnixMilli(),
+		},
+	})
+	if status.Code(err) == codes.NotFound {
+		return domain.ErrImageNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.AnonymizeImage] error when update image with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+// deleteBatchSize stays under the 500 writes allowed in one batch.
+const deleteBatchSize = 400
+
+// deleteDocuments removes every document the query matches, deleteBatchSize
+// at a time.
+func deleteDocuments(i *ImageRepository, ctx context.Context, q firestore.Query) (int, error) {
+	deleted := 0
+	for {
+		docs, err := q.Select().Limit(deleteBatchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return deleted, err
+		}
+		if len(docs) == 0 {
+			return deleted, nil
+		}
+		batch := i.firestoreClient.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+		if _, err = batch.Commit(ctx); err != nil {
+			return deleted, err
+		}
+		deleted += len(docs)
+	}
+}
+
+type erasedImageDocument struct {
+	Filename  string `firestore:"filename"`
+	RemovedAt int64  `firestore:"removedAt"`
+}
+
+// RecordErasedImages adds the filenames to the audit trail of the job.
+func (i *ImageRepository) RecordErasedImages(jobID string, filenames []string, removedAt int64) error {
+	if len(filenames) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	removed := i.firestoreClient.Collection("erasures").Doc(jobID).Collection("removed-images")
+	batch := i.firestoreClient.Batch()
+	for _, filename := range filenames {
+		batch.Set(removed.Doc(filename), erasedImageDocument{
+			Filename:  filename,
+			RemovedAt: removedAt,
+		})
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		log.Printf("[ImageRepository.RecordErasedImages] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) CreateErasureJob(job domain.ErasureJob) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("erasures").Doc(job.ID).Create(ctx, job)
+	if err != nil {
+		log.Printf("[ImageRepository.CreateErasureJob] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) UpdateErasureJob(job domain.ErasureJob) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("erasures").Doc(job.ID).Set(ctx, job)
+	if err != nil {
+		log.Printf("[ImageRepository.UpdateErasureJob] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetErasureJob(id string) (*domain.ErasureJob, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("erasures").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrErasureNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetErasureJob] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var job domain.ErasureJob
+	if err = doc.DataTo(&job); err != nil {
+		log.Printf("[ImageRepository.GetErasureJob] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (i *ImageRepository) GetPendingErasureJobs(limit int) ([]domain.ErasureJob, error) {
+	result := []domain.ErasureJob{}
+
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("erasures").
+		Where("status", "in", []domain.ErasureStatus{domain.ErasureStatusPending, domain.ErasureStatusRunning}).
+		OrderBy("requestedAt", firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.GetPendingErasureJobs] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var job domain.ErasureJob
+		if err = doc.DataTo(&job); err != nil {
+			log.Printf("[ImageRepository.GetPendingErasureJobs] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, job)
+	}
+	return result, nil
+}
@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"image-service/core/domain"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	pb "google.golang.org/genproto/googleapis/firestore/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func countQuery(q firestore.Query) (int64, error) {
+	ctx := context.Background()
+	res, err := q.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, ok := res["count"].(*pb.Value)
+	if !ok {
+		return 0, fmt.Errorf("unexpected count result %v", res["count"])
+	}
+	return count.GetIntegerValue(), nil
+}
+
+func (i *ImageRepository) CountUserImages(email string) (int64, error) {
+	var total int64
+	for _, collection := range []string{"images", "deleted-images"} {
+		count, err := countQuery(i.firestoreClient.Collection(collection).Where("email", "==", email))
+		if err != nil {
+			log.Printf("[ImageRepository.CountUserImages] error when count documents with error %v \n", err)
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// ForEachUserImage walks every image of the user, including the ones waiting
+// in the trash, without signing their URLs.
+func (i *ImageRepository) ForEachUserImage(email string, fn func(domain.Image) error) error {
+	ctx := context.Background()
+	for _, collection := range []string{"images", "deleted-images"} {
+		docs := i.firestoreClient.Collection(collection).Where("email", "==", email).Documents(ctx)
+		for {
+			doc, err := docs.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Printf("[ImageRepository.ForEachUserImage] error when iterate documents with error %v \n", err)
+				return err
+			}
+
+			var data domain.Image
+			if err = doc.DataTo(&data); err != nil {
+				log.Printf("[ImageRepository.ForEachUserImage] error when read document with error %v \n", err)
+				return err
+			}
+			data.Status = data.CurrentStatus()
+			if err = fn(data); err != nil {
+				docs.Stop()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i *ImageRepository) OpenImageBlob(filename string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	r, err := i.gcsClient.Bucket(bktName).Object(imageBlobPrefix + filename).NewReader(ctx)
+	if err != nil {
+		log.Printf("[ImageRepository.OpenImageBlob] error when open object with error %v \n", err)
+		return nil, err
+	}
+	return r, nil
+}
+
+func (i *ImageRepository) CreateExportJob(job domain.ExportJob, check func([]domain.ExportJob) error) error {
+	ctx := context.Background()
+	jobs := i.firestoreClient.Collection("exports")
+	err := i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(jobs.Where("email", "==", job.Email)).GetAll()
+		if err != nil {
+			return err
+		}
+		existing := make([]domain.ExportJob, 0, len(docs))
+		for _, doc := range docs {
+			var current domain.ExportJob
+			if err = doc.DataTo(&current); err != nil {
+				return err
+			}
+			existing = append(existing, current)
+		}
+		if err = check(existing); err != nil {
+			return err
+		}
+		return tx.Create(jobs.Doc(job.ID), job)
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.CreateExportJob] error when create export job with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) UpdateExportJob(job domain.ExportJob) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("exports").Doc(job.ID).Set(ctx, job)
+	if err != nil {
+		log.Printf("[ImageRepository.UpdateExportJob] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetExportJob(id string) (*domain.ExportJob, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("exports").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrExportNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetExportJob] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var job domain.ExportJob
+	if err = doc.DataTo(&job); err != nil {
+		log.Printf("[ImageRepository.GetExportJob] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (i *ImageRepository) NewExportArchiveWriter(ctx context.Context, id string) io.WriteCloser {
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	w := i.gcsClient.Bucket(bktName).Object(fmt.Sprintf("exports/%v.zip", id)).NewWriter(ctx)
+	w.ContentType = "application/zip"
+	return w
+}
+
+func (i *ImageRepository) GenerateExportURL(id string, expires time.Time) (string, error) {
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	gcsOpt := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: expires,
+	}
+	objectUrl, err := i.gcsClient.Bucket(bktName).SignedURL(fmt.Sprintf("exports/%v.zip", id), gcsOpt)
+	if err != nil {
+		log.Printf("[ImageRepository.GenerateExportURL] error when generate signed url with error %v \n", err)
+		return "", err
+	}
+	return objectUrl, nil
+}
+
+func (i *ImageRepository) ListUserExportJobs(email string) ([]domain.ExportJob, error) {
+	q := i.firestoreClient.Collection("exports").Where("email", "==", email)
+	return exportJobsFromQuery(q, "ListUserExportJobs")
+}
+
+func exportJobsFromQuery(q firestore.Query, caller string) ([]domain.ExportJob, error) {
+	result := []domain.ExportJob{}
+
+	ctx := context.Background()
+	docs := q.Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.%v] error when iterate documents with error %v \n", caller, err)
+			return nil, err
+		}
+
+		var job domain.ExportJob
+		if err = doc.DataTo(&job); err != nil {
+			log.Printf("[ImageRepository.%v] error when read document with error %v \n", caller, err)
+			return nil, err
+		}
+		result = append(result, job)
+	}
+	return result, nil
+}
+
+// GetStaleExportJobs returns unfinished jobs nobody updated since before,
+// e.g. because the replica running them was restarted.
+func (i *ImageRepository) GetStaleExportJobs(before int64, limit int) ([]domain.ExportJob, error) {
+	q := i.firestoreClient.Collection("exports").
+		Where("status", "in", []domain.ExportStatus{domain.ExportStatusPending, domain.ExportStatusRunning}).
+		Where("updatedAt", "<=", before).
+		OrderBy("updatedAt", firestore.Asc).
+		Limit(limit)
+	return exportJobsFromQuery(q, "GetStaleExportJobs")
+}
+
+// GetExpiredExportJobs returns completed or failed jobs that expired before
+// the given time.
+func (i *ImageRepository) GetExpiredExportJobs(before int64, limit int) ([]domain.ExportJob, error) {
+	q := i.firestoreClient.Collection("exports").
+		Where("status", "in", []domain.ExportStatus{domain.ExportStatusCompleted, domain.ExportStatusFailed}).
+		Where("expiresAt", "<=", before).
+		OrderBy("expiresAt", firestore.Asc).
+		Limit(limit)
+	return exportJobsFromQuery(q, "GetExpiredExportJobs")
+}
+
+func (i *ImageRepository) DeleteExportArchive(id string) error {
+	ctx := context.Background()
+	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
+	err := i.gcsClient.Bucket(bktName).Object(fmt.Sprintf("exports/%v.zip", id)).Delete(ctx)
+	if err != nil && err != storage.ErrObjectNotExist {
+		log.Printf("[ImageRepository.DeleteExportArchive] error when delete archive with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) DeleteExportJob(id string) error {
+	if err := i.DeleteExportArchive(id); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("exports").Doc(id).Delete(ctx)
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteExportJob] error when delete document with error %v \n", err)
+		return err
+	}
+	return nil
+}
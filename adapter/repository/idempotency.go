@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image-service/core/domain"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// idempotencyDocID scopes a key to its user, two users may pick the same key.
+func idempotencyDocID(email, key string) string {
+	sum := sha256.Sum256([]byte(email + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReserveIdempotencyKey stores record unless an unexpired record of the same
+// user and key exists, which is returned instead. A nil record means the
+// caller owns the key.
+func (i *ImageRepository) ReserveIdempotencyKey(record domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	ctx := context.Background()
+	ref := i.firestoreClient.Collection("idempotency-keys").Doc(idempotencyDocID(record.Email, record.Key))
+	var existing *domain.IdempotencyRecord
+	err := i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var current domain.IdempotencyRecord
+			if err = doc.DataTo(&current); err != nil {
+				return err
+			}
+			if current.ExpiresAt.After(time.Now()) {
+				existing = &current
+				return nil
+			}
+		}
+		return tx.Set(ref, record)
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.ReserveIdempotencyKey] error when reserve idempotency key with error %v \n", err)
+		return nil, storeError(err)
+	}
+	return existing, nil
+}
+
+func (i *ImageRepository) CompleteIdempotencyKey(email, key, response string, expiresAt time.Time) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("idempotency-keys").Doc(idempotencyDocID(email, key)).Update(ctx, []firestore.Update{
+		{Path: "status", Value: domain.IdempotencyStatusCompleted},
+		{Path: "response", Value: response},
+		{Path: "expiresAt", Value: expiresAt},
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.CompleteIdempotencyKey] error when update document with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) DeleteIdempotencyKey(email, key string) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("idempotency-keys").Doc(idempotencyDocID(email, key)).Delete(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		log.Printf("[ImageRepository.DeleteIdempotencyKey] error when delete document with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) DeleteUserIdempotencyKeys(email string) error {
+	ctx := context.Background()
+	if _, err := deleteDocuments(i, ctx, i.firestoreClient.Collection("idempotency-keys").Where("email", "==", email)); err != nil {
+		log.Printf("[ImageRepository.DeleteUserIdempotencyKeys] error when delete documents with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes up to limit records that expired
+// before the given time, for deployments without the TTL policy.
+func (i *ImageRepository) DeleteExpiredIdempotencyKeys(before time.Time, limit int) (int, error) {
+	ctx := context.Background()
+	docs, err := i.firestoreClient.Collection("idempotency-keys").
+		Where("expiresAt", "<=", before).
+		Select().
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteExpiredIdempotencyKeys] error when retrieve documents with error %v \n", err)
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	batch := i.firestoreClient.Batch()
+	for _, doc := range docs {
+		batch.Delete(doc.Ref)
+	}
+	if _, err = batch.Commit(ctx); err != nil {
+		log.Printf("[ImageRepository.DeleteExpiredIdempotencyKeys] error when delete documents with error %v \n", err)
+		return 0, err
+	}
+	return len(docs), nil
+}
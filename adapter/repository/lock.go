@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type lockDocument struct {
+	Owner     string `firestore:"owner"`
+	ExpiresAt int64  `firestore:"expiresAt"`
+}
+
+func (i *ImageRepository) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	ctx := context.Background()
+	ref := i.firestoreClient.Collection("locks").Doc(name)
+	acquired := false
+	err := i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		now := time.Now()
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var current lockDocument
+			if err = doc.DataTo(&current); err != nil {
+				return err
+			}
+			if current.Owner != owner && current.ExpiresAt > now.UnixMilli() {
+				return nil
+			}
+		}
+		acquired = true
+		return tx.Set(ref, lockDocument{
+			Owner:     owner,
+			ExpiresAt: now.Add(ttl).UnixMilli(),
+		})
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.AcquireLock] error when acquire lock %v with error %v \n", name, err)
+		return false, err
+	}
+	return acquired, nil
+}
+
+func (i *ImageRepository) ReleaseLock(name, owner string) error {
+	ctx := context.Background()
+	ref := i.firestoreClient.Collection("locks").Doc(name)
+	err := i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var current lockDocument
+		if err = doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Owner != owner {
+			return nil
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.ReleaseLock] error when release lock %v with error %v \n", name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateOutboxEntry records a dispatch and counts it on the image in the same
+// transaction, so every dispatch is charged even when the relay never moves
+// the image back to queued.
+func (i *ImageRepository) CreateOutboxEntry(entry domain.OutboxEntry) error {
+	ctx := context.Background()
+	imageRef := i.firestoreClient.Collection("images").Doc(entry.Filename)
+	entryRef := i.firestoreClient.Collection("outbox").Doc(entry.ID)
+	err := i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(entryRef, entry); err != nil {
+			return err
+		}
+		return tx.Update(imageRef, []firestore.Update{
+			{
+				Path:  "attempts",
+				Value: entry.Attempt,
+			},
+		})
+	})
+	switch status.Code(err) {
+	case codes.OK, codes.AlreadyExists:
+		return nil
+	case codes.NotFound:
+		return domain.ErrImageNotFound
+	}
+	log.Printf("[ImageRepository.CreateOutboxEntry] error write to firestore with error %v \n", err)
+	return err
+}
+
+// GetPendingOutboxEntries returns the unsent entries due before the given
+// time, entries backing off after a failure and dead letters are skipped.
+func (i *ImageRepository) GetPendingOutboxEntries(before int64, limit int) ([]domain.OutboxEntry, error) {
+	result := []domain.OutboxEntry{}
+
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("outbox").
+		Where("sentAt", "==", 0).
+		Where("deadLetteredAt", "==", 0).
+		Where("nextAttemptAt", "<=", before).
+		OrderBy("nextAttemptAt", firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.GetPendingOutboxEntries] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var entry domain.OutboxEntry
+		if err = doc.DataTo(&entry); err != nil {
+			log.Printf("[ImageRepository.GetPendingOutboxEntries] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func (i *ImageRepository) MarkOutboxEntrySent(id string, sentAt int64) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("outbox").Doc(id).Update(ctx, []firestore.Update{
+		{
+			Path:  "sentAt",
+			Value: sentAt,
+		},
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.MarkOutboxEntrySent] error when update outbox entry with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) RecordOutboxFailure(entry domain.OutboxEntry) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("outbox").Doc(entry.ID).Update(ctx, []firestore.Update{
+		{
+			Path:  "retries",
+			Value: entry.Retries,
+		},
+		{
+			Path:  "lastError",
+			Value: entry.LastError,
+		},
+		{
+			Path:  "nextAttemptAt",
+			Value: entry.NextAttemptAt,
+		},
+		{
+			Path:  "deadLetteredAt",
+			Value: entry.DeadLetteredAt,
+		},
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.RecordOutboxFailure] error when update outbox entry with error %v \n", err)
+		return err
+	}
+	return nil
+}
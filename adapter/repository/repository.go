@@ -10,6 +10,7 @@ import (
 	"log"
 	"mime/multipart"
 	"os"
+	"sort"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -17,8 +18,13 @@ import (
 	"github.com/google/uuid"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// firestoreInLimit is the maximum number of values in an "in" filter.
+const firestoreInLimit = 10
+
 type ImageRepository struct {
 	firestoreClient firestore.Client
 	gcsClient       storage.Client
@@ -38,6 +44,85 @@ func generateSignedURL(i *ImageRepository, filename string) (string, error) {
 	return objectUrl, nil
 }
 
+// storeError reports transient Firestore failures as unavailable so callers
+// can tell clients to retry.
+func storeError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return domain.ErrUnavailable.Wrap(err)
+	}
+	return err
+}
+
+func imageFromSnapshot(i *ImageRepository, doc *firestore.DocumentSnapshot) (*domain.Image, error) {
+	var data domain.Image
+	if err := doc.DataTo(&data); err != nil {
+		return nil, err
+	}
+	data.Status = data.CurrentStatus()
+	if data.OriginalDeletedAt > 0 {
+		// retention removed the blob, a signed URL would only return 404
+		data.FileURL = ""
+		return &data, nil
+	}
+	objectURL, err := generateSignedURL(i, data.Filename)
+	if err != nil {
+		return nil, err
+	}
+	data.FileURL = objectURL
+	return &data, nil
+}
+
+func statusUpdates(transition domain.StatusTransition) []firestore.Update {
+	updates := []firestore.Update{
+		{
+			Path:  "status",
+			Value: transition.To,
+		},
+		{
+			Path:  "statusUpdatedAt",
+			Value: transition.At,
+		},
+		{
+			Path:  "statusTimestamps." + string(transition.To),
+			Value: transition.At,
+		},
+	}
+	// a failure only describes the failed state, a result or a new dispatch
+	// supersedes it
+	if transition.To == domain.ImageStatusQueued || transition.To == domain.ImageStatusDetected {
+		updates = append(updates, firestore.Update{
+			Path:  "failure",
+			Value: firestore.Delete,
+		})
+	}
+	return updates
+}
+
+// runStatusTransition applies updates only if the document is still in
+// transition.From, so concurrent writers cannot skip a state.
+func runStatusTransition(i *ImageRepository, filename string, transition domain.StatusTransition, updates []firestore.Update) error {
+	ctx := context.Background()
+	ref := i.firestoreClient.Collection("images").Doc(filename)
+	return i.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return domain.ErrImageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var current domain.Image
+		if err = doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.CurrentStatus() != transition.From {
+			return domain.ErrInvalidStatusTransition
+		}
+		return tx.Update(ref, append(updates, statusUpdates(transition)...))
+	})
+}
+
 func NewImageRepository(ctx context.Context) (*ImageRepository, error) {
 	projectId := os.Getenv("CAPSTONE_PROJECT_ID")
 	if projectId == "" {
@@ -64,7 +149,7 @@ func NewImageRepository(ctx context.Context) (*ImageRepository, error) {
 	}, nil
 }
 
-func (i *ImageRepository) UploadImage(email string, file multipart.File) (*domain.UploadImageResponse, error) {
+func (i *ImageRepository) UploadImage(uploader domain.Uploader, file multipart.File) (*domain.UploadImageResponse, error) {
 	ctx := context.Background()
 	filename := uuid.New()
 	bktName := os.Getenv("CAPSTONE_IMAGE_BUCKET")
@@ -101,18 +186,33 @@ func (i *ImageRepository) UploadImage(email string, file multipart.File) (*domai
 		return nil, err
 	}
 
+	now := time.Now().UnixMilli()
 	data := domain.Image{
-		Email:     email,
-		Filename:  filename.String(),
-		CreatedAt: time.Now().UnixMilli(),
-		FileURL:   objectUrl,
+		Email:           uploader.Email,
+		Tier:            uploader.Tier,
+		Organization:    uploader.Organization,
+		Filename:        filename.String(),
+		CreatedAt:       now,
+		FileURL:         objectUrl,
+		Status:          domain.ImageStatusUploaded,
+		StatusUpdatedAt: now,
+		StatusTimestamps: map[string]int64{
+			string(domain.ImageStatusUploaded): now,
+		},
+		Attempts: 1,
 	}
 
-	_, err = i.firestoreClient.Collection("images").Doc(filename.String()).Create(ctx, data)
+	// the image and its first dispatch are written together so an image is
+	// never stored without a pending dispatch to the ML topic
+	entry := domain.NewOutboxEntry(data.Filename, 1, now)
+	batch := i.firestoreClient.Batch()
+	batch.Create(i.firestoreClient.Collection("images").Doc(data.Filename), data)
+	batch.Create(i.firestoreClient.Collection("outbox").Doc(entry.ID), entry)
+	_, err = batch.Commit(ctx)
 
 	if err != nil {
 		log.Printf("[ImageRepository.UploadImage] error write to firestore with error %v \n", err)
-		return nil, err
+		return nil, storeError(err)
 	}
 
 	resp := domain.UploadImageResponse{
@@ -123,63 +223,157 @@ func (i *ImageRepository) UploadImage(email string, file multipart.File) (*domai
 	return &resp, nil
 }
 
-func (i *ImageRepository) GetDetectionResults(email string, filter *domain.PageFilter) ([]domain.Image, error) {
-	result := []domain.Image{}
+// detectionQuery applies every filter except labels, ordering and cursor.
+func detectionQuery(i *ImageRepository, email string, filter *domain.PageFilter) firestore.Query {
+	q := i.firestoreClient.Collection("images").Where("email", "==", email)
 
-	ctx := context.Background()
-	q := i.firestoreClient.Collection("images").Where("email", "==", email).OrderBy("createdAt", firestore.Desc)
+	if filter.StartDate != 0 {
+		q = q.Where("createdAt", ">=", filter.StartDate)
+	}
 
-	if filter.StartDate != 0 && filter.EndDate != 0 {
-		q = q.Where("createdAt", ">=", filter.StartDate).Where("createdAt", "<=", filter.EndDate)
+	if filter.EndDate != 0 {
+		q = q.Where("createdAt", "<=", filter.EndDate)
 	}
 
-	if len(filter.Labels) > 0 {
-		filter.Labels = append(filter.Labels, "")
-		log.Println("execute label filter")
-		q = q.Where("label", "in", filter.Labels)
+	if filter.MinConfidence != nil {
+		q = q.Where("confidence", ">=", *filter.MinConfidence)
 	}
 
-	if filter.After != "" {
-		dsnap, err := i.firestoreClient.Collection("images").Doc(filter.After).Get(ctx)
-		if err != nil {
-			log.Printf("[ImageRepository.GetDetectionResults] error when retrieve dsnap with error %v \n", err)
-			return nil, err
+	if filter.MaxConfidence != nil {
+		q = q.Where("confidence", "<=", *filter.MaxConfidence)
+	}
+
+	if filter.ModelVersion != "" {
+		q = q.Where("modelVersion", "==", filter.ModelVersion)
+	}
+
+	if len(filter.Statuses) == 1 {
+		q = q.Where("status", "==", filter.Statuses[0])
+	}
+
+	if len(filter.Statuses) > 1 {
+		q = q.Where("status", "in", filter.Statuses)
+	}
+	return q
+}
+
+// labelFilterQueries splits a label filter into queries that each stay within
+// Firestore's limit for "in" values. Pending images have no label yet and get
+// a query of their own when requested. The queries never overlap.
+func labelFilterQueries(q firestore.Query, filter *domain.PageFilter) []firestore.Query {
+	if len(filter.Labels) == 0 {
+		return []firestore.Query{q}
+	}
+
+	queries := []firestore.Query{}
+	for start := 0; start < len(filter.Labels); start += firestoreInLimit {
+		end := start + firestoreInLimit
+		if end > len(filter.Labels) {
+			end = len(filter.Labels)
 		}
-		log.Printf("filename: %v \n", dsnap.Data()["filename"])
+		queries = append(queries, q.Where("label", "in", filter.Labels[start:end]))
+	}
+	if filter.IncludePending {
+		queries = append(queries, q.Where("status", "in", domain.PendingImageStatuses))
+	}
+	return queries
+}
 
-		q = q.StartAfter(dsnap.Data()["createdAt"])
+func sortValue(img domain.Image, sortBy domain.SortField) float64 {
+	switch sortBy {
+	case domain.SortByDetectedAt:
+		return float64(img.DetectedAt)
+	case domain.SortByConfidence:
+		return img.Confidence
 	}
+	return float64(img.CreatedAt)
+}
 
-	res := q.Limit(filter.PerPage).Documents(ctx)
-	for {
-		doc, err := res.Next()
-		if err == iterator.Done {
-			break
+// mergeImages orders the results of several queries the way a single query
+// would have and keeps the first limit images.
+func mergeImages(images []domain.Image, sortBy domain.SortField, direction firestore.Direction, limit int) []domain.Image {
+	sort.Slice(images, func(a, b int) bool {
+		if direction == firestore.Desc {
+			a, b = b, a
+		}
+		va, vb := sortValue(images[a], sortBy), sortValue(images[b], sortBy)
+		if va != vb {
+			return va < vb
 		}
+		return images[a].Filename < images[b].Filename
+	})
+	if len(images) > limit {
+		images = images[:limit]
+	}
+	return images
+}
+
+func (i *ImageRepository) CountDetectionResults(email string, filter *domain.PageFilter) (int64, error) {
+	var total int64
+	for _, q := range labelFilterQueries(detectionQuery(i, email, filter), filter) {
+		count, err := countQuery(q)
 		if err != nil {
-			return nil, err
+			log.Printf("[ImageRepository.CountDetectionResults] error when count documents with error %v \n", err)
+			return 0, storeError(err)
 		}
+		total += count
+	}
+	return total, nil
+}
 
-		filename := fmt.Sprint(doc.Data()["filename"])
-		objectURL, err := generateSignedURL(i, filename)
+func (i *ImageRepository) CountDetectionResultsByLabel(email string, filter *domain.PageFilter, labels []string) (map[string]int64, error) {
+	result := make(map[string]int64, len(labels))
+	q := detectionQuery(i, email, filter)
+	for _, label := range labels {
+		count, err := countQuery(q.Where("label", "==", label))
 		if err != nil {
-			log.Printf("[ImageRepository.GetDetectionResults] error when generate objectURL with error %v \n", err)
+			log.Printf("[ImageRepository.CountDetectionResultsByLabel] error when count documents with error %v \n", err)
 			return nil, err
 		}
+		result[label] = count
+	}
+	return result, nil
+}
 
-		data := domain.Image{
-			Email:         fmt.Sprint(doc.Data()["email"]),
-			Filename:      filename,
-			FileURL:       objectURL,
-			InferenceTime: doc.Data()["inferenceTime"].(int64),
-			CreatedAt:     doc.Data()["createdAt"].(int64),
-			DetectedAt:    doc.Data()["detectedAt"].(int64),
-			Confidence:    doc.Data()["confidence"].(float64),
-			IsDetected:    doc.Data()["isDetected"].(bool),
-			Label:         fmt.Sprint(doc.Data()["label"]),
-			BlurHash:      fmt.Sprint(doc.Data()["blurHash"]),
+func (i *ImageRepository) GetDetectionResults(email string, filter *domain.PageFilter) ([]domain.Image, error) {
+	result := []domain.Image{}
+
+	ctx := context.Background()
+	// paging backward walks the same order in reverse starting from the cursor
+	direction := firestore.Desc
+	if (filter.SortOrder == domain.SortAsc) != filter.Backward {
+		direction = firestore.Asc
+	}
+	queries := labelFilterQueries(detectionQuery(i, email, filter), filter)
+	for _, q := range queries {
+		q = q.OrderBy(string(filter.SortBy), direction).
+			OrderBy(firestore.DocumentID, direction)
+
+		if filter.Cursor != nil {
+			q = q.StartAfter(filter.Cursor.Value, filter.Cursor.Filename)
 		}
-		result = append(result, data)
+
+		res := q.Limit(filter.PerPage).Documents(ctx)
+		for {
+			doc, err := res.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Printf("[ImageRepository.GetDetectionResults] error when iterate documents with error %v \n", err)
+				return nil, storeError(err)
+			}
+
+			data, err := imageFromSnapshot(i, doc)
+			if err != nil {
+				log.Printf("[ImageRepository.GetDetectionResults] error when read document with error %v \n", err)
+				return nil, err
+			}
+			result = append(result, *data)
+		}
+	}
+	if len(queries) > 1 {
+		result = mergeImages(result, filter.SortBy, direction, filter.PerPage)
 	}
 	return result, nil
 }
@@ -201,9 +395,8 @@ func (i *ImageRepository) UpdateBlurHash(filename, hash string) error {
 	return nil
 }
 
-func (i *ImageRepository) UpdateImageResult(payload domain.UpdateImagePayloadData) error {
-	ctx := context.Background()
-	_, err := i.firestoreClient.Collection("images").Doc(payload.Filename).Update(ctx, []firestore.Update{
+func (i *ImageRepository) UpdateImageResult(payload domain.UpdateImagePayloadData, transition domain.StatusTransition) error {
+	err := runStatusTransition(i, payload.Filename, transition, []firestore.Update{
 		{
 			Path:  "inferenceTime",
 			Value: int64(payload.InferenceTime),
@@ -224,6 +417,10 @@ func (i *ImageRepository) UpdateImageResult(payload domain.UpdateImagePayloadDat
 			Path:  "confidence",
 			Value: float64(payload.Confidence),
 		},
+		{
+			Path:  "modelVersion",
+			Value: payload.ModelVersion,
+		},
 	})
 
 	if err != nil {
@@ -233,40 +430,170 @@ func (i *ImageRepository) UpdateImageResult(payload domain.UpdateImagePayloadDat
 	return nil
 }
 
-func (i *ImageRepository) GetSingleDetection(email, filename string) (*domain.Image, error) {
-	ctx := context.Background()
-	docs := i.firestoreClient.Collection("images").Where("email", "==", email).Where("filename", "==", filename).Documents(ctx)
+func (i *ImageRepository) UpdateImageStatus(filename string, transition domain.StatusTransition) error {
+	err := runStatusTransition(i, filename, transition, nil)
+	if err != nil {
+		log.Printf("[ImageRepository.UpdateImageStatus] error when update image status with error %v", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) UpdateImageFailure(filename string, failure domain.DetectionFailure, transition domain.StatusTransition) error {
+	err := runStatusTransition(i, filename, transition, []firestore.Update{
+		{
+			Path:  "failure",
+			Value: failure,
+		},
+	})
+	if err != nil {
+		log.Printf("[ImageRepository.UpdateImageFailure] error when update image failure with error %v", err)
+		return err
+	}
+	return nil
+}
 
-	var resp domain.Image
+func (i *ImageRepository) MarkImageDispatched(filename string, transition domain.StatusTransition) error {
+	// the attempt was counted when its outbox entry was created
+	err := runStatusTransition(i, filename, transition, nil)
+	if err != nil {
+		log.Printf("[ImageRepository.MarkImageDispatched] error when mark image dispatched with error %v", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetStaleImages(statuses []domain.ImageStatus, before int64, limit int) ([]domain.Image, error) {
+	result := []domain.Image{}
+
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("images").
+		Where("status", "in", statuses).
+		Where("statusUpdatedAt", "<=", before).
+		OrderBy("statusUpdatedAt", firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
 	for {
 		doc, err := docs.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
+			log.Printf("[ImageRepository.GetStaleImages] error when iterate documents with error %v \n", err)
 			return nil, err
 		}
 
-		filename := fmt.Sprint(doc.Data()["filename"])
-		objectURL, err := generateSignedURL(i, filename)
+		data, err := imageFromSnapshot(i, doc)
 		if err != nil {
-			log.Printf("[ImageRepository.GetSingleDetection] error when generate objectURL with error %v \n", err)
+			log.Printf("[ImageRepository.GetStaleImages] error when read document with error %v \n", err)
 			return nil, err
 		}
+		result = append(result, *data)
+	}
+	return result, nil
+}
+
+// ForEachImageWithoutStatus calls fn with every image written before the
+// status field existed. Firestore cannot query for a missing field, so the
+// whole collection is scanned.
+func (i *ImageRepository) ForEachImageWithoutStatus(fn func(domain.Image) error) error {
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("images").Documents(ctx)
+	defer docs.Stop()
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.ForEachImageWithoutStatus] error when iterate documents with error %v \n", err)
+			return err
+		}
+		if current, ok := doc.Data()["status"].(string); ok && current != "" {
+			continue
+		}
 
-		resp = domain.Image{
-			Email:         fmt.Sprint(doc.Data()["email"]),
-			Filename:      filename,
-			FileURL:       objectURL,
-			InferenceTime: doc.Data()["inferenceTime"].(int64),
-			CreatedAt:     doc.Data()["createdAt"].(int64),
-			DetectedAt:    doc.Data()["detectedAt"].(int64),
-			Confidence:    doc.Data()["confidence"].(float64),
-			IsDetected:    doc.Data()["isDetected"].(bool),
-			Label:         fmt.Sprint(doc.Data()["label"]),
-			BlurHash:      fmt.Sprint(doc.Data()["blurHash"]),
+		var data domain.Image
+		if err = doc.DataTo(&data); err != nil {
+			log.Printf("[ImageRepository.ForEachImageWithoutStatus] error when read document with error %v \n", err)
+			return err
+		}
+		if err = fn(data); err != nil {
+			return err
 		}
 	}
+}
 
-	return &resp, nil
+func (i *ImageRepository) GetImage(filename string) (*domain.Image, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("images").Doc(filename).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrImageNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetImage] error when retrieve document with error %v \n", err)
+		return nil, storeError(err)
+	}
+
+	data, err := imageFromSnapshot(i, doc)
+	if err != nil {
+		log.Printf("[ImageRepository.GetImage] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+func (i *ImageRepository) GetSingleDetection(email, filename string) (*domain.Image, error) {
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("images").Where("email", "==", email).Where("filename", "==", filename).Documents(ctx)
+
+	doc, err := docs.Next()
+	docs.Stop()
+	if err == iterator.Done {
+		return nil, domain.ErrImageNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetSingleDetection] error when retrieve document with error %v \n", err)
+		return nil, storeError(err)
+	}
+
+	data, err := imageFromSnapshot(i, doc)
+	if err != nil {
+		log.Printf("[ImageRepository.GetSingleDetection] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// ForEachDetection walks the user's images created since the given time and
+// only reads the fields needed for statistics.
+func (i *ImageRepository) ForEachDetection(email string, since int64, fn func(domain.Image) error) error {
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("images").
+		Where("email", "==", email).
+		Where("createdAt", ">=", since).
+		Select("filename", "label", "confidence", "createdAt", "status", "isDetected").
+		Documents(ctx)
+	defer docs.Stop()
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.ForEachDetection] error when iterate documents with error %v \n", err)
+			return err
+		}
+
+		var data domain.Image
+		if err = doc.DataTo(&data); err != nil {
+			log.Printf("[ImageRepository.ForEachDetection] error when read document with error %v \n", err)
+			return err
+		}
+		data.Status = data.CurrentStatus()
+		if err = fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
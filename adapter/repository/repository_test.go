@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"fmt"
+	"image-service/core/domain"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+)
+
+func filenames(images []domain.Image) string {
+	names := []string{}
+	for _, img := range images {
+		names = append(names, img.Filename)
+	}
+	return fmt.Sprint(names)
+}
+
+func TestMergeImages(t *testing.T) {
+	images := func() []domain.Image {
+		return []domain.Image{
+			{Filename: "b.jpg", CreatedAt: 2, Confidence: 0.9},
+			{Filename: "c.jpg", CreatedAt: 3, Confidence: 0.1},
+			{Filename: "a.jpg", CreatedAt: 2, Confidence: 0.5},
+			{Filename: "d.jpg", CreatedAt: 1, Confidence: 0.7},
+		}
+	}
+	for _, tt := range []struct {
+		sortBy    domain.SortField
+		direction firestore.Direction
+		limit     int
+		want      string
+	}{
+		// ties are broken by filename in the direction of the sort
+		{domain.SortByCreatedAt, firestore.Desc, 10, "[c.jpg b.jpg a.jpg d.jpg]"},
+		{domain.SortByCreatedAt, firestore.Asc, 10, "[d.jpg a.jpg b.jpg c.jpg]"},
+		{domain.SortByConfidence, firestore.Desc, 2, "[b.jpg d.jpg]"},
+		{domain.SortByConfidence, firestore.Asc, 3, "[c.jpg a.jpg d.jpg]"},
+	} {
+		if got := filenames(mergeImages(images(), tt.sortBy, tt.direction, tt.limit)); got != tt.want {
+			t.Errorf("mergeImages(%v %v, %v) = %v, want %v", tt.sortBy, tt.direction, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestLabelFilterQueries(t *testing.T) {
+	labels := make([]string, 2*firestoreInLimit+1)
+	for n := range labels {
+		labels[n] = fmt.Sprint("label-", n)
+	}
+	for _, tt := range []struct {
+		filter domain.PageFilter
+		want   int
+	}{
+		{domain.PageFilter{}, 1},
+		{domain.PageFilter{Labels: labels[:firestoreInLimit]}, 1},
+		{domain.PageFilter{Labels: labels}, 3},
+		{domain.PageFilter{Labels: labels[:1], IncludePending: true}, 2},
+	} {
+		if got := len(labelFilterQueries(firestore.Query{}, &tt.filter)); got != tt.want {
+			t.Errorf("%v labels, includePending %v: %v queries, want %v", len(tt.filter.Labels), tt.filter.IncludePending, got, tt.want)
+		}
+	}
+}
+
+func TestStatusUpdatesClearSupersededFailure(t *testing.T) {
+	for to, clears := range map[domain.ImageStatus]bool{
+		domain.ImageStatusQueued:     true,
+		domain.ImageStatusDetected:   true,
+		domain.ImageStatusProcessing: false,
+		domain.ImageStatusFailed:     false,
+	} {
+		cleared := false
+		for _, update := range statusUpdates(domain.StatusTransition{From: domain.ImageStatusFailed, To: to, At: 1}) {
+			if update.Path == "failure" && update.Value == firestore.Delete {
+				cleared = true
+			}
+		}
+		if cleared != clears {
+			t.Errorf("transition to %v clears the failure = %v, want %v", to, cleared, clears)
+		}
+	}
+}
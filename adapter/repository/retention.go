@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetRetentionBatch returns the images the rule has not visited yet that were
+// created before the cutoff, oldest first.
+func (i *ImageRepository) GetRetentionBatch(rule domain.RetentionRule, cutoff int64, cursor domain.RetentionCursor, limit int) ([]domain.Image, error) {
+	result := []domain.Image{}
+
+	ctx := context.Background()
+	q := i.firestoreClient.Collection("images").Where("createdAt", "<=", cutoff)
+	if rule.Tier != domain.RetentionAllTiers {
+		q = q.Where("tier", "==", rule.Tier)
+	}
+	q = q.OrderBy("createdAt", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc)
+	if cursor.Filename != "" {
+		q = q.StartAfter(cursor.CreatedAt, cursor.Filename)
+	}
+
+	docs := q.Limit(limit).Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.GetRetentionBatch] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var data domain.Image
+		if err = doc.DataTo(&data); err != nil {
+			log.Printf("[ImageRepository.GetRetentionBatch] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+func (i *ImageRepository) GetRetentionCursor(rule string) (*domain.RetentionCursor, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("retention-cursors").Doc(rule).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return &domain.RetentionCursor{}, nil
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetRetentionCursor] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var cursor domain.RetentionCursor
+	if err = doc.DataTo(&cursor); err != nil {
+		log.Printf("[ImageRepository.GetRetentionCursor] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (i *ImageRepository) SaveRetentionCursor(rule string, cursor domain.RetentionCursor) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("retention-cursors").Doc(rule).Set(ctx, cursor)
+	if err != nil {
+		log.Printf("[ImageRepository.SaveRetentionCursor] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteOriginalImage removes the uploaded original only, the detection
+// result and any derived variants stay.
+func (i *ImageRepository) DeleteOriginalImage(filename string, deletedAt int64) error {
+	if err := i.DeleteImageBlob(filename); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("images").Doc(filename).Update(ctx, []firestore.Update{
+		{
+			Path:  "originalDeletedAt",
+			Value: deletedAt,
+		},
+		{
+			Path:  "fileURL",
+			Value: "",
+		},
+	})
+	if status.Code(err) == codes.NotFound {
+		return domain.ErrImageNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteOriginalImage] error when update image with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) SaveRetentionSweep(sweep domain.RetentionSweep) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("retention-sweeps").Doc(sweep.ID).Set(ctx, sweep)
+	if err != nil {
+		log.Printf("[ImageRepository.SaveRetentionSweep] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetRetentionSweeps(limit int) ([]domain.RetentionSweep, error) {
+	result := []domain.RetentionSweep{}
+
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("retention-sweeps").OrderBy("startedAt", firestore.Desc).Limit(limit).Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.GetRetentionSweeps] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var sweep domain.RetentionSweep
+		if err = doc.DataTo(&sweep); err != nil {
+			log.Printf("[ImageRepository.GetRetentionSweeps] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, sweep)
+	}
+	return result, nil
+}
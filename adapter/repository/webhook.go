@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"image-service/core/domain"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (i *ImageRepository) CreateWebhook(webhook domain.Webhook) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("webhooks").Doc(webhook.ID).Create(ctx, webhook)
+	if err != nil {
+		log.Printf("[ImageRepository.CreateWebhook] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetWebhook(id string) (*domain.Webhook, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("webhooks").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrWebhookNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetWebhook] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var webhook domain.Webhook
+	if err = doc.DataTo(&webhook); err != nil {
+		log.Printf("[ImageRepository.GetWebhook] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func collectWebhooks(docs *firestore.DocumentIterator, result []domain.Webhook) ([]domain.Webhook, error) {
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.collectWebhooks] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var webhook domain.Webhook
+		if err = doc.DataTo(&webhook); err != nil {
+			log.Printf("[ImageRepository.collectWebhooks] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, webhook)
+	}
+	return result, nil
+}
+
+// ListWebhooks returns the webhooks registered by email and, when
+// organization is set, the ones registered for that organization.
+func (i *ImageRepository) ListWebhooks(email, organization string) ([]domain.Webhook, error) {
+	ctx := context.Background()
+	col := i.firestoreClient.Collection("webhooks")
+	result, err := collectWebhooks(col.Where("email", "==", email).Where("organization", "==", "").Documents(ctx), []domain.Webhook{})
+	if err != nil || organization == "" {
+		return result, err
+	}
+	return collectWebhooks(col.Where("organization", "==", organization).Documents(ctx), result)
+}
+
+func (i *ImageRepository) DeleteWebhook(id string) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("webhooks").Doc(id).Delete(ctx)
+	if err != nil {
+		log.Printf("[ImageRepository.DeleteWebhook] error when delete document with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) CreateWebhookDelivery(delivery domain.WebhookDelivery) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("webhook-deliveries").Doc(delivery.ID).Create(ctx, delivery)
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.CreateWebhookDelivery] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) UpdateWebhookDelivery(delivery domain.WebhookDelivery) error {
+	ctx := context.Background()
+	_, err := i.firestoreClient.Collection("webhook-deliveries").Doc(delivery.ID).Set(ctx, delivery)
+	if err != nil {
+		log.Printf("[ImageRepository.UpdateWebhookDelivery] error write to firestore with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func (i *ImageRepository) GetWebhookDelivery(id string) (*domain.WebhookDelivery, error) {
+	ctx := context.Background()
+	doc, err := i.firestoreClient.Collection("webhook-deliveries").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, domain.ErrDeliveryNotFound
+	}
+	if err != nil {
+		log.Printf("[ImageRepository.GetWebhookDelivery] error when retrieve document with error %v \n", err)
+		return nil, err
+	}
+
+	var delivery domain.WebhookDelivery
+	if err = doc.DataTo(&delivery); err != nil {
+		log.Printf("[ImageRepository.GetWebhookDelivery] error when read document with error %v \n", err)
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func collectWebhookDeliveries(docs *firestore.DocumentIterator) ([]domain.WebhookDelivery, error) {
+	result := []domain.WebhookDelivery{}
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageRepository.collectWebhookDeliveries] error when iterate documents with error %v \n", err)
+			return nil, err
+		}
+
+		var delivery domain.WebhookDelivery
+		if err = doc.DataTo(&delivery); err != nil {
+			log.Printf("[ImageRepository.collectWebhookDeliveries] error when read document with error %v \n", err)
+			return nil, err
+		}
+		result = append(result, delivery)
+	}
+	return result, nil
+}
+
+func (i *ImageRepository) GetDueWebhookDeliveries(before int64, limit int) ([]domain.WebhookDelivery, error) {
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("webhook-deliveries").
+		Where("status", "==", domain.WebhookDeliveryPending).
+		Where("nextAttemptAt", "<=", before).
+		OrderBy("nextAttemptAt", firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
+	return collectWebhookDeliveries(docs)
+}
+
+func (i *ImageRepository) ListWebhookDeliveries(webhookID string, limit int) ([]domain.WebhookDelivery, error) {
+	ctx := context.Background()
+	docs := i.firestoreClient.Collection("webhook-deliveries").
+		Where("webhookId", "==", webhookID).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	return collectWebhookDeliveries(docs)
+}
+
+// DeleteUserWebhooks removes the personal webhooks registered by email
+// together with their deliveries, and every delivery carrying an event of
+// email's images. Organization webhooks stay, other members rely on them.
+func (i *ImageRepository) DeleteUserWebhooks(email string) (int, error) {
+	ctx := context.Background()
+	q := i.firestoreClient.Collection("webhooks").Where("email", "==", email).Where("organization", "==", "")
+	webhooks, err := collectWebhooks(q.Documents(ctx), []domain.Webhook{})
+	if err != nil {
+		return 0, err
+	}
+	deliveries := i.firestoreClient.Collection("webhook-deliveries")
+	for _, webhook := range webhooks {
+		if _, err = deleteDocuments(i, ctx, deliveries.Where("webhookId", "==", webhook.ID)); err != nil {
+			log.Printf("[ImageRepository.DeleteUserWebhooks] error when delete deliveries of %v with error %v \n", webhook.ID, err)
+			return 0, err
+		}
+		if _, err = i.firestoreClient.Collection("webhooks").Doc(webhook.ID).Delete(ctx); err != nil {
+			log.Printf("[ImageRepository.DeleteUserWebhooks] error when delete webhook %v with error %v \n", webhook.ID, err)
+			return 0, err
+		}
+	}
+	if _, err = deleteDocuments(i, ctx, deliveries.Where("email", "==", email)); err != nil {
+		log.Printf("[ImageRepository.DeleteUserWebhooks] error when delete deliveries with error %v \n", err)
+		return 0, err
+	}
+	return len(webhooks), nil
+}
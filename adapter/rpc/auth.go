@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"context"
+	"image-service/adapter/auth"
+	"image-service/adapter/rpc/pb"
+	"image-service/core/domain"
+	"log"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type authKind int
+
+const (
+	authUser authKind = iota
+	authInternal
+	authNone
+)
+
+// methodAuth decides how each method is authenticated, methods missing from
+// the table are rejected so a new method can't be served without a check.
+var methodAuth = map[string]authKind{
+	pb.ImageDetectionService_UploadImage_FullMethodName:    authUser,
+	pb.ImageDetectionService_ListDetections_FullMethodName: authUser,
+	pb.ImageDetectionService_GetDetection_FullMethodName:   authUser,
+	pb.ImageDetectionService_SubmitResult_FullMethodName:   authInternal,
+	"/grpc.health.v1.Health/Check":                         authNone,
+	"/grpc.health.v1.Health/Watch":                         authNone,
+}
+
+type claimKey struct{}
+
+// claimFromContext returns the JWT claims of a user method, set by the auth
+// interceptors.
+func claimFromContext(ctx context.Context) jwt.MapClaims {
+	claim, _ := ctx.Value(claimKey{}).(jwt.MapClaims)
+	return claim
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if strings.HasPrefix(value, "Bearer ") {
+			return strings.TrimPrefix(value, "Bearer ")
+		}
+	}
+	return ""
+}
+
+func authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	kind, ok := methodAuth[fullMethod]
+	if !ok {
+		log.Printf("[rpc.authenticate] no auth rule for method %v \n", fullMethod)
+		return nil, status.Error(codes.PermissionDenied, "method is not available")
+	}
+
+	switch kind {
+	case authUser:
+		token := bearerToken(ctx)
+		if token == "" {
+			return nil, errorStatus(domain.ErrUnauthorized.Errorf("missing bearer token"))
+		}
+		claim, err := auth.ParseToken(token)
+		if err != nil {
+			return nil, errorStatus(err)
+		}
+		return context.WithValue(ctx, claimKey{}, claim), nil
+	case authInternal:
+		if err := auth.VerifyStaticToken(bearerToken(ctx), auth.INTERNAL_API_TOKEN); err != nil {
+			return nil, errorStatus(err)
+		}
+	}
+	return ctx, nil
+}
+
+func unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
+
+// authStream replaces the context of a stream with the authenticated one.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamAuthInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+	ctx, err := authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return next(srv, &authStream{ServerStream: stream, ctx: ctx})
+}
+
+var errorKindCodes = map[domain.ErrorKind]codes.Code{
+	domain.ErrorKindNotFound:     codes.NotFound,
+	domain.ErrorKindUnauthorized: codes.Unauthenticated,
+	domain.ErrorKindForbidden:    codes.PermissionDenied,
+	domain.ErrorKindValidation:   codes.InvalidArgument,
+	domain.ErrorKindConflict:     codes.FailedPrecondition,
+	domain.ErrorKindUnavailable:  codes.Unavailable,
+	domain.ErrorKindRateLimited:  codes.ResourceExhausted,
+}
+
+// errorStatus converts a service error to a gRPC status. Like the HTTP
+// problems, internal errors don't leak their details.
+func errorStatus(err error) error {
+	if e := domain.AsError(err); e != nil {
+		code, ok := errorKindCodes[e.Kind]
+		if !ok {
+			code = codes.Unknown
+		}
+		if e.Err != nil {
+			log.Printf("[rpc.errorStatus] error with cause %v \n", err)
+		}
+		return status.Error(code, e.Code+": "+e.Message)
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorStatus(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err     error
+		code    codes.Code
+		message string
+	}{
+		"not found": {
+			err:     domain.ErrImageNotFound,
+			code:    codes.NotFound,
+			message: "image_not_found: image not found",
+		},
+		"rate limited": {
+			err:     domain.ErrExportRateLimited,
+			code:    codes.ResourceExhausted,
+			message: "export_rate_limited: too many exports, try again later",
+		},
+		"wrapped cause": {
+			err:     domain.ErrUnavailable.Wrap(errors.New("dial tcp 10.0.0.3:443: connection refused")),
+			code:    codes.Unavailable,
+			message: "unavailable: service is temporarily unavailable",
+		},
+		"internal": {
+			err:     errors.New("firestore: projects/internal"),
+			code:    codes.Internal,
+			message: "internal error",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			st := status.Convert(errorStatus(tc.err))
+			if st.Code() != tc.code || st.Message() != tc.message {
+				t.Fatalf("status = %v %q, want %v %q", st.Code(), st.Message(), tc.code, tc.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image-service/adapter/auth"
+	"image-service/adapter/rpc/pb"
+	"image-service/core/domain"
+	"image-service/core/port"
+	"image-service/core/util"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	DefaultGrpcPort = 9090
+
+	// maxUploadSize matches the body limit of the HTTP upload.
+	maxUploadSize = 20 * 1024 * 1024
+
+	// shutdownTimeout bounds how long open calls may take to finish once
+	// the server is asked to stop, streams still open after it are cut.
+	shutdownTimeout = 10 * time.Second
+)
+
+type ImageGrpcServer struct {
+	pb.UnimplementedImageDetectionServiceServer
+	imageService port.ImageService
+}
+
+func NewImageGrpcServer(imageService port.ImageService) *ImageGrpcServer {
+	return &ImageGrpcServer{
+		imageService: imageService,
+	}
+}
+
+// uploadFile serves the received chunks as the multipart.File the service
+// expects.
+type uploadFile struct {
+	*bytes.Reader
+}
+
+func (uploadFile) Close() error {
+	return nil
+}
+
+func (i *ImageGrpcServer) UploadImage(stream pb.ImageDetectionService_UploadImageServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := first.GetMetadata()
+	if meta == nil {
+		return errorStatus(domain.ErrInvalidRequest.Errorf("the first message must carry the metadata"))
+	}
+	if meta.ContentType != "image/jpg" && meta.ContentType != "image/jpeg" {
+		return errorStatus(domain.ErrInvalidRequest.Errorf("content type must be image/jpg or image/jpeg"))
+	}
+
+	var image bytes.Buffer
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("[ImageGrpcServer.UploadImage] error when receive chunk with error %v \n", err)
+			return err
+		}
+		if image.Len()+len(req.GetChunk()) > maxUploadSize {
+			return errorStatus(domain.ErrInvalidRequest.Errorf("image must not be larger than %v bytes", maxUploadSize))
+		}
+		image.Write(req.GetChunk())
+	}
+	if image.Len() == 0 {
+		return errorStatus(domain.ErrInvalidRequest.Errorf("image should be filled"))
+	}
+
+	uploader := auth.UploaderFromClaim(claimFromContext(stream.Context()))
+	file := uploadFile{bytes.NewReader(image.Bytes())}
+	var res *domain.UploadImageResponse
+	if key := idempotencyKey(stream.Context()); key != "" {
+		res, _, err = i.imageService.UploadImageWithKey(uploader, key, file)
+	} else {
+		res, err = i.imageService.UploadImage(uploader, file)
+	}
+	if err != nil {
+		log.Printf("[ImageGrpcServer.UploadImage] error when uploading image with error %v \n", err)
+		return errorStatus(err)
+	}
+
+	log.Printf("[ImageGrpcServer.UploadImage] success upload image to database from payload: %v \n", res)
+	return stream.SendAndClose(&pb.UploadImageResponse{
+		Filename: res.Filename,
+		FileUrl:  res.FileURL,
+	})
+}
+
+// idempotencyKey reads the gRPC counterpart of the Idempotency-Key header.
+func idempotencyKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("idempotency-key"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func pageFilterFromRequest(req *pb.ListDetectionsRequest) (domain.PageFilter, error) {
+	filter := domain.PageFilter{
+		PerPage:         int(req.PerPage),
+		StartDate:       int(req.StartDate),
+		EndDate:         int(req.EndDate),
+		Labels:          req.Labels,
+		After:           req.After,
+		Before:          req.Before,
+		MinConfidence:   req.MinConfidence,
+		MaxConfidence:   req.MaxConfidence,
+		ModelVersion:    req.ModelVersion,
+		SortBy:          domain.SortField(req.Sort),
+		SortOrder:       domain.SortOrder(req.Order),
+		IncludePending:  req.IncludePending,
+		WithTotal:       req.WithTotal,
+		WithLabelCounts: req.WithLabelCounts,
+	}
+	for _, raw := range req.Statuses {
+		if raw == "pending" {
+			filter.Statuses = append(filter.Statuses, domain.PendingImageStatuses...)
+			continue
+		}
+		filter.Statuses = append(filter.Statuses, domain.ImageStatus(raw))
+	}
+	err := util.ValidatePageFilter(&filter)
+	return filter, err
+}
+
+func (i *ImageGrpcServer) ListDetections(ctx context.Context, req *pb.ListDetectionsRequest) (*pb.ListDetectionsResponse, error) {
+	filter, err := pageFilterFromRequest(req)
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+
+	email := fmt.Sprint(claimFromContext(ctx)["email"])
+	page, err := i.imageService.GetDetectionResults(email, &filter)
+	if err != nil {
+		log.Printf("[ImageGrpcServer.ListDetections] error when retrieve documents with error %v \n", err)
+		return nil, errorStatus(err)
+	}
+
+	res := &pb.ListDetectionsResponse{
+		Items:       make([]*pb.Image, 0, len(page.Items)),
+		NextCursor:  page.NextCursor,
+		PrevCursor:  page.PrevCursor,
+		HasMore:     page.HasMore,
+		PerPage:     int32(page.PerPage),
+		Total:       page.Total,
+		LabelCounts: page.LabelCounts,
+		HasNext:     page.HasNext,
+		HasPrevious: page.HasPrevious,
+	}
+	for _, img := range page.Items {
+		res.Items = append(res.Items, imageMessage(img))
+	}
+	return res, nil
+}
+
+func (i *ImageGrpcServer) GetDetection(ctx context.Context, req *pb.GetDetectionRequest) (*pb.Image, error) {
+	if req.Filename == "" {
+		return nil, errorStatus(domain.ErrInvalidRequest.Errorf("filename should be filled"))
+	}
+
+	email := fmt.Sprint(claimFromContext(ctx)["email"])
+	res, err := i.imageService.GetSingleDetection(email, req.Filename)
+	if err != nil {
+		log.Printf("[ImageGrpcServer.GetDetection] error when retrieve data from database with error %v \n", err)
+		return nil, errorStatus(err)
+	}
+	return imageMessage(*res), nil
+}
+
+func (i *ImageGrpcServer) SubmitResult(ctx context.Context, req *pb.SubmitResultRequest) (*pb.SubmitResultResponse, error) {
+	switch {
+	case req.Filename == "":
+		return nil, errorStatus(domain.ErrInvalidRequest.Errorf("filename should be filled"))
+	case strings.TrimSpace(req.Label) == "":
+		return nil, errorStatus(domain.ErrInvalidRequest.Errorf("label should be filled"))
+	case req.InferenceTime == 0:
+		return nil, errorStatus(domain.ErrInvalidRequest.Errorf("inferenceTime should be filled"))
+	case req.DetectedAt == 0:
+		return nil, errorStatus(domain.ErrInvalidRequest.Errorf("detectedAt should be filled"))
+	case req.Confidence == 0:
+		return nil, errorStatus(domain.ErrInvalidRequest.Errorf("confidence should be filled"))
+	}
+
+	payload := domain.UpdateImagePayloadData{
+		Filename:      req.Filename,
+		Label:         req.Label,
+		InferenceTime: float32(req.InferenceTime),
+		DetectedAt:    float32(req.DetectedAt),
+		Confidence:    req.Confidence,
+		ModelVersion:  req.ModelVersion,
+	}
+	if err := i.imageService.UpdateImageResult(payload); err != nil {
+		log.Printf("[ImageGrpcServer.SubmitResult] error when update detection with error %v \n", err)
+		return nil, errorStatus(err)
+	}
+
+	log.Printf("[ImageGrpcServer.SubmitResult] success upload detection data from payload: %v \n", payload)
+	return &pb.SubmitResultResponse{}, nil
+}
+
+func imageMessage(img domain.Image) *pb.Image {
+	msg := &pb.Image{
+		Email:             img.Email,
+		Filename:          img.Filename,
+		Label:             img.Label,
+		InferenceTime:     img.InferenceTime,
+		CreatedAt:         img.CreatedAt,
+		DetectedAt:        img.DetectedAt,
+		Confidence:        img.Confidence,
+		FileUrl:           img.FileURL,
+		BlurHash:          img.BlurHash,
+		IsDetected:        img.IsDetected,
+		Status:            string(img.Status),
+		StatusUpdatedAt:   img.StatusUpdatedAt,
+		StatusTimestamps:  img.StatusTimestamps,
+		Attempts:          int32(img.Attempts),
+		DeletedAt:         img.DeletedAt,
+		PurgeAt:           img.PurgeAt,
+		Tier:              img.Tier,
+		OriginalDeletedAt: img.OriginalDeletedAt,
+		ModelVersion:      img.ModelVersion,
+		Organization:      img.Organization,
+	}
+	if img.Failure != nil {
+		msg.Failure = &pb.DetectionFailure{
+			Code:      img.Failure.Code,
+			Message:   img.Failure.Message,
+			Retryable: img.Failure.Retryable,
+			FailedAt:  img.Failure.FailedAt,
+		}
+	}
+	return msg
+}
+
+// newGrpcServer registers the API and the standard health service behind
+// the auth interceptors.
+func newGrpcServer(imageService port.ImageService) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryAuthInterceptor),
+		grpc.ChainStreamInterceptor(streamAuthInterceptor),
+	)
+	pb.RegisterImageDetectionServiceServer(server, NewImageGrpcServer(imageService))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.ImageDetectionService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	return server
+}
+
+// InitGrpcServer serves the gRPC API on GRPC_PORT, next to the HTTP server,
+// until ctx is cancelled and returns once the open calls finished.
+func InitGrpcServer(ctx context.Context, imageService port.ImageService) {
+	port := util.GetEnvInt("GRPC_PORT", DefaultGrpcPort)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Printf("error listening to port %v with error %v \n", port, err)
+		return
+	}
+
+	server := newGrpcServer(imageService)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		timer := time.AfterFunc(shutdownTimeout, server.Stop)
+		defer timer.Stop()
+		server.GracefulStop()
+	}()
+
+	log.Printf("serving grpc at port %v \n", port)
+	if err = server.Serve(listener); err != nil {
+		log.Printf("error serving grpc at port %v with error %v \n", port, err)
+		return
+	}
+	<-stopped
+}
@@ -0,0 +1,333 @@
+package rpc
+
+import (
+	"context"
+	"image-service/adapter/auth"
+	"image-service/adapter/rpc/pb"
+	"image-service/core/domain"
+	"image-service/core/port"
+	"io"
+	"mime/multipart"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestMain(m *testing.M) {
+	auth.JWT_SIGNATURE_KEY = []byte("test-signature-key")
+	auth.INTERNAL_API_TOKEN = []byte("test-internal-token")
+	os.Exit(m.Run())
+}
+
+// fakeImageService serves images from memory. Methods a test doesn't set up
+// panic through the nil embedded interface.
+type fakeImageService struct {
+	port.ImageService
+
+	mu       sync.Mutex
+	images   map[string]domain.Image
+	uploads  []string
+	keys     []string
+	results  []domain.UpdateImagePayloadData
+	lastPage domain.PageFilter
+}
+
+func newFakeImageService(images ...domain.Image) *fakeImageService {
+	f := &fakeImageService{images: map[string]domain.Image{}}
+	for _, img := range images {
+		f.images[img.Filename] = img
+	}
+	return f
+}
+
+func (f *fakeImageService) upload(uploader domain.Uploader, file multipart.File) (*domain.UploadImageResponse, error) {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	f.uploads = append(f.uploads, string(body))
+	return &domain.UploadImageResponse{
+		Filename: uploader.Email + ".jpg",
+		FileURL:  "https://storage.test/" + uploader.Email + ".jpg",
+	}, nil
+}
+
+func (f *fakeImageService) UploadImage(uploader domain.Uploader, file multipart.File) (*domain.UploadImageResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.upload(uploader, file)
+}
+
+func (f *fakeImageService) UploadImageWithKey(uploader domain.Uploader, key string, file multipart.File) (*domain.UploadImageResponse, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, key)
+	res, err := f.upload(uploader, file)
+	return res, false, err
+}
+
+func (f *fakeImageService) GetDetectionResults(email string, filter *domain.PageFilter) (*domain.ImagePage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastPage = *filter
+	page := &domain.ImagePage{PerPage: filter.PerPage}
+	for _, img := range f.images {
+		if img.Email == email {
+			page.Items = append(page.Items, img)
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeImageService) GetSingleDetection(email, filename string) (*domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.images[filename]
+	if !ok || img.Email != email {
+		return nil, domain.ErrImageNotFound
+	}
+	return &img, nil
+}
+
+func (f *fakeImageService) UpdateImageResult(payload domain.UpdateImagePayloadData) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, payload)
+	return nil
+}
+
+// newTestClient serves the gRPC API of service over an in-memory listener.
+func newTestClient(t *testing.T, service port.ImageService) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := newGrpcServer(service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func newTestToken(t *testing.T, email string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+	}).SignedString(auth.JWT_SIGNATURE_KEY)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func withToken(token string) context.Context {
+	ctx := context.Background()
+	if token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	service := newFakeImageService(domain.Image{Email: "a@test.com", Filename: "a.jpg"})
+	client := pb.NewImageDetectionServiceClient(newTestClient(t, service))
+	userToken := newTestToken(t, "a@test.com")
+	result := &pb.SubmitResultRequest{
+		Filename:      "a.jpg",
+		Label:         "cat",
+		Confidence:    0.9,
+		DetectedAt:    1,
+		InferenceTime: 1,
+	}
+
+	for name, tc := range map[string]struct {
+		call func() error
+		code codes.Code
+	}{
+		"user method without token": {
+			call: func() error {
+				_, err := client.GetDetection(withToken(""), &pb.GetDetectionRequest{Filename: "a.jpg"})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		"user method with forged token": {
+			call: func() error {
+				_, err := client.GetDetection(withToken("not-a-jwt"), &pb.GetDetectionRequest{Filename: "a.jpg"})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		"user method with user token": {
+			call: func() error {
+				_, err := client.GetDetection(withToken(userToken), &pb.GetDetectionRequest{Filename: "a.jpg"})
+				return err
+			},
+			code: codes.OK,
+		},
+		"internal method with user token": {
+			call: func() error {
+				_, err := client.SubmitResult(withToken(userToken), result)
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		"internal method with internal token": {
+			call: func() error {
+				_, err := client.SubmitResult(withToken("test-internal-token"), result)
+				return err
+			},
+			code: codes.OK,
+		},
+		"streaming method without token": {
+			call: func() error {
+				stream, err := client.UploadImage(withToken(""))
+				if err != nil {
+					return err
+				}
+				_, err = stream.CloseAndRecv()
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		"health check without token": {
+			call: func() error {
+				_, err := healthpb.NewHealthClient(newTestClient(t, service)).Check(withToken(""), &healthpb.HealthCheckRequest{})
+				return err
+			},
+			code: codes.OK,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if code := status.Code(tc.call()); code != tc.code {
+				t.Fatalf("code = %v, want %v", code, tc.code)
+			}
+		})
+	}
+
+	if len(service.results) != 1 {
+		t.Fatalf("stored %v results, want only the internal one", len(service.results))
+	}
+}
+
+func TestUploadImage(t *testing.T) {
+	service := newFakeImageService()
+	client := pb.NewImageDetectionServiceClient(newTestClient(t, service))
+	ctx := metadata.AppendToOutgoingContext(withToken(newTestToken(t, "a@test.com")), "idempotency-key", "upload-1")
+
+	stream, err := client.UploadImage(ctx)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	requests := []*pb.UploadImageRequest{
+		{Data: &pb.UploadImageRequest_Metadata{Metadata: &pb.UploadImageMetadata{ContentType: "image/jpeg"}}},
+		{Data: &pb.UploadImageRequest_Chunk{Chunk: []byte("first-")}},
+		{Data: &pb.UploadImageRequest_Chunk{Chunk: []byte("second")}},
+	}
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if res.Filename != "a@test.com.jpg" {
+		t.Fatalf("filename = %q, want the uploader's image", res.Filename)
+	}
+	if len(service.uploads) != 1 || service.uploads[0] != "first-second" {
+		t.Fatalf("uploads = %q, want the joined chunks", service.uploads)
+	}
+	if len(service.keys) != 1 || service.keys[0] != "upload-1" {
+		t.Fatalf("keys = %q, want the idempotency key", service.keys)
+	}
+}
+
+func TestUploadImageRejectsMissingMetadata(t *testing.T) {
+	client := pb.NewImageDetectionServiceClient(newTestClient(t, newFakeImageService()))
+
+	stream, err := client.UploadImage(withToken(newTestToken(t, "a@test.com")))
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if err := stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_Chunk{Chunk: []byte("jpeg")}}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("err = %v, want InvalidArgument", err)
+	}
+}
+
+func TestListDetections(t *testing.T) {
+	service := newFakeImageService(
+		domain.Image{Email: "a@test.com", Filename: "a.jpg", Label: "cat"},
+		domain.Image{Email: "b@test.com", Filename: "b.jpg", Label: "dog"},
+	)
+	client := pb.NewImageDetectionServiceClient(newTestClient(t, service))
+
+	res, err := client.ListDetections(withToken(newTestToken(t, "a@test.com")), &pb.ListDetectionsRequest{
+		PerPage:  5,
+		Statuses: []string{"pending"},
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(res.Items) != 1 || res.Items[0].Filename != "a.jpg" {
+		t.Fatalf("items = %v, want only the caller's image", res.Items)
+	}
+	if res.PerPage != 5 {
+		t.Fatalf("perPage = %v, want 5", res.PerPage)
+	}
+	if len(service.lastPage.Statuses) != len(domain.PendingImageStatuses) {
+		t.Fatalf("statuses = %v, want the pending statuses", service.lastPage.Statuses)
+	}
+}
+
+func TestGetDetectionOfAnotherUser(t *testing.T) {
+	service := newFakeImageService(domain.Image{Email: "b@test.com", Filename: "b.jpg"})
+	client := pb.NewImageDetectionServiceClient(newTestClient(t, service))
+
+	_, err := client.GetDetection(withToken(newTestToken(t, "a@test.com")), &pb.GetDetectionRequest{Filename: "b.jpg"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("err = %v, want NotFound", err)
+	}
+}
+
+func TestInitGrpcServerStopsWithContext(t *testing.T) {
+	t.Setenv("GRPC_PORT", "0")
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		InitGrpcServer(ctx, newFakeImageService())
+	}()
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after the context was cancelled")
+	}
+}
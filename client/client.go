@@ -0,0 +1,346 @@
+// Package client calls the image API over HTTP. Errors reported by the API
+// are returned as *Error, which unwraps to the matching domain error so
+// callers can use errors.Is with the sentinels in core/domain.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 500 * time.Millisecond
+	DefaultTimeout      = 30 * time.Second
+
+	maxRetryDelay = 30 * time.Second
+)
+
+// TokenSource returns the JWT sent with every request. It is called once per
+// attempt, so implementations can refresh expired tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+type Client struct {
+	baseURL string
+	tokens  TokenSource
+
+	// HTTPClient sends the requests, its Timeout bounds a single attempt.
+	HTTPClient *http.Client
+	// MaxRetries is how many times a failed request is sent again. Only
+	// requests that are safe to repeat are retried.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, it doubles on every
+	// attempt unless the API asks for a longer one with Retry-After.
+	RetryBackoff time.Duration
+}
+
+// NewClient returns a client of the API served at baseURL, for example
+// https://image-service-4of6fdjxuq-et.a.run.app. tokens may be nil for
+// endpoints that don't need a token.
+func NewClient(baseURL string, tokens TokenSource) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		tokens:  tokens,
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		MaxRetries:   DefaultMaxRetries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+}
+
+// Upload sends a JPEG image for detection. The image is read into memory so
+// the request can be sent again on a retry, every attempt carries the same
+// Idempotency-Key so a retry never stores the image twice.
+func (c *Client) Upload(ctx context.Context, filename string, image io.Reader) (*domain.UploadImageResponse, error) {
+	return c.UploadWithKey(ctx, uuid.NewString(), filename, image)
+}
+
+// UploadWithKey is Upload with a caller chosen idempotency key, for callers
+// that retry across restarts and keep the key with the pending image.
+func (c *Client) UploadWithKey(ctx context.Context, key, filename string, image io.Reader) (*domain.UploadImageResponse, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image"; filename="%s"`, escapeQuotes(filename)))
+	header.Set("Content-Type", "image/jpeg")
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(part, image); err != nil {
+		return nil, err
+	}
+	if err = form.Close(); err != nil {
+		return nil, err
+	}
+
+	var res domain.UploadImageResponse
+	req := request{
+		method:      http.MethodPost,
+		path:        "/v1/images",
+		body:        body.Bytes(),
+		contentType: form.FormDataContentType(),
+		header:      http.Header{"Idempotency-Key": []string{key}},
+		idempotent:  true,
+	}
+	if err = c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// List returns one page of the caller's images. A nil filter lists the
+// newest images with the default page size.
+func (c *Client) List(ctx context.Context, filter *ListFilter) (*domain.ImagePage, error) {
+	var res domain.ImagePage
+	req := request{
+		method: http.MethodGet,
+		path:   "/v1/images",
+		query:  filter.Query(),
+	}
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) Get(ctx context.Context, filename string) (*domain.Image, error) {
+	var res domain.Image
+	req := request{
+		method: http.MethodGet,
+		path:   "/v1/images/" + url.PathEscape(filename),
+	}
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) Delete(ctx context.Context, filename string) (*domain.DeleteImageResponse, error) {
+	var res domain.DeleteImageResponse
+	req := request{
+		method: http.MethodDelete,
+		path:   "/v1/images/" + url.PathEscape(filename),
+	}
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) Restore(ctx context.Context, filename string) (*domain.Image, error) {
+	var res domain.Image
+	req := request{
+		method: http.MethodPost,
+		path:   "/v1/images/" + url.PathEscape(filename) + "/restore",
+		// restoring an image twice leaves it in the same state
+		idempotent: true,
+	}
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Stats returns the detection statistics of the caller, zero fields of filter
+// use the API defaults.
+func (c *Client) Stats(ctx context.Context, filter domain.StatsFilter) (*domain.DetectionStats, error) {
+	query := url.Values{}
+	if filter.Days > 0 {
+		query.Set("days", strconv.Itoa(filter.Days))
+	}
+	if filter.Bucket != "" {
+		query.Set("bucket", string(filter.Bucket))
+	}
+	if filter.TimeZone != "" {
+		query.Set("tz", filter.TimeZone)
+	}
+
+	var res domain.DetectionStats
+	req := request{
+		method: http.MethodGet,
+		path:   "/v1/images/stats",
+		query:  query,
+	}
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+	header      http.Header
+	idempotent  bool
+}
+
+func (r request) retryable() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.idempotent
+}
+
+// do sends req until it succeeds, fails with an error that retrying won't
+// fix, or runs out of retries, and decodes the data of the response into out.
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	delay := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.send(ctx, req, out)
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.MaxRetries || !req.retryable() || !isTemporary(err) {
+			return err
+		}
+
+		wait := jitter(delay)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > maxRetryDelay {
+			wait = maxRetryDelay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, out interface{}) (time.Duration, error) {
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if c.tokens != nil {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("get token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, &temporaryError{err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return parseRetryAfter(res.Header.Get("Retry-After")), decodeError(res)
+	}
+	if out == nil {
+		return 0, nil
+	}
+	envelope := domain.ServerResponse{Data: out}
+	if err = json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		return 0, fmt.Errorf("decode %v %v response: %w", req.method, req.path, err)
+	}
+	return 0, nil
+}
+
+// temporaryError marks transport failures, the request may not have reached
+// the API at all.
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *temporaryError) Unwrap() error {
+	return e.err
+}
+
+func isTemporary(err error) bool {
+	switch e := err.(type) {
+	case *temporaryError:
+		return true
+	case *Error:
+		switch e.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// jitter spreads retries of many clients between d/2 and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
@@ -0,0 +1,252 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image-service/adapter/auth"
+	"image-service/adapter/handler"
+	"image-service/client"
+	"image-service/core/domain"
+	"image-service/core/port"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testEmail = "user@example.com"
+
+func TestMain(m *testing.M) {
+	auth.JWT_SIGNATURE_KEY = []byte("test-signature-key")
+	os.Exit(m.Run())
+}
+
+// fakeImageService keeps images in upload order. Cursors are the index of the
+// next image, the API treats them as opaque.
+type fakeImageService struct {
+	port.ImageService
+
+	mu       sync.Mutex
+	images   []domain.Image
+	keys     map[string]domain.UploadImageResponse
+	listings int
+}
+
+func newFakeImageService() *fakeImageService {
+	return &fakeImageService{
+		keys: map[string]domain.UploadImageResponse{},
+	}
+}
+
+func (f *fakeImageService) UploadImage(uploader domain.Uploader, file multipart.File) (*domain.UploadImageResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.upload(uploader, file)
+}
+
+func (f *fakeImageService) upload(uploader domain.Uploader, file multipart.File) (*domain.UploadImageResponse, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	filename := fmt.Sprintf("%d-%d.jpg", len(f.images), len(data))
+	f.images = append(f.images, domain.Image{
+		Email:    uploader.Email,
+		Filename: filename,
+		FileURL:  "https://storage.example.com/" + filename,
+		Status:   domain.ImageStatusQueued,
+	})
+	return &domain.UploadImageResponse{Filename: filename, FileURL: "https://storage.example.com/" + filename}, nil
+}
+
+func (f *fakeImageService) UploadImageWithKey(uploader domain.Uploader, key string, file multipart.File) (*domain.UploadImageResponse, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if res, ok := f.keys[key]; ok {
+		return &res, true, nil
+	}
+	res, err := f.upload(uploader, file)
+	if err != nil {
+		return nil, false, err
+	}
+	f.keys[key] = *res
+	return res, false, nil
+}
+
+func (f *fakeImageService) GetDetectionResults(email string, filter *domain.PageFilter) (*domain.ImagePage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listings++
+	start := 0
+	if filter.After != "" {
+		var err error
+		if start, err = strconv.Atoi(filter.After); err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+	}
+	page := &domain.ImagePage{Items: []domain.Image{}, PerPage: filter.PerPage}
+	for idx := start; idx < len(f.images); idx++ {
+		if f.images[idx].Email != email {
+			continue
+		}
+		if len(page.Items) == filter.PerPage {
+			page.HasMore = true
+			page.HasNext = true
+			page.NextCursor = strconv.Itoa(idx)
+			break
+		}
+		page.Items = append(page.Items, f.images[idx])
+	}
+	return page, nil
+}
+
+func (f *fakeImageService) GetSingleDetection(email, filename string) (*domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, img := range f.images {
+		if img.Filename != filename {
+			continue
+		}
+		if img.Email != email {
+			return nil, domain.ErrForbidden
+		}
+		return &img, nil
+	}
+	return nil, domain.ErrImageNotFound
+}
+
+func newTestServerURL(t *testing.T, service port.ImageService) string {
+	t.Helper()
+	server := httptest.NewServer(handler.NewRouter(handler.NewImageHttpHandler(service)))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func newTestClient(t *testing.T, service port.ImageService, email string) *client.Client {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": email,
+	}).SignedString(auth.JWT_SIGNATURE_KEY)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	c := client.NewClient(newTestServerURL(t, service), client.StaticToken(token))
+	c.RetryBackoff = 0
+	return c
+}
+
+func upload(t *testing.T, c *client.Client, n int) []string {
+	t.Helper()
+	filenames := make([]string, n)
+	for idx := range filenames {
+		res, err := c.Upload(context.Background(), "leaf.jpg", bytes.NewReader([]byte("jpeg data")))
+		if err != nil {
+			t.Fatalf("upload %v: %v", idx, err)
+		}
+		filenames[idx] = res.Filename
+	}
+	return filenames
+}
+
+func TestUpload(t *testing.T) {
+	service := newFakeImageService()
+	c := newTestClient(t, service, testEmail)
+
+	res, err := c.UploadWithKey(context.Background(), "key-1", "leaf.jpg", bytes.NewReader([]byte("jpeg data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Filename == "" || res.FileURL == "" {
+		t.Fatalf("response = %+v", res)
+	}
+
+	// a retry with the same key is answered with the first response
+	again, err := c.UploadWithKey(context.Background(), "key-1", "leaf.jpg", bytes.NewReader([]byte("jpeg data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *again != *res || len(service.images) != 1 {
+		t.Fatalf("retry = %+v, stored %v images", again, len(service.images))
+	}
+}
+
+func TestIteratePaginates(t *testing.T) {
+	service := newFakeImageService()
+	c := newTestClient(t, service, testEmail)
+	filenames := upload(t, c, 7)
+
+	var got []string
+	it := c.Iterate(context.Background(), client.NewListFilter().PerPage(3))
+	for it.Next() {
+		got = append(got, it.Image().Filename)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(filenames) {
+		t.Fatalf("iterated %v, want %v", got, filenames)
+	}
+	if service.listings != 3 {
+		t.Fatalf("fetched %v pages, want 3", service.listings)
+	}
+}
+
+func TestIterateStopsOnError(t *testing.T) {
+	c := newTestClient(t, newFakeImageService(), testEmail)
+	it := c.Iterate(context.Background(), client.NewListFilter().After("not-a-cursor"))
+	if it.Next() {
+		t.Fatal("Next succeeded with an invalid cursor")
+	}
+	if !errors.Is(it.Err(), domain.ErrInvalidCursor) {
+		t.Fatalf("Err = %v, want %v", it.Err(), domain.ErrInvalidCursor)
+	}
+}
+
+func TestGet(t *testing.T) {
+	c := newTestClient(t, newFakeImageService(), testEmail)
+	filenames := upload(t, c, 2)
+
+	img, err := c.Get(context.Background(), filenames[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Filename != filenames[1] || img.Email != testEmail || img.Status != domain.ImageStatusQueued {
+		t.Fatalf("image = %+v", img)
+	}
+}
+
+func TestProblemsDecodeToDomainErrors(t *testing.T) {
+	service := newFakeImageService()
+	owner := newTestClient(t, service, "owner@example.com")
+	filenames := upload(t, owner, 1)
+	c := newTestClient(t, service, testEmail)
+
+	_, err := c.Get(context.Background(), "missing.jpg")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Problem.Code != "image_not_found" {
+		t.Fatalf("error = %#v", err)
+	}
+	if !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("errors.Is(%v, ErrImageNotFound) = false", err)
+	}
+	if apiErr.Problem.Instance != "/v1/images/missing.jpg" {
+		t.Fatalf("instance = %q", apiErr.Problem.Instance)
+	}
+
+	if _, err = c.Get(context.Background(), filenames[0]); !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("error = %v, want %v", err, domain.ErrForbidden)
+	}
+
+	anonymous := client.NewClient(newTestServerURL(t, service), nil)
+	if _, err = anonymous.Get(context.Background(), filenames[0]); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("error = %v, want %v", err, domain.ErrUnauthorized)
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"image-service/core/domain"
+	"io"
+	"net/http"
+)
+
+// statusErrorKinds reverses the status codes the API reports domain errors
+// with, so a problem response turns back into the error that caused it.
+var statusErrorKinds = map[int]domain.ErrorKind{
+	http.StatusNotFound:           domain.ErrorKindNotFound,
+	http.StatusUnauthorized:       domain.ErrorKindUnauthorized,
+	http.StatusForbidden:          domain.ErrorKindForbidden,
+	http.StatusBadRequest:         domain.ErrorKindValidation,
+	http.StatusConflict:           domain.ErrorKindConflict,
+	http.StatusServiceUnavailable: domain.ErrorKindUnavailable,
+	http.StatusTooManyRequests:    domain.ErrorKindRateLimited,
+}
+
+// Error is a non-2xx response of the API.
+type Error struct {
+	StatusCode int
+	Problem    domain.Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Detail != "" {
+		return fmt.Sprintf("image api: %d %s: %s", e.StatusCode, e.Problem.Code, e.Problem.Detail)
+	}
+	return fmt.Sprintf("image api: %d %s", e.StatusCode, e.Problem.Code)
+}
+
+// Unwrap returns the domain error the problem describes, errors.Is(err,
+// domain.ErrImageNotFound) holds for an image_not_found problem.
+func (e *Error) Unwrap() error {
+	kind, ok := statusErrorKinds[e.StatusCode]
+	if !ok || e.Problem.Code == "" {
+		return nil
+	}
+	return &domain.Error{
+		Kind:    kind,
+		Code:    e.Problem.Code,
+		Message: e.Problem.Detail,
+	}
+}
+
+func decodeError(res *http.Response) error {
+	e := &Error{StatusCode: res.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err := json.Unmarshal(body, &e.Problem); err != nil || e.Problem.Code == "" {
+		// not a problem document, e.g. from a proxy in front of the API
+		e.Problem = domain.Problem{
+			Title:  http.StatusText(res.StatusCode),
+			Status: res.StatusCode,
+			Detail: string(body),
+		}
+	}
+	return e
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"image-service/core/domain"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ListFilter builds the query of List and Iterate. The zero value lists the
+// newest images, methods return the filter so calls can be chained:
+//
+//	filter := client.NewListFilter().
+//		Labels("Tomato___Late_blight").
+//		SortBy(domain.SortByConfidence, domain.SortDesc).
+//		Confidence(0.8, 1)
+type ListFilter struct {
+	filter domain.PageFilter
+	status string
+}
+
+func NewListFilter() *ListFilter {
+	return &ListFilter{}
+}
+
+func (f *ListFilter) PerPage(n int) *ListFilter {
+	f.filter.PerPage = n
+	return f
+}
+
+// SortBy orders the images by field. Dates need SortByCreatedAt and
+// confidence bounds need SortByConfidence.
+func (f *ListFilter) SortBy(field domain.SortField, order domain.SortOrder) *ListFilter {
+	f.filter.SortBy = field
+	f.filter.SortOrder = order
+	return f
+}
+
+// CreatedBetween keeps images created between start and end, in
+// milliseconds. Zero leaves that side open.
+func (f *ListFilter) CreatedBetween(start, end int64) *ListFilter {
+	f.filter.StartDate = int(start)
+	f.filter.EndDate = int(end)
+	return f
+}
+
+func (f *ListFilter) Labels(labels ...string) *ListFilter {
+	f.filter.Labels = append(f.filter.Labels, labels...)
+	return f
+}
+
+// IncludePending adds images still waiting for a result to a Labels filter.
+func (f *ListFilter) IncludePending() *ListFilter {
+	f.filter.IncludePending = true
+	return f
+}
+
+// Status keeps images in status, it replaces an earlier Status or Pending.
+func (f *ListFilter) Status(status domain.ImageStatus) *ListFilter {
+	f.status = string(status)
+	return f
+}
+
+// Pending keeps images that have no result yet, whatever their status.
+func (f *ListFilter) Pending() *ListFilter {
+	f.status = "pending"
+	return f
+}
+
+func (f *ListFilter) Confidence(min, max float64) *ListFilter {
+	f.filter.MinConfidence = &min
+	f.filter.MaxConfidence = &max
+	return f
+}
+
+func (f *ListFilter) ModelVersion(version string) *ListFilter {
+	f.filter.ModelVersion = version
+	return f
+}
+
+func (f *ListFilter) WithTotal() *ListFilter {
+	f.filter.WithTotal = true
+	return f
+}
+
+func (f *ListFilter) WithLabelCounts() *ListFilter {
+	f.filter.WithLabelCounts = true
+	return f
+}
+
+// After continues from the NextCursor of a page.
+func (f *ListFilter) After(cursor string) *ListFilter {
+	f.filter.After = cursor
+	f.filter.Before = ""
+	return f
+}
+
+// Before goes back from the PrevCursor of a page.
+func (f *ListFilter) Before(cursor string) *ListFilter {
+	f.filter.Before = cursor
+	f.filter.After = ""
+	return f
+}
+
+// Query encodes the filter with the parameter names of the list endpoint.
+func (f *ListFilter) Query() url.Values {
+	query := url.Values{}
+	if f == nil {
+		return query
+	}
+	set := func(key, value string) {
+		if value != "" {
+			query[key] = []string{value}
+		}
+	}
+	setBool := func(key string, value bool) {
+		if value {
+			query[key] = []string{"true"}
+		}
+	}
+	setInt := func(key string, value int) {
+		if value != 0 {
+			query[key] = []string{strconv.Itoa(value)}
+		}
+	}
+	setFloat := func(key string, value *float64) {
+		if value != nil {
+			query[key] = []string{strconv.FormatFloat(*value, 'f', -1, 64)}
+		}
+	}
+
+	setInt("perPage", f.filter.PerPage)
+	set("sort", string(f.filter.SortBy))
+	set("order", string(f.filter.SortOrder))
+	setInt("startDate", f.filter.StartDate)
+	setInt("endDate", f.filter.EndDate)
+	set("labels", strings.Join(f.filter.Labels, ","))
+	setBool("includePending", f.filter.IncludePending)
+	set("status", f.status)
+	setFloat("minConfidence", f.filter.MinConfidence)
+	setFloat("maxConfidence", f.filter.MaxConfidence)
+	set("modelVersion", f.filter.ModelVersion)
+	setBool("withTotal", f.filter.WithTotal)
+	setBool("withLabelCounts", f.filter.WithLabelCounts)
+	set("after", f.filter.After)
+	set("before", f.filter.Before)
+	return query
+}
+
+func (f *ListFilter) clone() *ListFilter {
+	if f == nil {
+		return NewListFilter()
+	}
+	c := *f
+	c.filter.Labels = append([]string(nil), f.filter.Labels...)
+	return &c
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"image-service/core/domain"
+)
+
+// ImageIterator walks every image matching a filter, fetching pages as it
+// goes:
+//
+//	it := c.Iterate(ctx, filter)
+//	for it.Next() {
+//		img := it.Image()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ImageIterator struct {
+	ctx    context.Context
+	client *Client
+	filter *ListFilter
+
+	page  *domain.ImagePage
+	index int
+	done  bool
+	err   error
+}
+
+// Iterate returns an iterator over the images matching filter, starting at
+// its cursor when one is set. filter is copied, changing it afterwards
+// doesn't affect the iterator.
+func (c *Client) Iterate(ctx context.Context, filter *ListFilter) *ImageIterator {
+	return &ImageIterator{
+		ctx:    ctx,
+		client: c,
+		filter: filter.clone(),
+	}
+}
+
+// Next advances to the next image, it returns false when there are no more
+// images or a page could not be fetched.
+func (it *ImageIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for it.page == nil || it.index >= len(it.page.Items) {
+		if it.done {
+			return false
+		}
+		page, err := it.client.List(it.ctx, it.filter)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page
+		it.index = 0
+		if !page.HasNext {
+			it.done = true
+		} else {
+			it.filter.After(page.NextCursor)
+		}
+	}
+	it.index++
+	return true
+}
+
+// Image returns the image Next advanced to.
+func (it *ImageIterator) Image() domain.Image {
+	return it.page.Items[it.index-1]
+}
+
+// Page returns the page the current image belongs to, for its totals.
+func (it *ImageIterator) Page() *domain.ImagePage {
+	return it.page
+}
+
+func (it *ImageIterator) Err() error {
+	return it.err
+}
+
+// ForEach calls fn for every image matching filter and stops at the first
+// error fn or the API returns.
+func (c *Client) ForEach(ctx context.Context, filter *ListFilter, fn func(domain.Image) error) error {
+	it := c.Iterate(ctx, filter)
+	for it.Next() {
+		if err := fn(it.Image()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// Pages calls fn with every page of images matching filter, for callers that
+// process images in batches.
+func (c *Client) Pages(ctx context.Context, filter *ListFilter, fn func(*domain.ImagePage) error) error {
+	filter = filter.clone()
+	for {
+		page, err := c.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if err = fn(page); err != nil {
+			return err
+		}
+		if !page.HasNext {
+			return nil
+		}
+		filter.After(page.NextCursor)
+	}
+}
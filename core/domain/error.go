@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+type ErrorKind string
+
+const (
+	ErrorKindNotFound     ErrorKind = "not_found"
+	ErrorKindUnauthorized ErrorKind = "unauthorized"
+	ErrorKindForbidden    ErrorKind = "forbidden"
+	ErrorKindValidation   ErrorKind = "validation"
+	ErrorKindConflict     ErrorKind = "conflict"
+	ErrorKindUnavailable  ErrorKind = "unavailable"
+	ErrorKindRateLimited  ErrorKind = "rate_limited"
+)
+
+// Error is returned by services for failures the caller can act on. Code is a
+// stable machine readable identifier, Kind decides how transports report it.
+// Anything that isn't an Error is an internal failure.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors of the same code, so errors built with Errorf still
+// match the sentinel they were derived from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Kind == e.Kind
+}
+
+// Errorf returns a copy of e with a more specific message.
+func (e *Error) Errorf(format string, args ...interface{}) *Error {
+	return &Error{
+		Kind:    e.Kind,
+		Code:    e.Code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Wrap returns a copy of e that keeps err as its cause.
+func (e *Error) Wrap(err error) *Error {
+	return &Error{
+		Kind:    e.Kind,
+		Code:    e.Code,
+		Message: e.Message,
+		Err:     err,
+	}
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: ErrorKindNotFound, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: ErrorKindUnauthorized, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: ErrorKindForbidden, Code: code, Message: message}
+}
+
+func Validation(code, message string) *Error {
+	return &Error{Kind: ErrorKindValidation, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: ErrorKindConflict, Code: code, Message: message}
+}
+
+func Unavailable(code, message string) *Error {
+	return &Error{Kind: ErrorKindUnavailable, Code: code, Message: message}
+}
+
+func RateLimited(code, message string) *Error {
+	return &Error{Kind: ErrorKindRateLimited, Code: code, Message: message}
+}
+
+// AsError returns the domain error in err's chain, or nil for internal errors.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+var (
+	ErrImageNotFound           = NotFound("image_not_found", "image not found")
+	ErrForbidden               = Forbidden("forbidden", "image belongs to another user")
+	ErrExportNotFound          = NotFound("export_not_found", "export not found")
+	ErrExportRateLimited       = RateLimited("export_rate_limited", "too many exports, try again later")
+	ErrErasureNotFound         = NotFound("erasure_not_found", "erasure not found")
+	ErrInvalidCursor           = Validation("invalid_cursor", "invalid page cursor")
+	ErrInvalidFilter           = Validation("invalid_filter", "invalid filter")
+	ErrInvalidStatus           = Validation("invalid_status", "invalid image status")
+	ErrInvalidStatusTransition = Conflict("invalid_status_transition", "invalid image status transition")
+	ErrWebhookNotFound         = NotFound("webhook_not_found", "webhook not found")
+	ErrWebhookForbidden        = Forbidden("webhook_forbidden", "webhook belongs to another user or organization")
+	ErrDeliveryNotFound        = NotFound("delivery_not_found", "webhook delivery not found")
+	ErrInvalidWebhook          = Validation("invalid_webhook", "invalid webhook")
+	ErrWebhooksDisabled        = Unavailable("webhooks_disabled", "webhooks are not configured")
+	ErrInvalidDevice           = Validation("invalid_device", "invalid device")
+	ErrDeviceNotFound          = NotFound("device_not_found", "device not found")
+	ErrUnregisteredDevice      = NotFound("unregistered_device", "device token is no longer registered")
+	ErrUnauthorized            = Unauthorized("invalid_token", "invalid or missing token")
+	ErrInvalidRequest          = Validation("invalid_request", "invalid request")
+	ErrUnavailable             = Unavailable("unavailable", "service is temporarily unavailable")
+	ErrInvalidIdempotencyKey   = Validation("invalid_idempotency_key", "invalid idempotency key")
+	ErrIdempotencyKeyReused    = Conflict("idempotency_key_reused", "idempotency key was already used with a different request")
+	ErrIdempotencyKeyInUse     = Conflict("idempotency_key_in_use", "a request with this idempotency key is still in progress")
+)
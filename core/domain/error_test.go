@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorfMatchesSentinel(t *testing.T) {
+	err := ErrInvalidFilter.Errorf("invalid filter: perPage must not be greater than %v", 100)
+	if !errors.Is(err, ErrInvalidFilter) {
+		t.Fatalf("errors.Is(%v, ErrInvalidFilter) = false", err)
+	}
+	if errors.Is(err, ErrInvalidCursor) {
+		t.Fatal("an invalid filter matches ErrInvalidCursor, which has the same kind")
+	}
+	if err.Message != "invalid filter: perPage must not be greater than 100" || err.Kind != ErrorKindValidation {
+		t.Fatalf("error = %#v", err)
+	}
+	if ErrInvalidFilter.Message != "invalid filter" {
+		t.Fatalf("Errorf changed the sentinel to %q", ErrInvalidFilter.Message)
+	}
+}
+
+func TestWrapKeepsCause(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := ErrWebhooksDisabled.Wrap(cause)
+	if !errors.Is(err, ErrWebhooksDisabled) || !errors.Is(err, cause) {
+		t.Fatalf("%v does not match both the sentinel and its cause", err)
+	}
+	if err.Error() != "webhooks are not configured: connection reset" || err.Message != ErrWebhooksDisabled.Message {
+		t.Fatalf("error = %q, message %q", err.Error(), err.Message)
+	}
+}
+
+func TestAsError(t *testing.T) {
+	wrapped := fmt.Errorf("get image: %w", ErrImageNotFound)
+	if e := AsError(wrapped); e == nil || e.Code != "image_not_found" || e.Kind != ErrorKindNotFound {
+		t.Fatalf("AsError(%v) = %#v", wrapped, e)
+	}
+	if e := AsError(errors.New("internal")); e != nil {
+		t.Fatalf("AsError(internal) = %#v, want nil", e)
+	}
+	if e := AsError(nil); e != nil {
+		t.Fatalf("AsError(nil) = %#v, want nil", e)
+	}
+}
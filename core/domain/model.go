@@ -1,21 +1,107 @@
 package domain
 
+import (
+	"fmt"
+	"time"
+)
+
+type Uploader struct {
+	Email        string `json:"email"`
+	Tier         string `json:"tier,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
 type UploadImageResponse struct {
 	Filename string `firestore:"filename,omitempty" json:"filename,omitempty"`
 	FileURL  string `firestore:"fileURL" json:"fileURL"`
 }
 
+type ImageStatus string
+
+const (
+	ImageStatusUploaded   ImageStatus = "uploaded"
+	ImageStatusQueued     ImageStatus = "queued"
+	ImageStatusProcessing ImageStatus = "processing"
+	ImageStatusDetected   ImageStatus = "detected"
+	ImageStatusFailed     ImageStatus = "failed"
+	ImageStatusRejected   ImageStatus = "rejected"
+)
+
+// PendingImageStatuses are the statuses of images still waiting for a result.
+var PendingImageStatuses = []ImageStatus{
+	ImageStatusUploaded,
+	ImageStatusQueued,
+	ImageStatusProcessing,
+}
+
+func (s ImageStatus) IsValid() bool {
+	switch s {
+	case ImageStatusUploaded, ImageStatusQueued, ImageStatusProcessing,
+		ImageStatusDetected, ImageStatusFailed, ImageStatusRejected:
+		return true
+	}
+	return false
+}
+
 type Image struct {
-	Email         string  `firestore:"email,omitempty" json:"email,omitempty"`
-	Filename      string  `firestore:"filename,omitempty" json:"filename,omitempty"`
-	Label         string  `firestore:"label" json:"label"`
-	InferenceTime int64   `firestore:"inferenceTime" json:"inferenceTime"`
-	CreatedAt     int64   `firestore:"createdAt" json:"createdAt"`
-	DetectedAt    int64   `firestore:"detectedAt" json:"detectedAt"`
-	Confidence    float64 `firestore:"confidence" json:"confidence"`
-	FileURL       string  `firestore:"fileURL" json:"fileURL"`
-	BlurHash      string  `firestore:"blurHash" json:"blurHash"`
-	IsDetected    bool    `firestore:"isDetected" json:"isDetected"`
+	Email             string            `firestore:"email,omitempty" json:"email,omitempty"`
+	Filename          string            `firestore:"filename,omitempty" json:"filename,omitempty"`
+	Label             string            `firestore:"label" json:"label"`
+	InferenceTime     int64             `firestore:"inferenceTime" json:"inferenceTime"`
+	CreatedAt         int64             `firestore:"createdAt" json:"createdAt"`
+	DetectedAt        int64             `firestore:"detectedAt" json:"detectedAt"`
+	Confidence        float64           `firestore:"confidence" json:"confidence"`
+	FileURL           string            `firestore:"fileURL" json:"fileURL"`
+	BlurHash          string            `firestore:"blurHash" json:"blurHash"`
+	IsDetected        bool              `firestore:"isDetected" json:"isDetected"`
+	Status            ImageStatus       `firestore:"status" json:"status"`
+	StatusUpdatedAt   int64             `firestore:"statusUpdatedAt" json:"statusUpdatedAt"`
+	StatusTimestamps  map[string]int64  `firestore:"statusTimestamps" json:"statusTimestamps"`
+	Attempts          int               `firestore:"attempts" json:"attempts"`
+	Failure           *DetectionFailure `firestore:"failure" json:"failure,omitempty"`
+	DeletedAt         int64             `firestore:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	PurgeAt           int64             `firestore:"purgeAt,omitempty" json:"purgeAt,omitempty"`
+	Tier              string            `firestore:"tier,omitempty" json:"tier,omitempty"`
+	OriginalDeletedAt int64             `firestore:"originalDeletedAt,omitempty" json:"originalDeletedAt,omitempty"`
+	ModelVersion      string            `firestore:"modelVersion" json:"modelVersion"`
+	Organization      string            `firestore:"organization,omitempty" json:"organization,omitempty"`
+}
+
+type DetectionFailure struct {
+	Code      string `firestore:"code" json:"code"`
+	Message   string `firestore:"message" json:"message"`
+	Retryable bool   `firestore:"retryable" json:"retryable"`
+	FailedAt  int64  `firestore:"failedAt" json:"failedAt"`
+}
+
+// CurrentStatus falls back to isDetected for documents written before the
+// status field existed.
+func (img Image) CurrentStatus() ImageStatus {
+	if img.Status != "" {
+		return img.Status
+	}
+	if img.IsDetected {
+		return ImageStatusDetected
+	}
+	return ImageStatusUploaded
+}
+
+type StatusTransition struct {
+	From ImageStatus `json:"from"`
+	To   ImageStatus `json:"to"`
+	At   int64       `json:"at"`
+}
+
+type UpdateImageStatusPayload struct {
+	Filename string      `json:"filename"`
+	Status   ImageStatus `json:"status"`
+}
+
+type DeleteImageResponse struct {
+	Filename    string `json:"filename"`
+	SoftDeleted bool   `json:"softDeleted"`
+	DeletedAt   int64  `json:"deletedAt"`
+	PurgeAt     int64  `json:"purgeAt,omitempty"`
 }
 
 type UpdateImagePayloadData struct {
@@ -24,7 +110,15 @@ type UpdateImagePayloadData struct {
 	InferenceTime float32 `firestore:"inferenceTime" json:"inferenceTime"`
 	DetectedAt    float32 `firestore:"detectedAt" json:"detectedAt"`
 	Confidence    float64 `firestore:"confidence" json:"confidence"`
+	ModelVersion  string  `firestore:"modelVersion" json:"modelVersion"`
 }
+type UpdateImageFailurePayload struct {
+	Filename  string `json:"filename"`
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
 type UpdateImagePayload struct {
 	Message string                 `json:"message"`
 	Data    UpdateImagePayloadData `json:"data"`
@@ -35,6 +129,341 @@ type SendToMLPayload struct {
 	Filename string `avro:"filename" json:"filename"`
 }
 
+// OutboxEntry is a pending dispatch to the ML topic. Its ID is derived from
+// the filename and attempt so the same dispatch is never recorded twice.
+// An entry that keeps failing is dead-lettered and no longer relayed.
+type OutboxEntry struct {
+	ID             string `firestore:"id" json:"id"`
+	Filename       string `firestore:"filename" json:"filename"`
+	Attempt        int    `firestore:"attempt" json:"attempt"`
+	CreatedAt      int64  `firestore:"createdAt" json:"createdAt"`
+	SentAt         int64  `firestore:"sentAt" json:"sentAt"`
+	Retries        int    `firestore:"retries" json:"retries"`
+	LastError      string `firestore:"lastError" json:"lastError"`
+	NextAttemptAt  int64  `firestore:"nextAttemptAt" json:"nextAttemptAt"`
+	DeadLetteredAt int64  `firestore:"deadLetteredAt" json:"deadLetteredAt"`
+}
+
+func NewOutboxEntry(filename string, attempt int, createdAt int64) OutboxEntry {
+	return OutboxEntry{
+		ID:            fmt.Sprintf("%v-%d", filename, attempt),
+		Filename:      filename,
+		Attempt:       attempt,
+		CreatedAt:     createdAt,
+		NextAttemptAt: createdAt,
+	}
+}
+
+type BlobInfo struct {
+	Name      string `json:"name"`
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type ReconcileOptions struct {
+	GracePeriod time.Duration `json:"gracePeriod"`
+	DryRun      bool          `json:"dryRun"`
+}
+
+type ReconcileReport struct {
+	DryRun        bool       `json:"dryRun"`
+	ScannedBlobs  int        `json:"scannedBlobs"`
+	ScannedImages int        `json:"scannedImages"`
+	OrphanedBlobs []BlobInfo `json:"orphanedBlobs"`
+	MissingBlobs  []string   `json:"missingBlobs"`
+	DeletedBlobs  int        `json:"deletedBlobs"`
+}
+
+type StatusBackfillReport struct {
+	DryRun        bool `json:"dryRun"`
+	ScannedImages int  `json:"scannedImages"`
+	Backfilled    int  `json:"backfilled"`
+}
+
+type ExportStatus string
+
+const (
+	ExportStatusPending   ExportStatus = "pending"
+	ExportStatusRunning   ExportStatus = "running"
+	ExportStatusCompleted ExportStatus = "completed"
+	ExportStatusFailed    ExportStatus = "failed"
+	ExportStatusExpired   ExportStatus = "expired"
+)
+
+type ExportJob struct {
+	ID              string       `firestore:"id" json:"id"`
+	Email           string       `firestore:"email" json:"email"`
+	Status          ExportStatus `firestore:"status" json:"status"`
+	TotalImages     int64        `firestore:"totalImages" json:"totalImages"`
+	ProcessedImages int64        `firestore:"processedImages" json:"processedImages"`
+	MissingImages   int64        `firestore:"missingImages" json:"missingImages,omitempty"`
+	CreatedAt       int64        `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt       int64        `firestore:"updatedAt" json:"updatedAt"`
+	CompletedAt     int64        `firestore:"completedAt" json:"completedAt,omitempty"`
+	ExpiresAt       int64        `firestore:"expiresAt" json:"expiresAt,omitempty"`
+	Error           string       `firestore:"error" json:"error,omitempty"`
+	DownloadURL     string       `firestore:"-" json:"downloadURL,omitempty"`
+}
+
+type ErasureMode string
+
+const (
+	ErasureModeDelete    ErasureMode = "delete"
+	ErasureModeAnonymize ErasureMode = "anonymize"
+)
+
+type ErasureStatus string
+
+const (
+	ErasureStatusPending   ErasureStatus = "pending"
+	ErasureStatusRunning   ErasureStatus = "running"
+	ErasureStatusCompleted ErasureStatus = "completed"
+)
+
+type AccountDeletedEvent struct {
+	EventID   string `json:"eventId"`
+	Email     string `json:"email"`
+	DeletedAt int64  `json:"deletedAt"`
+}
+
+// ErasureJob doubles as the audit record of an account erasure. The email is
+// cleared once the job completes and only its hash is kept. The filenames of
+// the removed images are listed in the removed-images subcollection of the
+// job, a single document could not hold them for large accounts.
+type ErasureJob struct {
+	ID               string        `firestore:"id" json:"id"`
+	Email            string        `firestore:"email" json:"-"`
+	EmailHash        string        `firestore:"emailHash" json:"emailHash"`
+	Mode             ErasureMode   `firestore:"mode" json:"mode"`
+	Status           ErasureStatus `firestore:"status" json:"status"`
+	RequestedAt      int64         `firestore:"requestedAt" json:"requestedAt"`
+	StartedAt        int64         `firestore:"startedAt" json:"startedAt,omitempty"`
+	CompletedAt      int64         `firestore:"completedAt" json:"completedAt,omitempty"`
+	ErasedImages     int           `firestore:"erasedImages" json:"erasedImages"`
+	AnonymizedImages int           `firestore:"anonymizedImages" json:"anonymizedImages"`
+	DeletedExports   int           `firestore:"deletedExports" json:"deletedExports"`
+	DeletedWebhooks  int           `firestore:"deletedWebhooks" json:"deletedWebhooks"`
+	DeletedDevices   int           `firestore:"deletedDevices" json:"deletedDevices"`
+}
+
+type RetentionAction string
+
+const (
+	RetentionActionDeleteOriginal RetentionAction = "delete-original"
+	RetentionActionAnonymize      RetentionAction = "anonymize"
+	RetentionActionDelete         RetentionAction = "delete"
+)
+
+func (a RetentionAction) IsValid() bool {
+	switch a {
+	case RetentionActionDeleteOriginal, RetentionActionAnonymize, RetentionActionDelete:
+		return true
+	}
+	return false
+}
+
+// RetentionAllTiers is the tier of a rule that applies to every image.
+const RetentionAllTiers = "*"
+
+// RetentionRule applies Action to images older than AfterDays. A rule with a
+// Tier only matches images uploaded by users of that tier.
+type RetentionRule struct {
+	Name      string          `json:"name"`
+	Tier      string          `json:"tier"`
+	Action    RetentionAction `json:"action"`
+	AfterDays int             `json:"afterDays"`
+}
+
+type RetentionCursor struct {
+	CreatedAt int64  `firestore:"createdAt" json:"createdAt"`
+	Filename  string `firestore:"filename" json:"filename"`
+}
+
+type RetentionRuleResult struct {
+	Rule      string `firestore:"rule" json:"rule"`
+	Processed int    `firestore:"processed" json:"processed"`
+	Failed    int    `firestore:"failed" json:"failed"`
+	Error     string `firestore:"error" json:"error,omitempty"`
+}
+
+type RetentionSweep struct {
+	ID          string                `firestore:"id" json:"id"`
+	StartedAt   int64                 `firestore:"startedAt" json:"startedAt"`
+	CompletedAt int64                 `firestore:"completedAt" json:"completedAt"`
+	Results     []RetentionRuleResult `firestore:"results" json:"results"`
+}
+
+type StatsBucketSize string
+
+const (
+	StatsBucketDay   StatsBucketSize = "day"
+	StatsBucketWeek  StatsBucketSize = "week"
+	StatsBucketMonth StatsBucketSize = "month"
+)
+
+type StatsFilter struct {
+	Days     int             `json:"days"`
+	Bucket   StatsBucketSize `json:"bucket"`
+	TimeZone string          `json:"timeZone"`
+}
+
+type StatsBucket struct {
+	Start   string         `json:"start"`
+	StartAt int64          `json:"startAt"`
+	Count   int            `json:"count"`
+	ByLabel map[string]int `json:"byLabel"`
+}
+
+type DetectionStats struct {
+	StatsFilter
+	Total                    int                `json:"total"`
+	Detected                 int                `json:"detected"`
+	Pending                  int                `json:"pending"`
+	Failed                   int                `json:"failed"`
+	ByLabel                  map[string]int     `json:"byLabel"`
+	AverageConfidence        float64            `json:"averageConfidence"`
+	AverageConfidenceByLabel map[string]float64 `json:"averageConfidenceByLabel"`
+	Timeline                 []StatsBucket      `json:"timeline"`
+	GeneratedAt              int64              `json:"generatedAt"`
+}
+
+const (
+	EventDetectionCompleted = "detection.completed"
+	EventImageStatusChanged = "image.status_changed"
+	// EventStreamLagged ends a stream whose client fell too far behind, it
+	// reconnects with its last event ID to catch up from the backlog.
+	EventStreamLagged = "stream.lagged"
+)
+
+// DetectionEvent is pushed to the owner of an image. IDs start with the
+// publish time in milliseconds so they can be ordered across replicas.
+type DetectionEvent struct {
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	Email    string      `json:"-"`
+	Filename string      `json:"filename"`
+	Status   ImageStatus `json:"status"`
+	Image    *Image      `json:"image,omitempty"`
+	At       int64       `json:"at"`
+}
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyStatusPending   IdempotencyStatus = "pending"
+	IdempotencyStatusCompleted IdempotencyStatus = "completed"
+)
+
+// IdempotencyRecord remembers the first response to a request sent with an
+// Idempotency-Key, so a retry of the same request gets the same response.
+// RequestHash tells a retry apart from a different request reusing the key.
+// ExpiresAt is a timestamp, unlike the other times, so the TTL policy of
+// the idempotency-keys collection can delete expired records.
+type IdempotencyRecord struct {
+	Email       string            `firestore:"email"`
+	Key         string            `firestore:"key"`
+	RequestHash string            `firestore:"requestHash"`
+	Status      IdempotencyStatus `firestore:"status"`
+	Response    string            `firestore:"response"`
+	CreatedAt   int64             `firestore:"createdAt"`
+	ExpiresAt   time.Time         `firestore:"expiresAt"`
+}
+
+// Webhook receives detection events of its owner, or of every member of
+// Organization when it is set. Its signing secret is only stored encrypted.
+type Webhook struct {
+	ID              string   `firestore:"id" json:"id"`
+	Email           string   `firestore:"email" json:"email"`
+	Organization    string   `firestore:"organization" json:"organization,omitempty"`
+	URL             string   `firestore:"url" json:"url"`
+	Events          []string `firestore:"events" json:"events"`
+	EncryptedSecret string   `firestore:"encryptedSecret,omitempty" json:"-"`
+	CreatedAt       int64    `firestore:"createdAt" json:"createdAt"`
+}
+
+// CreatedWebhook is the response to registering a webhook, the only one that
+// carries the plaintext signing secret.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+func (w Webhook) Accepts(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType || event == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one attempt sequence of sending an event to a webhook.
+// Payload is kept so a redelivery sends the exact same body.
+type WebhookDelivery struct {
+	ID             string                `firestore:"id" json:"id"`
+	WebhookID      string                `firestore:"webhookId" json:"webhookId"`
+	Email          string                `firestore:"email" json:"-"`
+	EventID        string                `firestore:"eventId" json:"eventId"`
+	EventType      string                `firestore:"eventType" json:"eventType"`
+	Payload        string                `firestore:"payload" json:"payload"`
+	Status         WebhookDeliveryStatus `firestore:"status" json:"status"`
+	Attempts       int                   `firestore:"attempts" json:"attempts"`
+	NextAttemptAt  int64                 `firestore:"nextAttemptAt" json:"nextAttemptAt,omitempty"`
+	LastStatusCode int                   `firestore:"lastStatusCode" json:"lastStatusCode,omitempty"`
+	LastError      string                `firestore:"lastError" json:"lastError,omitempty"`
+	RedeliveryOf   string                `firestore:"redeliveryOf" json:"redeliveryOf,omitempty"`
+	CreatedAt      int64                 `firestore:"createdAt" json:"createdAt"`
+	DeliveredAt    int64                 `firestore:"deliveredAt" json:"deliveredAt,omitempty"`
+}
+
+type CreateWebhookPayload struct {
+	URL          string   `json:"url"`
+	Events       []string `json:"events"`
+	Organization bool     `json:"organization"`
+}
+
+type DeviceToken struct {
+	Token     string `firestore:"token" json:"token"`
+	Email     string `firestore:"email" json:"-"`
+	Platform  string `firestore:"platform" json:"platform"`
+	Locale    string `firestore:"locale" json:"locale"`
+	CreatedAt int64  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt int64  `firestore:"updatedAt" json:"updatedAt"`
+}
+
+type RegisterDevicePayload struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+	Locale   string `json:"locale"`
+}
+
+type PushMessage struct {
+	Token string            `json:"token"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Problem is an RFC 7807 error body. Code repeats the domain error code so
+// clients don't have to parse Type.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
 type ServerResponse struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data"`
@@ -44,11 +473,70 @@ type UserData struct {
 	Username string `json:"Message,omitempty"`
 }
 
+type SortField string
+
+const (
+	SortByCreatedAt  SortField = "createdAt"
+	SortByDetectedAt SortField = "detectedAt"
+	SortByConfidence SortField = "confidence"
+)
+
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
 type PageFilter struct {
-	Page      int      `json:"page"`
-	PerPage   int      `json:"perPage"`
-	StartDate int      `json:"startDate"`
-	EndDate   int      `json:"endDate"`
-	Labels    []string `json:"labels"`
-	After     string   `json:"after"`
+	PerPage       int           `json:"perPage"`
+	StartDate     int           `json:"startDate"`
+	EndDate       int           `json:"endDate"`
+	Labels        []string      `json:"labels"`
+	After         string        `json:"after"`
+	Before        string        `json:"before"`
+	Statuses      []ImageStatus `json:"statuses"`
+	MinConfidence *float64      `json:"minConfidence"`
+	MaxConfidence *float64      `json:"maxConfidence"`
+	ModelVersion  string        `json:"modelVersion"`
+	SortBy        SortField     `json:"sortBy"`
+	SortOrder     SortOrder     `json:"sortOrder"`
+
+	// IncludePending adds images still waiting for a result to a label
+	// filter, they have no label yet.
+	IncludePending bool `json:"includePending"`
+
+	WithTotal       bool `json:"withTotal"`
+	WithLabelCounts bool `json:"withLabelCounts"`
+
+	// Cursor and Backward are decoded from After or Before by the service.
+	Cursor   *PageCursor `json:"-"`
+	Backward bool        `json:"-"`
+}
+
+// PageCursor is the position of an image in the list order. Filename breaks
+// ties between images with the same sort value, SortBy and SortOrder tie the
+// cursor to the order it was issued for.
+type PageCursor struct {
+	SortBy    SortField   `json:"s"`
+	SortOrder SortOrder   `json:"o"`
+	Value     interface{} `json:"v"`
+	Filename  string      `json:"f"`
+}
+
+// ImagePage is one page of the image list. HasNext and HasPrevious tell
+// whether NextCursor and PrevCursor lead to more images. HasMore only looks
+// in the direction of the request: after a Before cursor it means there are
+// more images before the page.
+type ImagePage struct {
+	Items       []Image          `json:"items"`
+	NextCursor  string           `json:"nextCursor,omitempty"`
+	PrevCursor  string           `json:"prevCursor,omitempty"`
+	HasMore     bool             `json:"hasMore"`
+	PerPage     int              `json:"perPage"`
+	Total       *int64           `json:"total,omitempty"`
+	LabelCounts map[string]int64 `json:"labelCounts,omitempty"`
+
+	HasNext     bool `json:"hasNext"`
+	HasPrevious bool `json:"hasPrevious"`
 }
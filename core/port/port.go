@@ -1,22 +1,133 @@
 package port
 
 import (
+	"context"
 	"image-service/core/domain"
+	"io"
 	"mime/multipart"
+	"time"
 )
 
 type ImageService interface {
-	UploadImage(string, multipart.File) (*domain.UploadImageResponse, error)
-	GetDetectionResults(string, *domain.PageFilter) ([]domain.Image, error)
+	UploadImage(domain.Uploader, multipart.File) (*domain.UploadImageResponse, error)
+	UploadImageWithKey(domain.Uploader, string, multipart.File) (*domain.UploadImageResponse, bool, error)
+	GetDetectionResults(string, *domain.PageFilter) (*domain.ImagePage, error)
 	UpdateImageResult(domain.UpdateImagePayloadData) error
+	UpdateImageStatus(domain.UpdateImageStatusPayload) error
+	ReportImageFailure(domain.UpdateImageFailurePayload) error
 	GetSingleDetection(string, string) (*domain.Image, error)
 	UpdateBlurHash(string, multipart.File) error
+	DeleteImage(string, string) (*domain.DeleteImageResponse, error)
+	RestoreImage(string, string) (*domain.Image, error)
+	ReconcileBlobs(domain.ReconcileOptions) (*domain.ReconcileReport, error)
+	BackfillImageStatuses(bool) (*domain.StatusBackfillReport, error)
+	CreateExport(string) (*domain.ExportJob, error)
+	GetExport(string, string) (*domain.ExportJob, error)
+	EraseAccount(domain.AccountDeletedEvent) (*domain.ErasureJob, error)
+	GetDetectionStats(string, domain.StatsFilter) (*domain.DetectionStats, error)
+	ExportDetections(string, domain.PageFilter, func(domain.Image) error) error
+	GetRetentionRules() []domain.RetentionRule
+	GetRetentionSweeps(int) ([]domain.RetentionSweep, error)
+	SubscribeDetectionEvents(email, lastEventID string) ([]domain.DetectionEvent, <-chan domain.DetectionEvent, func())
+	CreateWebhook(domain.Uploader, domain.CreateWebhookPayload) (*domain.CreatedWebhook, error)
+	ListWebhooks(domain.Uploader) ([]domain.Webhook, error)
+	DeleteWebhook(domain.Uploader, string) error
+	ListWebhookDeliveries(domain.Uploader, string) ([]domain.WebhookDelivery, error)
+	RedeliverWebhook(domain.Uploader, string) (*domain.WebhookDelivery, error)
+	RegisterDevice(string, domain.RegisterDevicePayload) (*domain.DeviceToken, error)
+	UnregisterDevice(string, string) error
 }
 
 type ImageRepository interface {
-	UploadImage(string, multipart.File) (*domain.UploadImageResponse, error)
+	UploadImage(domain.Uploader, multipart.File) (*domain.UploadImageResponse, error)
 	GetDetectionResults(string, *domain.PageFilter) ([]domain.Image, error)
-	UpdateImageResult(domain.UpdateImagePayloadData) error
+	CountDetectionResults(string, *domain.PageFilter) (int64, error)
+	ForEachDetection(string, int64, func(domain.Image) error) error
+	CountDetectionResultsByLabel(string, *domain.PageFilter, []string) (map[string]int64, error)
+	UpdateImageResult(domain.UpdateImagePayloadData, domain.StatusTransition) error
+	UpdateImageStatus(string, domain.StatusTransition) error
+	UpdateImageFailure(string, domain.DetectionFailure, domain.StatusTransition) error
+	MarkImageDispatched(string, domain.StatusTransition) error
+	GetImage(string) (*domain.Image, error)
+	GetStaleImages([]domain.ImageStatus, int64, int) ([]domain.Image, error)
+	ForEachImageWithoutStatus(func(domain.Image) error) error
+	CreateOutboxEntry(domain.OutboxEntry) error
+	GetPendingOutboxEntries(before int64, limit int) ([]domain.OutboxEntry, error)
+	MarkOutboxEntrySent(string, int64) error
+	RecordOutboxFailure(domain.OutboxEntry) error
+	DeleteImage(string) error
+	SoftDeleteImage(string, int64, int64) error
+	RestoreImage(string) error
+	GetDeletedImage(string) (*domain.Image, error)
+	GetExpiredDeletedImages(int64, int) ([]domain.Image, error)
+	CountUserImages(string) (int64, error)
+	ForEachUserImage(string, func(domain.Image) error) error
+	OpenImageBlob(string) (io.ReadCloser, error)
+	// CreateExportJob stores the job only if check accepts the user's
+	// existing jobs, both in one transaction.
+	CreateExportJob(domain.ExportJob, func([]domain.ExportJob) error) error
+	UpdateExportJob(domain.ExportJob) error
+	GetExportJob(string) (*domain.ExportJob, error)
+	// NewExportArchiveWriter uploads the archive on Close, cancelling ctx
+	// before discards it.
+	NewExportArchiveWriter(context.Context, string) io.WriteCloser
+	GenerateExportURL(string, time.Time) (string, error)
+	ListUserExportJobs(string) ([]domain.ExportJob, error)
+	DeleteExportJob(string) error
+	GetStaleExportJobs(before int64, limit int) ([]domain.ExportJob, error)
+	GetExpiredExportJobs(before int64, limit int) ([]domain.ExportJob, error)
+	DeleteExportArchive(string) error
+	GetUserImageBatch(string, int) ([]domain.Image, error)
+	AnonymizeImage(string, string) error
+	CreateErasureJob(domain.ErasureJob) error
+	UpdateErasureJob(domain.ErasureJob) error
+	GetErasureJob(string) (*domain.ErasureJob, error)
+	GetPendingErasureJobs(int) ([]domain.ErasureJob, error)
+	RecordErasedImages(jobID string, filenames []string, removedAt int64) error
+	GetRetentionBatch(domain.RetentionRule, int64, domain.RetentionCursor, int) ([]domain.Image, error)
+	GetRetentionCursor(string) (*domain.RetentionCursor, error)
+	SaveRetentionCursor(string, domain.RetentionCursor) error
+	DeleteOriginalImage(string, int64) error
+	SaveRetentionSweep(domain.RetentionSweep) error
+	GetRetentionSweeps(int) ([]domain.RetentionSweep, error)
+	ListImageBlobs() ([]domain.BlobInfo, error)
+	ListImageFilenames() ([]string, error)
+	DeleteImageBlob(string) error
+	CreateWebhook(domain.Webhook) error
+	GetWebhook(string) (*domain.Webhook, error)
+	ListWebhooks(email, organization string) ([]domain.Webhook, error)
+	DeleteWebhook(string) error
+	CreateWebhookDelivery(domain.WebhookDelivery) error
+	UpdateWebhookDelivery(domain.WebhookDelivery) error
+	GetWebhookDelivery(string) (*domain.WebhookDelivery, error)
+	GetDueWebhookDeliveries(before int64, limit int) ([]domain.WebhookDelivery, error)
+	ListWebhookDeliveries(webhookID string, limit int) ([]domain.WebhookDelivery, error)
+	DeleteUserWebhooks(email string) (int, error)
+	SaveDeviceToken(domain.DeviceToken) error
+	GetDeviceToken(string) (*domain.DeviceToken, error)
+	GetDeviceTokens(string) ([]domain.DeviceToken, error)
+	DeleteDeviceToken(string) error
+	DeleteUserDeviceTokens(email string) (int, error)
+	ReserveIdempotencyKey(domain.IdempotencyRecord) (*domain.IdempotencyRecord, error)
+	CompleteIdempotencyKey(email, key, response string, expiresAt time.Time) error
+	DeleteIdempotencyKey(email, key string) error
+	DeleteUserIdempotencyKeys(email string) error
+	DeleteExpiredIdempotencyKeys(before time.Time, limit int) (int, error)
+	AcquireLock(string, string, time.Duration) (bool, error)
+	ReleaseLock(string, string) error
 	GetSingleDetection(string, string) (*domain.Image, error)
 	UpdateBlurHash(string, string) error
 }
+
+// EventBroker carries detection events to every replica. A single replica
+// can use the in-memory broker.
+type EventBroker interface {
+	Publish(domain.DetectionEvent) error
+	Subscribe(context.Context, func(domain.DetectionEvent)) error
+}
+
+// Notifier delivers push messages to a device. Implementations return
+// domain.ErrUnregisteredDevice for tokens the provider no longer accepts.
+type Notifier interface {
+	Notify(context.Context, domain.PushMessage) error
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"image-service/core/domain"
+	"log"
+	"time"
+)
+
+const (
+	DefaultTrashPurgeInterval = time.Hour
+	trashPurgeLockName        = "trash-purger"
+	trashPurgeBatchSize       = 100
+)
+
+// DeleteImage moves the image to the trash when a restore window is
+// configured, otherwise it is removed right away.
+func (i *ImageService) DeleteImage(email, filename string) (*domain.DeleteImageResponse, error) {
+	img, err := i.repo.GetImage(filename)
+	if err != nil {
+		log.Printf("[ImageService.DeleteImage] error when retrieve image with error %v \n", err)
+		return nil, err
+	}
+	// another user's image is reported missing, so its name doesn't leak
+	if img.Email != email {
+		return nil, domain.ErrImageNotFound
+	}
+
+	now := time.Now()
+	res := domain.DeleteImageResponse{
+		Filename:  filename,
+		DeletedAt: now.UnixMilli(),
+	}
+	if i.softDeleteWindow <= 0 {
+		if err = i.repo.DeleteImage(filename); err != nil {
+			log.Printf("[ImageService.DeleteImage] error when delete image with error %v \n", err)
+			return nil, err
+		}
+		return &res, nil
+	}
+
+	res.SoftDeleted = true
+	res.PurgeAt = now.Add(i.softDeleteWindow).UnixMilli()
+	if err = i.repo.SoftDeleteImage(filename, res.DeletedAt, res.PurgeAt); err != nil {
+		log.Printf("[ImageService.DeleteImage] error when soft delete image with error %v \n", err)
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (i *ImageService) RestoreImage(email, filename string) (*domain.Image, error) {
+	img, err := i.repo.GetDeletedImage(filename)
+	if err != nil {
+		log.Printf("[ImageService.RestoreImage] error when retrieve deleted image with error %v \n", err)
+		return nil, err
+	}
+	if img.Email != email {
+		return nil, domain.ErrImageNotFound
+	}
+	if img.PurgeAt <= time.Now().UnixMilli() {
+		return nil, domain.ErrImageNotFound
+	}
+
+	if err = i.repo.RestoreImage(filename); err != nil {
+		log.Printf("[ImageService.RestoreImage] error when restore image with error %v \n", err)
+		return nil, err
+	}
+	return i.repo.GetImage(filename)
+}
+
+func purgeTrash(i *ImageService) error {
+	lock, err := acquireLease(i, trashPurgeLockName, i.trashPurgeInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	images, err := i.repo.GetExpiredDeletedImages(time.Now().UnixMilli(), trashPurgeBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.purgeTrash] error when retrieve expired images with error %v \n", err)
+		return err
+	}
+	for _, img := range images {
+		err = i.repo.DeleteImage(img.Filename)
+		if err != nil && !errors.Is(err, domain.ErrImageNotFound) {
+			log.Printf("[ImageService.purgeTrash] error when purge %v with error %v \n", img.Filename, err)
+		}
+	}
+	return nil
+}
+
+// StartTrashPurger permanently deletes soft-deleted images once their
+// restore window has passed.
+func (i *ImageService) StartTrashPurger(ctx context.Context) {
+	if i.softDeleteWindow <= 0 {
+		return
+	}
+	ticker := time.NewTicker(i.trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := purgeTrash(i); err != nil {
+				log.Printf("[ImageService.StartTrashPurger] error when purge trash with error %v \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func newDeleteTestService(repo *fakeRepository, softDeleteWindow time.Duration) *ImageService {
+	i := newTestService(repo)
+	i.softDeleteWindow = softDeleteWindow
+	i.trashPurgeInterval = DefaultTrashPurgeInterval
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Email: "user@example.com"}
+	return i
+}
+
+func TestDeleteImageWithoutRestoreWindow(t *testing.T) {
+	repo := newFakeRepository()
+	i := newDeleteTestService(repo, 0)
+
+	if _, err := i.DeleteImage("other@example.com", "a.jpg"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("DeleteImage = %v, want %v", err, domain.ErrImageNotFound)
+	}
+	res, err := i.DeleteImage("user@example.com", "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SoftDeleted || res.PurgeAt != 0 {
+		t.Fatalf("response = %+v", res)
+	}
+	if len(repo.images) != 0 || len(repo.trash) != 0 {
+		t.Fatalf("image is still stored: %+v %+v", repo.images, repo.trash)
+	}
+	if _, err = i.RestoreImage("user@example.com", "a.jpg"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("RestoreImage = %v, want %v", err, domain.ErrImageNotFound)
+	}
+}
+
+func TestDeleteAndRestoreImage(t *testing.T) {
+	repo := newFakeRepository()
+	i := newDeleteTestService(repo, time.Hour)
+
+	res, err := i.DeleteImage("user@example.com", "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.SoftDeleted || res.PurgeAt != res.DeletedAt+time.Hour.Milliseconds() {
+		t.Fatalf("response = %+v", res)
+	}
+	if _, err = i.RestoreImage("other@example.com", "a.jpg"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("RestoreImage = %v, want %v", err, domain.ErrImageNotFound)
+	}
+
+	img, err := i.RestoreImage("user@example.com", "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Filename != "a.jpg" || img.DeletedAt != 0 || img.PurgeAt != 0 {
+		t.Fatalf("restored image = %+v", img)
+	}
+}
+
+func TestRestoreImageAfterWindow(t *testing.T) {
+	repo := newFakeRepository()
+	i := newDeleteTestService(repo, time.Hour)
+	if err := repo.SoftDeleteImage("a.jpg", 1, time.Now().Add(-time.Minute).UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.RestoreImage("user@example.com", "a.jpg"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("RestoreImage = %v, want %v", err, domain.ErrImageNotFound)
+	}
+	if err := purgeTrash(i); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.trash) != 0 {
+		t.Fatalf("trash = %+v, want the expired image purged", repo.trash)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"image-service/core/domain"
+	"log"
+	"time"
+)
+
+const (
+	DefaultOutboxRelayInterval = 5 * time.Second
+	DefaultOutboxMaxRetries    = 8
+	outboxRelayLockName        = "outbox-relay"
+	outboxRelayBatchSize       = 100
+	outboxRetryBackoff         = 10 * time.Second
+)
+
+// dispatchImage records another dispatch of the image in the outbox and
+// counts the attempt. The relay publishes it and moves the image back to
+// queued.
+func dispatchImage(i *ImageService, filename string) error {
+	img, err := i.repo.GetImage(filename)
+	if err != nil {
+		log.Printf("[ImageService.dispatchImage] error when retrieve image with error %v \n", err)
+		return err
+	}
+	if !canTransition(img.CurrentStatus(), domain.ImageStatusQueued) {
+		return domain.ErrInvalidStatusTransition
+	}
+	entry := domain.NewOutboxEntry(filename, img.Attempts+1, time.Now().UnixMilli())
+	err = i.repo.CreateOutboxEntry(entry)
+	if err != nil {
+		log.Printf("[ImageService.dispatchImage] error when create outbox entry with error %v \n", err)
+		return err
+	}
+	return nil
+}
+
+func relayOutboxEntry(i *ImageService, entry domain.OutboxEntry) error {
+	_, transition, err := newStatusTransition(i, entry.Filename, domain.ImageStatusQueued)
+	if errors.Is(err, domain.ErrImageNotFound) || errors.Is(err, domain.ErrInvalidStatusTransition) {
+		// the image is gone or already past this dispatch, nothing to send
+		return i.repo.MarkOutboxEntrySent(entry.ID, time.Now().UnixMilli())
+	}
+	if err != nil {
+		return err
+	}
+	img, err := i.repo.GetImage(entry.Filename)
+	if err != nil {
+		return err
+	}
+
+	err = sendToPubsub(i, domain.SendToMLPayload{
+		Filename: img.Filename,
+		FileURL:  img.FileURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = i.repo.MarkImageDispatched(entry.Filename, *transition)
+	if err == nil {
+		publishStatusEvent(i, entry.Filename)
+	} else if !errors.Is(err, domain.ErrInvalidStatusTransition) {
+		log.Printf("[ImageService.relayOutboxEntry] error when mark image dispatched with error %v \n", err)
+	}
+	return i.repo.MarkOutboxEntrySent(entry.ID, time.Now().UnixMilli())
+}
+
+func relayOutbox(i *ImageService) error {
+	lock, err := acquireLease(i, outboxRelayLockName, i.outboxRelayInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	entries, err := i.repo.GetPendingOutboxEntries(time.Now().UnixMilli(), outboxRelayBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.relayOutbox] error when retrieve outbox entries with error %v \n", err)
+		return err
+	}
+	for _, entry := range entries {
+		if err = relayOutboxEntry(i, entry); err != nil {
+			log.Printf("[ImageService.relayOutbox] error when relay %v with error %v \n", entry.ID, err)
+			recordOutboxFailure(i, entry, err)
+		}
+	}
+	return nil
+}
+
+// recordOutboxFailure backs the entry off so a failing entry cannot hold the
+// head of the outbox, and dead-letters it after the last retry. The reaper
+// dispatches its image again once the image is stale.
+func recordOutboxFailure(i *ImageService, entry domain.OutboxEntry, cause error) {
+	now := time.Now()
+	entry.Retries++
+	entry.LastError = cause.Error()
+	if entry.Retries >= i.outboxMaxRetries {
+		entry.DeadLetteredAt = now.UnixMilli()
+		log.Printf("[ImageService.recordOutboxFailure] dead-lettered %v after %v retries \n", entry.ID, entry.Retries)
+	} else {
+		entry.NextAttemptAt = now.Add(redispatchDelay(outboxRetryBackoff, entry.Retries-1)).UnixMilli()
+	}
+	if err := i.repo.RecordOutboxFailure(entry); err != nil {
+		log.Printf("[ImageService.recordOutboxFailure] error when record failure of %v with error %v \n", entry.ID, err)
+	}
+}
+
+// StartOutboxRelay publishes pending outbox entries until ctx is cancelled.
+// An entry is only marked sent after the publish succeeds, so delivery to
+// the ML topic is at least once.
+func (i *ImageService) StartOutboxRelay(ctx context.Context) {
+	ticker := time.NewTicker(i.outboxRelayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := relayOutbox(i); err != nil {
+				log.Printf("[ImageService.StartOutboxRelay] error when relay outbox with error %v \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func TestDispatchImageRecordsNextAttempt(t *testing.T) {
+	repo := newFakeRepository()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Status: domain.ImageStatusFailed, Attempts: 2}
+	i := newTestService(repo)
+
+	if err := dispatchImage(i, "a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := repo.outbox["a.jpg-3"]
+	if !ok || entry.Attempt != 3 || entry.NextAttemptAt != entry.CreatedAt {
+		t.Fatalf("outbox = %+v", repo.outbox)
+	}
+}
+
+func TestDispatchImageRejectsFinishedImages(t *testing.T) {
+	repo := newFakeRepository()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Status: domain.ImageStatusDetected}
+	i := newTestService(repo)
+
+	if err := dispatchImage(i, "a.jpg"); !errors.Is(err, domain.ErrInvalidStatusTransition) {
+		t.Fatalf("dispatchImage = %v, want %v", err, domain.ErrInvalidStatusTransition)
+	}
+	if err := dispatchImage(i, "missing.jpg"); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("dispatchImage = %v, want %v", err, domain.ErrImageNotFound)
+	}
+	if len(repo.outbox) != 0 {
+		t.Fatalf("outbox = %+v", repo.outbox)
+	}
+}
+
+func TestRecordOutboxFailureBacksOff(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	entry := domain.NewOutboxEntry("a.jpg", 1, time.Now().UnixMilli())
+
+	var delays []time.Duration
+	for n := 0; n < 3; n++ {
+		before := time.Now()
+		recordOutboxFailure(i, entry, errors.New("publish failed"))
+		entry = repo.outbox[entry.ID]
+		delays = append(delays, time.UnixMilli(entry.NextAttemptAt).Sub(before).Round(time.Second))
+	}
+	if entry.Retries != 3 || entry.LastError != "publish failed" || entry.DeadLetteredAt != 0 {
+		t.Fatalf("entry = %+v", entry)
+	}
+	want := []time.Duration{outboxRetryBackoff, 2 * outboxRetryBackoff, 4 * outboxRetryBackoff}
+	for n := range want {
+		if delays[n] != want[n] {
+			t.Fatalf("retry delays = %v, want %v", delays, want)
+		}
+	}
+}
+
+func TestRecordOutboxFailureDeadLetters(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	entry := domain.NewOutboxEntry("a.jpg", 1, time.Now().UnixMilli())
+	entry.Retries = i.outboxMaxRetries - 1
+
+	recordOutboxFailure(i, entry, errors.New("publish failed"))
+	entry = repo.outbox[entry.ID]
+	if entry.Retries != i.outboxMaxRetries || entry.DeadLetteredAt == 0 {
+		t.Fatalf("entry = %+v, want it dead-lettered", entry)
+	}
+}
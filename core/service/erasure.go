@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image-service/core/domain"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultErasureInterval = 30 * time.Second
+	erasureLockName        = "account-erasure"
+	erasureBatchSize       = 50
+	erasureJobBatchSize    = 10
+)
+
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// eraseAccount works through the user's images in batches and saves its
+// progress after each one, so an interrupted job continues where it stopped.
+func eraseAccount(i *ImageService, job *domain.ErasureJob) error {
+	if job.Status == domain.ErasureStatusPending {
+		job.Status = domain.ErasureStatusRunning
+		job.StartedAt = time.Now().UnixMilli()
+		if err := i.repo.UpdateErasureJob(*job); err != nil {
+			return err
+		}
+	}
+
+	for {
+		images, err := i.repo.GetUserImageBatch(job.Email, erasureBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			break
+		}
+		removed := make([]string, 0, len(images))
+		for _, img := range images {
+			if job.Mode == domain.ErasureModeAnonymize && img.DeletedAt == 0 {
+				err = i.repo.AnonymizeImage(img.Filename, "anonymized:"+job.EmailHash)
+				if err == nil {
+					job.AnonymizedImages++
+				}
+			} else {
+				err = i.repo.DeleteImage(img.Filename)
+				if err == nil {
+					job.ErasedImages++
+				}
+			}
+			if err != nil && !errors.Is(err, domain.ErrImageNotFound) {
+				return err
+			}
+			removed = append(removed, img.Filename)
+		}
+		if err = i.repo.RecordErasedImages(job.ID, removed, time.Now().UnixMilli()); err != nil {
+			return err
+		}
+		if err = i.repo.UpdateErasureJob(*job); err != nil {
+			return err
+		}
+	}
+
+	exports, err := i.repo.ListUserExportJobs(job.Email)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err = i.repo.DeleteExportJob(export.ID); err != nil {
+			return err
+		}
+		job.DeletedExports++
+	}
+
+	job.DeletedWebhooks, err = i.repo.DeleteUserWebhooks(job.Email)
+	if err != nil {
+		return err
+	}
+	job.DeletedDevices, err = i.repo.DeleteUserDeviceTokens(job.Email)
+	if err != nil {
+		return err
+	}
+	if err = i.repo.DeleteUserIdempotencyKeys(job.Email); err != nil {
+		return err
+	}
+
+	job.Email = ""
+	job.Status = domain.ErasureStatusCompleted
+	job.CompletedAt = time.Now().UnixMilli()
+	return i.repo.UpdateErasureJob(*job)
+}
+
+func processErasures(i *ImageService) error {
+	lock, err := acquireLease(i, erasureLockName, i.erasureInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	jobs, err := i.repo.GetPendingErasureJobs(erasureJobBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.processErasures] error when retrieve erasure jobs with error %v \n", err)
+		return err
+	}
+	for _, job := range jobs {
+		if err = eraseAccount(i, &job); err != nil {
+			log.Printf("[ImageService.processErasures] error when erase account for job %v with error %v \n", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// EraseAccount records the erasure for an account deleted in the auth
+// service. Events are idempotent on their ID.
+func (i *ImageService) EraseAccount(event domain.AccountDeletedEvent) (*domain.ErasureJob, error) {
+	existing, err := i.repo.GetErasureJob(event.EventID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, domain.ErrErasureNotFound) {
+		log.Printf("[ImageService.EraseAccount] error when retrieve erasure job with error %v \n", err)
+		return nil, err
+	}
+
+	job := domain.ErasureJob{
+		ID:          event.EventID,
+		Email:       event.Email,
+		EmailHash:   hashEmail(event.Email),
+		Mode:        i.erasureMode,
+		Status:      domain.ErasureStatusPending,
+		RequestedAt: time.Now().UnixMilli(),
+	}
+	if err = i.repo.CreateErasureJob(job); err != nil {
+		log.Printf("[ImageService.EraseAccount] error when create erasure job with error %v \n", err)
+		return nil, err
+	}
+
+	go func() {
+		if err := processErasures(i); err != nil {
+			log.Printf("[ImageService.EraseAccount] error when process erasures with error %v \n", err)
+		}
+	}()
+	return &job, nil
+}
+
+// StartErasureWorker resumes erasure jobs that are still pending or were
+// interrupted.
+func (i *ImageService) StartErasureWorker(ctx context.Context) {
+	ticker := time.NewTicker(i.erasureInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := processErasures(i); err != nil {
+				log.Printf("[ImageService.StartErasureWorker] error when process erasures with error %v \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func TestEraseAccountRemovesEverythingOfTheUser(t *testing.T) {
+	const email = "user@example.com"
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	repo.images["a.jpg"] = domain.Image{Email: email, Filename: "a.jpg"}
+	repo.images["b.jpg"] = domain.Image{Email: email, Filename: "b.jpg"}
+	repo.images["other.jpg"] = domain.Image{Email: "other@example.com", Filename: "other.jpg"}
+	repo.exports["export-1"] = domain.ExportJob{ID: "export-1", Email: email}
+	repo.webhooks["webhook-1"] = domain.Webhook{ID: "webhook-1", Email: email}
+	repo.webhooks["webhook-2"] = domain.Webhook{ID: "webhook-2", Email: "other@example.com"}
+	repo.webhooks["webhook-3"] = domain.Webhook{ID: "webhook-3", Email: email, Organization: "acme"}
+	repo.devices["token-1"] = domain.DeviceToken{Token: "token-1", Email: email}
+	repo.devices["token-2"] = domain.DeviceToken{Token: "token-2", Email: email}
+	repo.idempotency[idempotencyID(email, "key-1")] = domain.IdempotencyRecord{Email: email, Key: "key-1", ExpiresAt: time.Now().Add(time.Hour)}
+	repo.idempotency[idempotencyID("other@example.com", "key-1")] = domain.IdempotencyRecord{Email: "other@example.com", Key: "key-1", ExpiresAt: time.Now().Add(time.Hour)}
+
+	job := domain.ErasureJob{
+		ID:     "event-1",
+		Email:  email,
+		Mode:   domain.ErasureModeDelete,
+		Status: domain.ErasureStatusPending,
+	}
+	if err := eraseAccount(i, &job); err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != domain.ErasureStatusCompleted || job.Email != "" {
+		t.Fatalf("job = %+v", job)
+	}
+	if job.ErasedImages != 2 || job.DeletedExports != 1 || job.DeletedWebhooks != 1 || job.DeletedDevices != 2 {
+		t.Fatalf("counts = %+v", job)
+	}
+	if _, ok := repo.webhooks["webhook-3"]; !ok {
+		t.Fatal("organization webhook was deleted with its creator")
+	}
+	if len(repo.images) != 1 || len(repo.exports) != 0 || len(repo.webhooks) != 2 || len(repo.devices) != 0 {
+		t.Fatalf("left %v images, %v exports, %v webhooks, %v devices", len(repo.images), len(repo.exports), len(repo.webhooks), len(repo.devices))
+	}
+	if _, ok := repo.idempotency[idempotencyID(email, "key-1")]; ok || len(repo.idempotency) != 1 {
+		t.Fatalf("idempotency records left: %v", repo.idempotency)
+	}
+	if got := repo.erased["event-1"]; len(got) != 2 || got[0] != "a.jpg" || got[1] != "b.jpg" {
+		t.Fatalf("recorded erased images %v", got)
+	}
+	if saved := repo.erasures["event-1"]; saved.Status != domain.ErasureStatusCompleted || saved.Email != "" {
+		t.Fatalf("saved job = %+v", saved)
+	}
+}
+
+func TestEraseAccountAnonymizesImages(t *testing.T) {
+	const email = "user@example.com"
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	repo.images["a.jpg"] = domain.Image{Email: email, Filename: "a.jpg"}
+
+	job := domain.ErasureJob{
+		ID:        "event-1",
+		Email:     email,
+		EmailHash: hashEmail(email),
+		Mode:      domain.ErasureModeAnonymize,
+		Status:    domain.ErasureStatusPending,
+	}
+	if err := eraseAccount(i, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.AnonymizedImages != 1 || repo.images["a.jpg"].Email != "anonymized:"+hashEmail(email) {
+		t.Fatalf("job = %+v, image = %+v", job, repo.images["a.jpg"])
+	}
+}
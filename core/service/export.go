@@ -0,0 +1,311 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"image-service/core/util"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultExportLinkTTL        = 24 * time.Hour
+	DefaultExportWorkerInterval = time.Minute
+	DefaultExportStaleAfter     = 10 * time.Minute
+	DefaultExportRateLimit      = 3
+	DefaultExportRateWindow     = 24 * time.Hour
+	MaxExportLinkTTL            = 7 * 24 * time.Hour
+	exportWorkerLockName        = "export-worker"
+	exportWorkerBatchSize       = 20
+	exportProgressBatch         = 10
+	exportHeartbeat             = time.Minute
+	exportMetadataCSVName       = "images.csv"
+	exportMetadataName          = "images.json"
+)
+
+var exportCSVHeader = []string{
+	"filename", "status", "label", "confidence", "inferenceTime", "createdAt",
+	"detectedAt", "deletedAt", "failureCode", "failureMessage", "statusTimestamps",
+}
+
+func exportCSVRecord(img domain.Image) []string {
+	failureCode, failureMessage := "", ""
+	if img.Failure != nil {
+		failureCode = img.Failure.Code
+		failureMessage = img.Failure.Message
+	}
+	timestamps, _ := json.Marshal(img.StatusTimestamps)
+	return []string{
+		img.Filename,
+		string(img.Status),
+		img.Label,
+		strconv.FormatFloat(img.Confidence, 'f', -1, 64),
+		strconv.FormatInt(img.InferenceTime, 10),
+		strconv.FormatInt(img.CreatedAt, 10),
+		strconv.FormatInt(img.DetectedAt, 10),
+		strconv.FormatInt(img.DeletedAt, 10),
+		failureCode,
+		failureMessage,
+		string(timestamps),
+	}
+}
+
+// exportLinkTTL reads EXPORT_LINK_TTL, a V4 signed URL is valid for at most
+// seven days.
+func exportLinkTTL() (time.Duration, error) {
+	ttl := util.GetEnvDuration("EXPORT_LINK_TTL", DefaultExportLinkTTL)
+	if ttl <= 0 || ttl > MaxExportLinkTTL {
+		return 0, fmt.Errorf("EXPORT_LINK_TTL must be positive and at most %v, got %v", MaxExportLinkTTL, ttl)
+	}
+	return ttl, nil
+}
+
+// saveExportJob stores the job with a fresh heartbeat, the export worker
+// restarts jobs whose heartbeat stopped.
+func saveExportJob(i *ImageService, job *domain.ExportJob) error {
+	job.UpdatedAt = time.Now().UnixMilli()
+	return i.repo.UpdateExportJob(*job)
+}
+
+func writeExportArchive(i *ImageService, job *domain.ExportJob, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	images := []domain.Image{}
+
+	err := i.repo.ForEachUserImage(job.Email, func(img domain.Image) error {
+		img.FileURL = ""
+		images = append(images, img)
+		job.ProcessedImages++
+		defer func() {
+			if job.ProcessedImages%exportProgressBatch == 0 || time.Since(time.UnixMilli(job.UpdatedAt)) > exportHeartbeat {
+				_ = saveExportJob(i, job)
+			}
+		}()
+
+		// the metadata is still exported when the original is gone, only
+		// images with a blob get an entry in the archive
+		if img.OriginalDeletedAt > 0 {
+			return nil
+		}
+		blob, err := i.repo.OpenImageBlob(img.Filename)
+		if err != nil {
+			log.Printf("[ImageService.writeExportArchive] skip missing blob %v with error %v \n", img.Filename, err)
+			job.MissingImages++
+			return nil
+		}
+		defer blob.Close()
+
+		f, err := archive.Create(fmt.Sprintf("images/%v.jpg", img.Filename))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, blob)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := archive.Create(exportMetadataName)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(images); err != nil {
+		return err
+	}
+
+	f, err = archive.Create(exportMetadataCSVName)
+	if err != nil {
+		return err
+	}
+	records := csv.NewWriter(f)
+	_ = records.Write(exportCSVHeader)
+	for _, img := range images {
+		_ = records.Write(exportCSVRecord(img))
+	}
+	records.Flush()
+	if err = records.Error(); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func runExport(i *ImageService, job domain.ExportJob) {
+	job.Status = domain.ExportStatusRunning
+	job.ProcessedImages = 0
+	job.MissingImages = 0
+	total, err := i.repo.CountUserImages(job.Email)
+	if err == nil {
+		job.TotalImages = total
+	}
+	_ = saveExportJob(i, &job)
+
+	// cancelling the upload before Close keeps a failed export from
+	// finalizing a partial archive
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := i.repo.NewExportArchiveWriter(ctx, job.ID)
+	err = writeExportArchive(i, &job, w)
+	if err != nil {
+		cancel()
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+
+	// failed jobs expire too, so the sweep removes anything an upload left
+	now := time.Now()
+	job.CompletedAt = now.UnixMilli()
+	job.ExpiresAt = now.Add(i.exportLinkTTL).UnixMilli()
+	if err != nil {
+		log.Printf("[ImageService.runExport] error when export %v with error %v \n", job.ID, err)
+		job.Status = domain.ExportStatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = domain.ExportStatusCompleted
+	}
+	if err = saveExportJob(i, &job); err != nil {
+		log.Printf("[ImageService.runExport] error when update export %v with error %v \n", job.ID, err)
+	}
+}
+
+// checkExportRate allows one unfinished export per user and at most
+// exportRateLimit exports per window, an export copies every blob the user
+// owns. It runs in the transaction that creates the job.
+func checkExportRate(i *ImageService, jobs []domain.ExportJob, now time.Time) error {
+	since := now.Add(-i.exportRateWindow).UnixMilli()
+	recent := 0
+	for _, job := range jobs {
+		if job.Status == domain.ExportStatusPending || job.Status == domain.ExportStatusRunning {
+			return domain.ErrExportRateLimited.Errorf("export %v is still running", job.ID)
+		}
+		if job.CreatedAt > since {
+			recent++
+		}
+	}
+	if recent >= i.exportRateLimit {
+		return domain.ErrExportRateLimited.Errorf("at most %v exports per %v", i.exportRateLimit, i.exportRateWindow)
+	}
+	return nil
+}
+
+// CreateExport starts building a ZIP of every image the user owns. The job is
+// returned right away and its progress is read with GetExport.
+func (i *ImageService) CreateExport(email string) (*domain.ExportJob, error) {
+	now := time.Now()
+	job := domain.ExportJob{
+		ID:        uuid.NewString(),
+		Email:     email,
+		Status:    domain.ExportStatusPending,
+		CreatedAt: now.UnixMilli(),
+		UpdatedAt: now.UnixMilli(),
+	}
+	err := i.repo.CreateExportJob(job, func(jobs []domain.ExportJob) error {
+		return checkExportRate(i, jobs, now)
+	})
+	if errors.Is(err, domain.ErrExportRateLimited) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("[ImageService.CreateExport] error when create export job with error %v \n", err)
+		return nil, err
+	}
+	go runExport(i, job)
+	return &job, nil
+}
+
+func (i *ImageService) GetExport(email, id string) (*domain.ExportJob, error) {
+	job, err := i.repo.GetExportJob(id)
+	if err != nil {
+		log.Printf("[ImageService.GetExport] error when retrieve export job with error %v \n", err)
+		return nil, err
+	}
+	if job.Email != email {
+		return nil, domain.ErrExportNotFound
+	}
+	if job.Status != domain.ExportStatusCompleted {
+		return job, nil
+	}
+
+	expires := time.UnixMilli(job.ExpiresAt)
+	if !expires.After(time.Now()) {
+		job.Status = domain.ExportStatusExpired
+		return job, nil
+	}
+	job.DownloadURL, err = i.repo.GenerateExportURL(job.ID, expires)
+	if err != nil {
+		log.Printf("[ImageService.GetExport] error when generate download url with error %v \n", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// maintainExports restarts exports whose replica stopped running them and
+// deletes archives after their link expired, or of exports that failed.
+func maintainExports(i *ImageService) error {
+	lock, err := acquireLease(i, exportWorkerLockName, i.exportWorkerInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	now := time.Now()
+	stale, err := i.repo.GetStaleExportJobs(now.Add(-i.exportStaleAfter).UnixMilli(), exportWorkerBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.maintainExports] error when retrieve stale exports with error %v \n", err)
+		return err
+	}
+	for _, job := range stale {
+		// claim the job before starting it so the next pass leaves it alone
+		if err = saveExportJob(i, &job); err != nil {
+			log.Printf("[ImageService.maintainExports] error when claim export %v with error %v \n", job.ID, err)
+			continue
+		}
+		log.Printf("[ImageService.maintainExports] restarting stale export %v \n", job.ID)
+		go runExport(i, job)
+	}
+
+	expired, err := i.repo.GetExpiredExportJobs(now.UnixMilli(), exportWorkerBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.maintainExports] error when retrieve expired exports with error %v \n", err)
+		return err
+	}
+	for _, job := range expired {
+		if err = i.repo.DeleteExportArchive(job.ID); err != nil {
+			log.Printf("[ImageService.maintainExports] error when delete archive of %v with error %v \n", job.ID, err)
+			continue
+		}
+		job.Status = domain.ExportStatusExpired
+		if err = saveExportJob(i, &job); err != nil {
+			log.Printf("[ImageService.maintainExports] error when expire export %v with error %v \n", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// StartExportWorker maintains export jobs until ctx is cancelled.
+func (i *ImageService) StartExportWorker(ctx context.Context) {
+	ticker := time.NewTicker(i.exportWorkerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := maintainExports(i); err != nil {
+				log.Printf("[ImageService.StartExportWorker] error when maintain exports with error %v \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"image-service/core/util"
+	"testing"
+	"time"
+)
+
+func newExportTestService(repo *fakeRepository) *ImageService {
+	i := newTestService(repo)
+	i.exportRateLimit = 2
+	i.exportRateWindow = time.Hour
+	return i
+}
+
+// userExports reads the jobs CreateExportJob hands to the rate check.
+func userExports(repo *fakeRepository, email string) []domain.ExportJob {
+	jobs, _ := repo.ListUserExportJobs(email)
+	return jobs
+}
+
+func TestCheckExportRateAllowsOneRunningExport(t *testing.T) {
+	repo := newFakeRepository()
+	i := newExportTestService(repo)
+	now := time.Now()
+
+	if err := checkExportRate(i, userExports(repo, "user@example.com"), now); err != nil {
+		t.Fatal(err)
+	}
+	repo.exports["running"] = domain.ExportJob{ID: "running", Email: "user@example.com", Status: domain.ExportStatusRunning, CreatedAt: now.Add(-2 * time.Hour).UnixMilli()}
+	if err := checkExportRate(i, userExports(repo, "user@example.com"), now); !errors.Is(err, domain.ErrExportRateLimited) {
+		t.Fatalf("checkExportRate = %v, want %v", err, domain.ErrExportRateLimited)
+	}
+	// other users' exports don't count
+	if err := checkExportRate(i, userExports(repo, "other@example.com"), now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckExportRateLimitsPerWindow(t *testing.T) {
+	repo := newFakeRepository()
+	i := newExportTestService(repo)
+	now := time.Now()
+
+	repo.exports["old"] = domain.ExportJob{ID: "old", Email: "user@example.com", Status: domain.ExportStatusCompleted, CreatedAt: now.Add(-2 * time.Hour).UnixMilli()}
+	repo.exports["recent"] = domain.ExportJob{ID: "recent", Email: "user@example.com", Status: domain.ExportStatusCompleted, CreatedAt: now.Add(-time.Minute).UnixMilli()}
+	if err := checkExportRate(i, userExports(repo, "user@example.com"), now); err != nil {
+		t.Fatalf("checkExportRate = %v, the old export is outside the window", err)
+	}
+
+	repo.exports["failed"] = domain.ExportJob{ID: "failed", Email: "user@example.com", Status: domain.ExportStatusFailed, CreatedAt: now.Add(-time.Minute).UnixMilli()}
+	if err := checkExportRate(i, userExports(repo, "user@example.com"), now); !errors.Is(err, domain.ErrExportRateLimited) {
+		t.Fatalf("checkExportRate = %v, want %v", err, domain.ErrExportRateLimited)
+	}
+	if err := checkExportRate(i, userExports(repo, "user@example.com"), now.Add(time.Hour)); err != nil {
+		t.Fatalf("checkExportRate = %v after the window passed", err)
+	}
+}
+
+func TestExportDetectionsWalksEveryPage(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	for n := 0; n < 2*util.MaxPageSize+1; n++ {
+		filename := fmt.Sprintf("%04d.jpg", n)
+		repo.images[filename] = domain.Image{Email: "user@example.com", Filename: filename, CreatedAt: int64(n)}
+	}
+	repo.images["other.jpg"] = domain.Image{Email: "other@example.com", Filename: "other.jpg"}
+
+	var exported []string
+	err := i.ExportDetections("user@example.com", domain.PageFilter{PerPage: 5, After: "ignored"}, func(img domain.Image) error {
+		exported = append(exported, img.Filename)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exported) != 2*util.MaxPageSize+1 {
+		t.Fatalf("exported %v images, want every image of the user", len(exported))
+	}
+	if exported[0] != "0200.jpg" || exported[len(exported)-1] != "0000.jpg" {
+		t.Fatalf("exported %v ... %v, want newest to oldest", exported[0], exported[len(exported)-1])
+	}
+	if repo.pageQueries != 3 {
+		t.Fatalf("queried %v pages, want 3", repo.pageQueries)
+	}
+}
+
+func TestExportDetectionsStopsOnCallbackError(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	for n := 0; n < util.MaxPageSize+1; n++ {
+		filename := fmt.Sprintf("%04d.jpg", n)
+		repo.images[filename] = domain.Image{Email: "user@example.com", Filename: filename, CreatedAt: int64(n)}
+	}
+
+	failed := errors.New("client went away")
+	err := i.ExportDetections("user@example.com", domain.PageFilter{}, func(domain.Image) error {
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("ExportDetections = %v, want %v", err, failed)
+	}
+	if repo.pageQueries != 1 {
+		t.Fatalf("queried %v pages, want to stop after the first", repo.pageQueries)
+	}
+}
+
+func TestCreateExportChecksRateWithTheCreate(t *testing.T) {
+	repo := newFakeRepository()
+	i := newExportTestService(repo)
+	repo.exports["running"] = domain.ExportJob{ID: "running", Email: "user@example.com", Status: domain.ExportStatusRunning}
+
+	if _, err := i.CreateExport("user@example.com"); !errors.Is(err, domain.ErrExportRateLimited) {
+		t.Fatalf("CreateExport = %v, want %v", err, domain.ErrExportRateLimited)
+	}
+	if len(repo.exports) != 1 {
+		t.Fatalf("stored %v jobs, want the rejected export left out", len(repo.exports))
+	}
+}
+
+func newExportJob(repo *fakeRepository) domain.ExportJob {
+	repo.images["a.jpg"] = domain.Image{Email: "user@example.com", Filename: "a.jpg"}
+	repo.blobs["a.jpg"] = domain.BlobInfo{Name: "a.jpg", Filename: "a.jpg"}
+	job := domain.ExportJob{ID: "export", Email: "user@example.com", Status: domain.ExportStatusPending}
+	repo.exports[job.ID] = job
+	return job
+}
+
+func TestRunExportStoresArchive(t *testing.T) {
+	repo := newFakeRepository()
+	i := newExportTestService(repo)
+	i.exportLinkTTL = time.Hour
+
+	runExport(i, newExportJob(repo))
+
+	job := repo.exports["export"]
+	if job.Status != domain.ExportStatusCompleted || job.ProcessedImages != 1 {
+		t.Fatalf("job = %+v, want a completed export of one image", job)
+	}
+	if job.ExpiresAt <= time.Now().UnixMilli() {
+		t.Fatalf("expiresAt = %v, want the link TTL ahead", job.ExpiresAt)
+	}
+	if len(repo.archives["export"]) == 0 {
+		t.Fatal("archive was not stored")
+	}
+}
+
+func TestRunExportDiscardsPartialArchive(t *testing.T) {
+	repo := newFakeRepository()
+	i := newExportTestService(repo)
+	i.exportLinkTTL = time.Hour
+	repo.failArchiveWrites = true
+
+	runExport(i, newExportJob(repo))
+
+	job := repo.exports["export"]
+	if job.Status != domain.ExportStatusFailed || job.Error == "" {
+		t.Fatalf("job = %+v, want a failed export", job)
+	}
+	if _, ok := repo.archives["export"]; ok {
+		t.Fatal("a failed export stored its partial archive")
+	}
+	if job.ExpiresAt == 0 {
+		t.Fatal("failed export has no expiry, the sweep would never remove it")
+	}
+}
+
+func TestMaintainExportsExpiresFailedExports(t *testing.T) {
+	repo := newFakeRepository()
+	i := newExportTestService(repo)
+	i.exportWorkerInterval = time.Minute
+	past := time.Now().Add(-time.Minute).UnixMilli()
+	repo.exports["completed"] = domain.ExportJob{ID: "completed", Status: domain.ExportStatusCompleted, ExpiresAt: past, UpdatedAt: past}
+	repo.exports["failed"] = domain.ExportJob{ID: "failed", Status: domain.ExportStatusFailed, ExpiresAt: past, UpdatedAt: past}
+	repo.archives["completed"] = []byte("zip")
+	repo.archives["failed"] = []byte("partial")
+
+	if err := maintainExports(i); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"completed", "failed"} {
+		if repo.exports[id].Status != domain.ExportStatusExpired {
+			t.Errorf("%v status = %v, want expired", id, repo.exports[id].Status)
+		}
+		if _, ok := repo.archives[id]; ok {
+			t.Errorf("%v archive was not deleted", id)
+		}
+	}
+}
+
+func TestExportLinkTTLIsLimitedBySignedURLs(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"":     true,
+		"48h":  true,
+		"168h": true,
+		"169h": false,
+		"0s":   false,
+	} {
+		t.Setenv("EXPORT_LINK_TTL", raw)
+		if _, err := exportLinkTTL(); (err == nil) != ok {
+			t.Errorf("exportLinkTTL with %q = %v", raw, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultEventBacklog    = 50
+	DefaultEventBacklogTTL = 10 * time.Minute
+	eventSubscriberBuffer  = 16
+)
+
+type eventSubscriber struct {
+	ch chan domain.DetectionEvent
+}
+
+type eventLog struct {
+	events []domain.DetectionEvent
+	seenAt time.Time
+}
+
+// eventHub fans detection events out to the open connections of each user.
+// It keeps a short backlog per user so reconnecting clients can resume from
+// their last event ID.
+type eventHub struct {
+	mu          sync.Mutex
+	backlog     int
+	backlogTTL  time.Duration
+	lastPrune   time.Time
+	logs        map[string]*eventLog
+	subscribers map[string]map[*eventSubscriber]struct{}
+}
+
+func newEventHub(backlog int, backlogTTL time.Duration) *eventHub {
+	return &eventHub{
+		backlog:     backlog,
+		backlogTTL:  backlogTTL,
+		lastPrune:   time.Now(),
+		logs:        map[string]*eventLog{},
+		subscribers: map[string]map[*eventSubscriber]struct{}{},
+	}
+}
+
+func newEventID(at time.Time) string {
+	return fmt.Sprintf("%d-%s", at.UnixMilli(), strings.Split(uuid.NewString(), "-")[0])
+}
+
+func eventIDMillis(id string) (int64, bool) {
+	prefix, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(prefix, 10, 64)
+	return ms, err == nil
+}
+
+func (h *eventHub) dispatch(event domain.DetectionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	entries, ok := h.logs[event.Email]
+	if !ok {
+		entries = &eventLog{}
+		h.logs[event.Email] = entries
+	}
+	entries.events = append(entries.events, event)
+	if len(entries.events) > h.backlog {
+		entries.events = entries.events[len(entries.events)-h.backlog:]
+	}
+	entries.seenAt = now
+
+	for sub := range h.subscribers[event.Email] {
+		select {
+		case sub.ch <- event:
+		default:
+			// a slow consumer is disconnected instead of silently missing
+			// events, it resumes from the backlog when it reconnects
+			log.Printf("[eventHub.dispatch] dropping slow subscriber of %v \n", event.Email)
+			delete(h.subscribers[event.Email], sub)
+			close(sub.ch)
+		}
+	}
+	if len(h.subscribers[event.Email]) == 0 {
+		delete(h.subscribers, event.Email)
+	}
+
+	if now.Sub(h.lastPrune) > h.backlogTTL {
+		for email, l := range h.logs {
+			if now.Sub(l.seenAt) > h.backlogTTL && len(h.subscribers[email]) == 0 {
+				delete(h.logs, email)
+			}
+		}
+		h.lastPrune = now
+	}
+}
+
+// since returns the buffered events that came after lastEventID. Unknown IDs
+// fall back to comparing the timestamp prefix.
+func (h *eventHub) since(email, lastEventID string) []domain.DetectionEvent {
+	entries, ok := h.logs[email]
+	if !ok || lastEventID == "" {
+		return nil
+	}
+	for idx, event := range entries.events {
+		if event.ID == lastEventID {
+			return append([]domain.DetectionEvent{}, entries.events[idx+1:]...)
+		}
+	}
+	ms, ok := eventIDMillis(lastEventID)
+	if !ok {
+		return nil
+	}
+	events := []domain.DetectionEvent{}
+	for _, event := range entries.events {
+		if eventMs, ok := eventIDMillis(event.ID); ok && eventMs > ms {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (h *eventHub) subscribe(email, lastEventID string) ([]domain.DetectionEvent, <-chan domain.DetectionEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &eventSubscriber{
+		ch: make(chan domain.DetectionEvent, eventSubscriberBuffer),
+	}
+	if _, ok := h.subscribers[email]; !ok {
+		h.subscribers[email] = map[*eventSubscriber]struct{}{}
+	}
+	h.subscribers[email][sub] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[email], sub)
+			if len(h.subscribers[email]) == 0 {
+				delete(h.subscribers, email)
+			}
+		})
+	}
+	return h.since(email, lastEventID), sub.ch, unsubscribe
+}
+
+// publishStatusEvent announces the image's current status in the
+// background, so the broker, webhooks and push notifications never slow down
+// or fail the operation that changed the status.
+func publishStatusEvent(i *ImageService, filename string) {
+	go func() {
+		img, err := i.repo.GetImage(filename)
+		if err != nil {
+			log.Printf("[ImageService.publishStatusEvent] error when retrieve image for event with error %v \n", err)
+			return
+		}
+		if img.CurrentStatus() != domain.ImageStatusDetected {
+			publishDetectionEvent(i, domain.EventImageStatusChanged, img)
+			return
+		}
+		publishDetectionEvent(i, domain.EventDetectionCompleted, img)
+		notifyDetection(i, *img)
+	}()
+}
+
+func publishDetectionEvent(i *ImageService, eventType string, img *domain.Image) {
+	now := time.Now()
+	event := domain.DetectionEvent{
+		ID:       newEventID(now),
+		Type:     eventType,
+		Email:    img.Email,
+		Filename: img.Filename,
+		Status:   img.CurrentStatus(),
+		Image:    img,
+		At:       now.UnixMilli(),
+	}
+	if err := i.broker.Publish(event); err != nil {
+		log.Printf("[ImageService.publishDetectionEvent] error when publish event for %v with error %v \n", img.Filename, err)
+	}
+	enqueueWebhookDeliveries(i, event)
+}
+
+func (i *ImageService) SubscribeDetectionEvents(email, lastEventID string) ([]domain.DetectionEvent, <-chan domain.DetectionEvent, func()) {
+	return i.hub.subscribe(email, lastEventID)
+}
+
+// StartEventHub feeds events from the broker into the hub until ctx is done.
+func (i *ImageService) StartEventHub(ctx context.Context) {
+	for {
+		err := i.broker.Subscribe(ctx, i.hub.dispatch)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[ImageService.StartEventHub] event subscription stopped with error %v, retrying \n", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func testEvent(email string, n int) domain.DetectionEvent {
+	return domain.DetectionEvent{
+		ID:       fmt.Sprintf("%d-%04d", 1000+n, n),
+		Type:     domain.EventImageStatusChanged,
+		Email:    email,
+		Filename: fmt.Sprintf("%d.jpg", n),
+	}
+}
+
+func eventIDs(events []domain.DetectionEvent) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestEventHubDeliversToOwner(t *testing.T) {
+	hub := newEventHub(DefaultEventBacklog, DefaultEventBacklogTTL)
+	_, events, unsubscribe := hub.subscribe("user@example.com", "")
+	defer unsubscribe()
+	_, others, unsubscribeOther := hub.subscribe("other@example.com", "")
+	defer unsubscribeOther()
+
+	hub.dispatch(testEvent("user@example.com", 1))
+	if event := <-events; event.Filename != "1.jpg" {
+		t.Fatalf("event = %+v", event)
+	}
+	select {
+	case event := <-others:
+		t.Fatalf("another user received %+v", event)
+	default:
+	}
+}
+
+func TestEventHubResumesFromBacklog(t *testing.T) {
+	hub := newEventHub(3, DefaultEventBacklogTTL)
+	for n := 1; n <= 5; n++ {
+		hub.dispatch(testEvent("user@example.com", n))
+	}
+
+	for lastEventID, want := range map[string]string{
+		"":                  "[]",
+		testEvent("", 3).ID: fmt.Sprint([]string{testEvent("", 4).ID, testEvent("", 5).ID}),
+		"1003-unknown":      fmt.Sprint([]string{testEvent("", 4).ID, testEvent("", 5).ID}),
+		testEvent("", 1).ID: fmt.Sprint([]string{testEvent("", 3).ID, testEvent("", 4).ID, testEvent("", 5).ID}),
+		"not-an-id":         "[]",
+	} {
+		backlog, _, unsubscribe := hub.subscribe("user@example.com", lastEventID)
+		unsubscribe()
+		if got := fmt.Sprint(eventIDs(backlog)); got != want {
+			t.Errorf("backlog since %q = %v, want %v", lastEventID, got, want)
+		}
+	}
+}
+
+func TestEventHubClosesLaggingSubscribers(t *testing.T) {
+	hub := newEventHub(DefaultEventBacklog, DefaultEventBacklogTTL)
+	_, events, unsubscribe := hub.subscribe("user@example.com", "")
+	defer unsubscribe()
+
+	for n := 0; n <= eventSubscriberBuffer; n++ {
+		hub.dispatch(testEvent("user@example.com", n))
+	}
+	received := 0
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, open := <-events:
+			if !open {
+				if received != eventSubscriberBuffer {
+					t.Fatalf("received %v events before the close, want %v", received, eventSubscriberBuffer)
+				}
+				return
+			}
+			received++
+		case <-timeout:
+			t.Fatal("the lagging subscriber was not closed")
+		}
+	}
+}
+
+func TestEventHubUnsubscribe(t *testing.T) {
+	hub := newEventHub(DefaultEventBacklog, DefaultEventBacklogTTL)
+	_, events, unsubscribe := hub.subscribe("user@example.com", "")
+	unsubscribe()
+	unsubscribe()
+
+	hub.dispatch(testEvent("user@example.com", 1))
+	select {
+	case event := <-events:
+		t.Fatalf("unsubscribed channel received %+v", event)
+	default:
+	}
+	if len(hub.subscribers) != 0 {
+		t.Fatalf("subscribers = %v", hub.subscribers)
+	}
+}
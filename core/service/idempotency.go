@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image-service/core/domain"
+	"io"
+	"log"
+	"mime/multipart"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+	MaxIdempotencyKeyLength  = 255
+
+	// idempotencyLease bounds how long a key stays reserved by a request
+	// that never finished, e.g. because the replica crashed mid upload.
+	idempotencyLease = 2 * time.Minute
+
+	DefaultIdempotencyCleanupInterval = time.Hour
+	idempotencyCleanupLockName        = "idempotency-cleanup"
+	idempotencyCleanupBatchSize       = 400
+)
+
+func hashImage(image multipart.File) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, image); err != nil {
+		return "", err
+	}
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// UploadImageWithKey uploads image once per key of the uploader. A retry of
+// the same image returns the stored response and true, a different image
+// with the same key is rejected.
+func (i *ImageService) UploadImageWithKey(uploader domain.Uploader, key string, image multipart.File) (*domain.UploadImageResponse, bool, error) {
+	if strings.TrimSpace(key) == "" || len(key) > MaxIdempotencyKeyLength {
+		return nil, false, domain.ErrInvalidIdempotencyKey.Errorf("idempotency key must be 1 to %v characters", MaxIdempotencyKeyLength)
+	}
+	requestHash, err := hashImage(image)
+	if err != nil {
+		log.Printf("[ImageService.UploadImageWithKey] error when hash image with error %v \n", err)
+		return nil, false, err
+	}
+
+	now := time.Now()
+	existing, err := i.repo.ReserveIdempotencyKey(domain.IdempotencyRecord{
+		Email:       uploader.Email,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      domain.IdempotencyStatusPending,
+		CreatedAt:   now.UnixMilli(),
+		ExpiresAt:   now.Add(idempotencyLease),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return replayIdempotentUpload(*existing, requestHash)
+	}
+
+	res, err := i.UploadImage(uploader, image)
+	if err != nil {
+		// a failed upload stored nothing, free the key so the client can retry
+		if releaseErr := i.repo.DeleteIdempotencyKey(uploader.Email, key); releaseErr != nil {
+			log.Printf("[ImageService.UploadImageWithKey] error when release idempotency key with error %v \n", releaseErr)
+		}
+		return nil, false, err
+	}
+
+	response, err := json.Marshal(res)
+	if err == nil {
+		err = i.repo.CompleteIdempotencyKey(uploader.Email, key, string(response), time.Now().Add(i.idempotencyKeyTTL))
+	}
+	if err != nil {
+		// the image is stored, a retry after the lease uploads it again
+		log.Printf("[ImageService.UploadImageWithKey] error when store response of idempotency key with error %v \n", err)
+	}
+	return res, false, nil
+}
+
+func replayIdempotentUpload(record domain.IdempotencyRecord, requestHash string) (*domain.UploadImageResponse, bool, error) {
+	if record.RequestHash != requestHash {
+		return nil, false, domain.ErrIdempotencyKeyReused
+	}
+	if record.Status != domain.IdempotencyStatusCompleted {
+		return nil, false, domain.ErrIdempotencyKeyInUse
+	}
+
+	var res domain.UploadImageResponse
+	if err := json.Unmarshal([]byte(record.Response), &res); err != nil {
+		log.Printf("[ImageService.UploadImageWithKey] error when decode stored response with error %v \n", err)
+		return nil, false, err
+	}
+	return &res, true, nil
+}
+
+// purgeIdempotencyKeys deletes expired records in batches until none are
+// left. The TTL policy does the same, this keeps the collection bounded where
+// the policy isn't set up.
+func purgeIdempotencyKeys(i *ImageService) error {
+	lock, err := acquireLease(i, idempotencyCleanupLockName, i.idempotencyCleanupInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	for {
+		deleted, err := i.repo.DeleteExpiredIdempotencyKeys(time.Now(), idempotencyCleanupBatchSize)
+		if err != nil {
+			log.Printf("[ImageService.purgeIdempotencyKeys] error when delete expired keys with error %v \n", err)
+			return err
+		}
+		if deleted < idempotencyCleanupBatchSize {
+			return nil
+		}
+	}
+}
+
+func (i *ImageService) StartIdempotencyCleanup(ctx context.Context) {
+	ticker := time.NewTicker(i.idempotencyCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := purgeIdempotencyKeys(i); err != nil {
+				log.Printf("[ImageService.StartIdempotencyCleanup] error when purge idempotency keys with error %v \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func TestUploadImageWithKeyReplaysRetries(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	uploader := domain.Uploader{Email: "user@example.com"}
+
+	first, replayed, err := i.UploadImageWithKey(uploader, "key-1", newTestFile("leaf"))
+	if err != nil || replayed {
+		t.Fatalf("first upload = %+v, %v, %v", first, replayed, err)
+	}
+	again, replayed, err := i.UploadImageWithKey(uploader, "key-1", newTestFile("leaf"))
+	if err != nil || !replayed || *again != *first {
+		t.Fatalf("retry = %+v, %v, %v, want %+v replayed", again, replayed, err, first)
+	}
+	if repo.uploads != 1 {
+		t.Fatalf("stored %v uploads, want 1", repo.uploads)
+	}
+
+	if _, _, err = i.UploadImageWithKey(uploader, "key-1", newTestFile("other")); !errors.Is(err, domain.ErrIdempotencyKeyReused) {
+		t.Fatalf("different image = %v, want %v", err, domain.ErrIdempotencyKeyReused)
+	}
+	// keys are scoped to their user
+	if _, replayed, err = i.UploadImageWithKey(domain.Uploader{Email: "other@example.com"}, "key-1", newTestFile("other")); err != nil || replayed {
+		t.Fatalf("other user = %v, %v", replayed, err)
+	}
+}
+
+func TestUploadImageWithKeyStoresExpiryAsTime(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	before := time.Now()
+	if _, _, err := i.UploadImageWithKey(domain.Uploader{Email: "user@example.com"}, "key-1", newTestFile("leaf")); err != nil {
+		t.Fatal(err)
+	}
+	record := repo.idempotency[idempotencyID("user@example.com", "key-1")]
+	if record.ExpiresAt.Before(before.Add(DefaultIdempotencyKeyTTL)) || record.ExpiresAt.After(time.Now().Add(DefaultIdempotencyKeyTTL)) {
+		t.Fatalf("expiresAt = %v, want about %v from now", record.ExpiresAt, DefaultIdempotencyKeyTTL)
+	}
+}
+
+func TestPurgeIdempotencyKeysDeletesExpiredRecords(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	now := time.Now()
+	for n := 0; n < idempotencyCleanupBatchSize+10; n++ {
+		repo.idempotency[fmt.Sprint("expired-", n)] = domain.IdempotencyRecord{ExpiresAt: now.Add(-time.Minute)}
+	}
+	repo.idempotency["live"] = domain.IdempotencyRecord{ExpiresAt: now.Add(time.Hour)}
+
+	if err := purgeIdempotencyKeys(i); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.idempotency["live"]; !ok || len(repo.idempotency) != 1 {
+		t.Fatalf("%v records left, want only the live one", len(repo.idempotency))
+	}
+	if len(repo.locks) != 0 {
+		t.Fatalf("locks left behind: %v", repo.locks)
+	}
+}
+
+func TestPurgeIdempotencyKeysSkipsWhenLocked(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	repo.locks[idempotencyCleanupLockName] = "other-instance"
+	repo.idempotency["expired"] = domain.IdempotencyRecord{ExpiresAt: time.Now().Add(-time.Minute)}
+
+	if err := purgeIdempotencyKeys(i); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.idempotency) != 1 {
+		t.Fatal("purged while another replica held the lock")
+	}
+}
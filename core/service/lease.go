@@ -0,0 +1,75 @@
+package service
+
+import (
+	"log"
+	"time"
+)
+
+// minLeaseRenewal keeps short worker intervals from renewing a lease in a
+// tight loop.
+const minLeaseRenewal = time.Second
+
+// lease is a lock held by this replica for one pass of a worker. It is
+// renewed in the background, so a pass that outlasts the TTL keeps the lock
+// until Release instead of letting another replica start the same work.
+type lease struct {
+	i    *ImageService
+	name string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// acquireLease returns nil without an error when another replica holds the
+// lock.
+func acquireLease(i *ImageService, name string, ttl time.Duration) (*lease, error) {
+	acquired, err := i.repo.AcquireLock(name, i.instanceID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, nil
+	}
+	l := &lease{
+		i:    i,
+		name: name,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go l.renew(ttl)
+	return l, nil
+}
+
+func (l *lease) renew(ttl time.Duration) {
+	defer close(l.done)
+	every := ttl / 3
+	if every < minLeaseRenewal {
+		every = minLeaseRenewal
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			acquired, err := l.i.repo.AcquireLock(l.name, l.i.instanceID, ttl)
+			if err != nil {
+				log.Printf("[lease.renew] error when renew lock %v with error %v \n", l.name, err)
+				continue
+			}
+			if !acquired {
+				log.Printf("[lease.renew] lock %v was taken over by another replica \n", l.name)
+				return
+			}
+		}
+	}
+}
+
+// Release stops the renewal and frees the lock for the next pass.
+func (l *lease) Release() {
+	close(l.stop)
+	<-l.done
+	if err := l.i.repo.ReleaseLock(l.name, l.i.instanceID); err != nil {
+		log.Printf("[lease.Release] error when release lock %v with error %v \n", l.name, err)
+	}
+}
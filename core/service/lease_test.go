@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireLeaseSkipsWhenHeld(t *testing.T) {
+	repo := newFakeRepository()
+	repo.locks["worker"] = "other-instance"
+	i := newTestService(repo)
+
+	lock, err := acquireLease(i, "worker", time.Minute)
+	if err != nil || lock != nil {
+		t.Fatalf("acquireLease = %v, %v, want no lease", lock, err)
+	}
+	if repo.locks["worker"] != "other-instance" {
+		t.Fatalf("lock owner = %q", repo.locks["worker"])
+	}
+}
+
+func TestLeaseRenewsUntilReleased(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+
+	// a TTL below the renewal floor renews every minLeaseRenewal
+	lock, err := acquireLease(i, "worker", time.Millisecond)
+	if err != nil || lock == nil {
+		t.Fatalf("acquireLease = %v, %v", lock, err)
+	}
+	time.Sleep(minLeaseRenewal + 200*time.Millisecond)
+	lock.Release()
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.lockCalls < 2 {
+		t.Fatalf("lock was taken %v times, want a renewal", repo.lockCalls)
+	}
+	if _, held := repo.locks["worker"]; held {
+		t.Fatal("lock is still held after Release")
+	}
+}
+
+func TestLeaseStopsRenewingAfterTakeover(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+
+	lock, err := acquireLease(i, "worker", time.Millisecond)
+	if err != nil || lock == nil {
+		t.Fatalf("acquireLease = %v, %v", lock, err)
+	}
+	repo.mu.Lock()
+	repo.locks["worker"] = "other-instance"
+	repo.mu.Unlock()
+
+	select {
+	case <-lock.done:
+	case <-time.After(minLeaseRenewal + time.Second):
+		t.Fatal("lease kept renewing a lock held by another replica")
+	}
+	lock.Release()
+	if repo.locks["worker"] != "other-instance" {
+		t.Fatalf("Release freed the lock of %q", repo.locks["worker"])
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultNotificationLocale = "en"
+	maxDeviceTokenLength      = 4096
+)
+
+type notificationTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+type notificationData struct {
+	Filename   string
+	Label      string
+	Confidence float64
+}
+
+var notificationFuncs = template.FuncMap{
+	"humanize": func(label string) string {
+		return strings.Join(strings.Fields(strings.ReplaceAll(label, "_", " ")), " ")
+	},
+	"percent": func(confidence float64) string {
+		return fmt.Sprintf("%.0f%%", confidence*100)
+	},
+}
+
+func newNotificationTemplate(title, body string) notificationTemplate {
+	return notificationTemplate{
+		title: template.Must(template.New("title").Funcs(notificationFuncs).Parse(title)),
+		body:  template.Must(template.New("body").Funcs(notificationFuncs).Parse(body)),
+	}
+}
+
+var detectionNotificationTemplates = map[string]notificationTemplate{
+	"en": newNotificationTemplate(
+		"Detection finished",
+		"{{humanize .Label}} detected with {{percent .Confidence}} confidence",
+	),
+	"id": newNotificationTemplate(
+		"Deteksi selesai",
+		"{{humanize .Label}} terdeteksi dengan keyakinan {{percent .Confidence}}",
+	),
+}
+
+// notificationTemplateFor matches the full locale first, then its language,
+// and falls back to English.
+func notificationTemplateFor(locale string) notificationTemplate {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if tmpl, ok := detectionNotificationTemplates[locale]; ok {
+		return tmpl
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if tmpl, ok := detectionNotificationTemplates[language]; ok {
+		return tmpl
+	}
+	return detectionNotificationTemplates[DefaultNotificationLocale]
+}
+
+func renderDetectionNotification(device domain.DeviceToken, img domain.Image) (*domain.PushMessage, error) {
+	tmpl := notificationTemplateFor(device.Locale)
+	data := notificationData{
+		Filename:   img.Filename,
+		Label:      img.Label,
+		Confidence: img.Confidence,
+	}
+	var title, body bytes.Buffer
+	if err := tmpl.title.Execute(&title, data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return &domain.PushMessage{
+		Token: device.Token,
+		Title: title.String(),
+		Body:  body.String(),
+		Data: map[string]string{
+			"type":     domain.EventDetectionCompleted,
+			"filename": img.Filename,
+			"label":    img.Label,
+		},
+	}, nil
+}
+
+// notifyDetection pushes the result to every device of the owner, tokens the
+// provider rejects are dropped.
+func notifyDetection(i *ImageService, img domain.Image) {
+	devices, err := i.repo.GetDeviceTokens(img.Email)
+	if err != nil {
+		log.Printf("[ImageService.notifyDetection] error when retrieve device tokens with error %v \n", err)
+		return
+	}
+	for _, device := range devices {
+		msg, err := renderDetectionNotification(device, img)
+		if err != nil {
+			log.Printf("[ImageService.notifyDetection] error when render notification with error %v \n", err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = i.notifier.Notify(ctx, *msg)
+		cancel()
+		if errors.Is(err, domain.ErrUnregisteredDevice) {
+			if err = i.repo.DeleteDeviceToken(device.Token); err != nil {
+				log.Printf("[ImageService.notifyDetection] error when delete device token with error %v \n", err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("[ImageService.notifyDetection] error when notify device of %v with error %v \n", img.Filename, err)
+		}
+	}
+}
+
+func (i *ImageService) RegisterDevice(email string, payload domain.RegisterDevicePayload) (*domain.DeviceToken, error) {
+	if payload.Token == "" || len(payload.Token) > maxDeviceTokenLength {
+		return nil, domain.ErrInvalidDevice.Errorf("invalid device: token should be filled")
+	}
+	switch payload.Platform {
+	case "":
+		payload.Platform = "android"
+	case "android", "ios", "web":
+	default:
+		return nil, domain.ErrInvalidDevice.Errorf("invalid device: platform should be android, ios or web")
+	}
+	if payload.Locale == "" {
+		payload.Locale = DefaultNotificationLocale
+	}
+
+	now := time.Now().UnixMilli()
+	device := domain.DeviceToken{
+		Token:     payload.Token,
+		Email:     email,
+		Platform:  payload.Platform,
+		Locale:    payload.Locale,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	existing, err := i.repo.GetDeviceToken(payload.Token)
+	if err != nil && !errors.Is(err, domain.ErrDeviceNotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.Email == email {
+		device.CreatedAt = existing.CreatedAt
+	}
+	if err = i.repo.SaveDeviceToken(device); err != nil {
+		log.Printf("[ImageService.RegisterDevice] error when save device token with error %v \n", err)
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (i *ImageService) UnregisterDevice(email, token string) error {
+	device, err := i.repo.GetDeviceToken(token)
+	if err != nil {
+		return err
+	}
+	if device.Email != email {
+		return domain.ErrDeviceNotFound
+	}
+	return i.repo.DeleteDeviceToken(token)
+}
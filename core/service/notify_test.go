@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"image-service/core/domain"
+	"sync"
+	"testing"
+)
+
+// recordingNotifier keeps the messages it was asked to send and rejects the
+// tokens in unregistered.
+type recordingNotifier struct {
+	mu           sync.Mutex
+	unregistered map[string]bool
+	messages     []domain.PushMessage
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg domain.PushMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.unregistered[msg.Token] {
+		return domain.ErrUnregisteredDevice
+	}
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func TestRenderDetectionNotification(t *testing.T) {
+	img := domain.Image{Filename: "a.jpg", Label: "leaf_rust", Confidence: 0.873}
+	for locale, want := range map[string]string{
+		"":      "leaf rust detected with 87% confidence",
+		"en-US": "leaf rust detected with 87% confidence",
+		"id":    "leaf rust terdeteksi dengan keyakinan 87%",
+		"id_ID": "leaf rust terdeteksi dengan keyakinan 87%",
+		"fr-FR": "leaf rust detected with 87% confidence",
+	} {
+		msg, err := renderDetectionNotification(domain.DeviceToken{Token: "device", Locale: locale}, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Body != want || msg.Token != "device" || msg.Data["filename"] != "a.jpg" {
+			t.Errorf("locale %q rendered %+v, want body %q", locale, msg, want)
+		}
+	}
+}
+
+func TestNotifyDetectionDropsUnregisteredDevices(t *testing.T) {
+	repo := newFakeRepository()
+	repo.devices["phone"] = domain.DeviceToken{Token: "phone", Email: "user@example.com", Locale: "id"}
+	repo.devices["stale"] = domain.DeviceToken{Token: "stale", Email: "user@example.com"}
+	repo.devices["other"] = domain.DeviceToken{Token: "other", Email: "other@example.com"}
+	notifier := &recordingNotifier{unregistered: map[string]bool{"stale": true}}
+	i := newTestService(repo)
+	i.notifier = notifier
+
+	notifyDetection(i, domain.Image{Email: "user@example.com", Filename: "a.jpg", Label: "healthy", Confidence: 1})
+	if len(notifier.messages) != 1 || notifier.messages[0].Token != "phone" || notifier.messages[0].Title != "Deteksi selesai" {
+		t.Fatalf("messages = %+v", notifier.messages)
+	}
+	if _, ok := repo.devices["stale"]; ok {
+		t.Fatal("the unregistered token was kept")
+	}
+	if len(repo.devices) != 2 {
+		t.Fatalf("devices = %+v", repo.devices)
+	}
+}
+
+func TestRegisterDevice(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+
+	device, err := i.RegisterDevice("user@example.com", domain.RegisterDevicePayload{Token: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Platform != "android" || device.Locale != DefaultNotificationLocale {
+		t.Fatalf("device = %+v", device)
+	}
+	for _, payload := range []domain.RegisterDevicePayload{{}, {Token: "phone", Platform: "symbian"}} {
+		if _, err = i.RegisterDevice("user@example.com", payload); !errors.Is(err, domain.ErrInvalidDevice) {
+			t.Fatalf("RegisterDevice(%+v) = %v, want %v", payload, err, domain.ErrInvalidDevice)
+		}
+	}
+
+	if err = i.UnregisterDevice("other@example.com", "phone"); !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Fatalf("UnregisterDevice = %v, want %v", err, domain.ErrDeviceNotFound)
+	}
+	if err = i.UnregisterDevice("user@example.com", "phone"); err != nil || len(repo.devices) != 0 {
+		t.Fatalf("UnregisterDevice = %v, devices %+v", err, repo.devices)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"time"
+)
+
+const (
+	DefaultReaperInterval  = time.Minute
+	DefaultReaperTimeout   = 10 * time.Minute
+	reaperLockName         = "stuck-image-reaper"
+	reaperBatchSize        = 100
+	reaperMaxBackoffFactor = 1 << 10
+)
+
+// redispatchDelay doubles the timeout for every dispatch already made.
+func redispatchDelay(timeout time.Duration, attempts int) time.Duration {
+	factor := 1
+	for n := 0; n < attempts && factor < reaperMaxBackoffFactor; n++ {
+		factor *= 2
+	}
+	return timeout * time.Duration(factor)
+}
+
+func reapStuckImages(i *ImageService) error {
+	lock, err := acquireLease(i, reaperLockName, i.reaperInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	now := time.Now()
+	images, err := i.repo.GetStaleImages(domain.PendingImageStatuses, now.Add(-i.reaperTimeout).UnixMilli(), reaperBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.reapStuckImages] error when retrieve stale images with error %v \n", err)
+		return err
+	}
+
+	for _, img := range images {
+		stuckFor := now.Sub(time.UnixMilli(img.StatusUpdatedAt))
+		if stuckFor < redispatchDelay(i.reaperTimeout, img.Attempts) {
+			continue
+		}
+
+		if img.Attempts >= i.maxDispatchAttempts {
+			err = i.ReportImageFailure(domain.UpdateImageFailurePayload{
+				Filename:  img.Filename,
+				ErrorCode: "timeout",
+				Message:   fmt.Sprintf("no result after %v dispatch attempts", img.Attempts),
+			})
+		} else {
+			err = dispatchImage(i, img.Filename)
+		}
+		if err != nil {
+			log.Printf("[ImageService.reapStuckImages] error when reap %v with error %v \n", img.Filename, err)
+		}
+	}
+	return nil
+}
+
+// StartReaper re-dispatches images that never got a result until ctx is
+// cancelled. Replicas coordinate through a lock so only one reaps per tick.
+func (i *ImageService) StartReaper(ctx context.Context) {
+	ticker := time.NewTicker(i.reaperInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reapStuckImages(i); err != nil {
+				log.Printf("[ImageService.StartReaper] error when reap stuck images with error %v \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func TestRedispatchDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:  time.Minute,
+		1:  2 * time.Minute,
+		3:  8 * time.Minute,
+		40: reaperMaxBackoffFactor * time.Minute,
+	} {
+		if got := redispatchDelay(time.Minute, attempts); got != want {
+			t.Errorf("redispatchDelay(1m, %v) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestReapStuckImages(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	now := time.Now()
+	stuckSince := func(d time.Duration) int64 {
+		return now.Add(-d).UnixMilli()
+	}
+	repo.images["stuck.jpg"] = domain.Image{Filename: "stuck.jpg", Status: domain.ImageStatusQueued, Attempts: 1, StatusUpdatedAt: stuckSince(3 * i.reaperTimeout)}
+	repo.images["backing-off.jpg"] = domain.Image{Filename: "backing-off.jpg", Status: domain.ImageStatusProcessing, Attempts: 2, StatusUpdatedAt: stuckSince(3 * i.reaperTimeout)}
+	repo.images["exhausted.jpg"] = domain.Image{Filename: "exhausted.jpg", Status: domain.ImageStatusProcessing, Attempts: i.maxDispatchAttempts, StatusUpdatedAt: stuckSince(100 * i.reaperTimeout)}
+	repo.images["fresh.jpg"] = domain.Image{Filename: "fresh.jpg", Status: domain.ImageStatusQueued, StatusUpdatedAt: now.UnixMilli()}
+
+	if err := reapStuckImages(i); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.outbox["stuck.jpg-2"]; !ok || len(repo.outbox) != 1 {
+		t.Fatalf("outbox = %+v, want only stuck.jpg dispatched again", repo.outbox)
+	}
+	exhausted := repo.images["exhausted.jpg"]
+	if exhausted.Status != domain.ImageStatusFailed || exhausted.Failure == nil || exhausted.Failure.Code != "timeout" {
+		t.Fatalf("exhausted image = %+v", exhausted)
+	}
+	if _, held := repo.locks[reaperLockName]; held {
+		t.Fatal("reaper lock is still held")
+	}
+}
+
+func TestReapStuckImagesSkipsWhenLocked(t *testing.T) {
+	repo := newFakeRepository()
+	repo.locks[reaperLockName] = "other-instance"
+	i := newTestService(repo)
+	repo.images["stuck.jpg"] = domain.Image{Filename: "stuck.jpg", Status: domain.ImageStatusQueued, StatusUpdatedAt: 1}
+
+	if err := reapStuckImages(i); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.outbox) != 0 {
+		t.Fatalf("outbox = %+v, another replica holds the reaper", repo.outbox)
+	}
+}
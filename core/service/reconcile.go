@@ -0,0 +1,62 @@
+package service
+
+import (
+	"image-service/core/domain"
+	"log"
+	"time"
+)
+
+// ReconcileBlobs compares the objects under images/ with the image documents.
+// Blobs without a document are only reported or deleted once they are older
+// than the grace period, so in-flight uploads are left alone.
+func (i *ImageService) ReconcileBlobs(opts domain.ReconcileOptions) (*domain.ReconcileReport, error) {
+	blobs, err := i.repo.ListImageBlobs()
+	if err != nil {
+		log.Printf("[ImageService.ReconcileBlobs] error when list blobs with error %v \n", err)
+		return nil, err
+	}
+	filenames, err := i.repo.ListImageFilenames()
+	if err != nil {
+		log.Printf("[ImageService.ReconcileBlobs] error when list images with error %v \n", err)
+		return nil, err
+	}
+
+	report := domain.ReconcileReport{
+		DryRun:        opts.DryRun,
+		ScannedBlobs:  len(blobs),
+		ScannedImages: len(filenames),
+		OrphanedBlobs: []domain.BlobInfo{},
+		MissingBlobs:  []string{},
+	}
+
+	images := make(map[string]bool, len(filenames))
+	for _, filename := range filenames {
+		images[filename] = true
+	}
+	stored := make(map[string]bool, len(blobs))
+	cutoff := time.Now().Add(-opts.GracePeriod).UnixMilli()
+	for _, blob := range blobs {
+		stored[blob.Filename] = true
+		if images[blob.Filename] || blob.CreatedAt > cutoff {
+			continue
+		}
+		report.OrphanedBlobs = append(report.OrphanedBlobs, blob)
+	}
+	for _, filename := range filenames {
+		if !stored[filename] {
+			report.MissingBlobs = append(report.MissingBlobs, filename)
+		}
+	}
+
+	if opts.DryRun {
+		return &report, nil
+	}
+	for _, blob := range report.OrphanedBlobs {
+		if err = i.repo.DeleteImageBlob(blob.Filename); err != nil {
+			log.Printf("[ImageService.ReconcileBlobs] error when delete orphaned blob %v with error %v \n", blob.Name, err)
+			continue
+		}
+		report.DeletedBlobs++
+	}
+	return &report, nil
+}
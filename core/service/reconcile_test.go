@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"image-service/core/domain"
+	"testing"
+	"time"
+)
+
+func newReconcileRepository() *fakeRepository {
+	repo := newFakeRepository()
+	old := time.Now().Add(-48 * time.Hour).UnixMilli()
+	for _, filename := range []string{"kept.jpg", "orphan.jpg"} {
+		repo.blobs[filename] = domain.BlobInfo{Name: "images/" + filename, Filename: filename, CreatedAt: old}
+	}
+	repo.blobs["uploading.jpg"] = domain.BlobInfo{Name: "images/uploading.jpg", Filename: "uploading.jpg", CreatedAt: time.Now().UnixMilli()}
+	repo.images["kept.jpg"] = domain.Image{Filename: "kept.jpg"}
+	repo.images["missing.jpg"] = domain.Image{Filename: "missing.jpg"}
+	return repo
+}
+
+func TestReconcileBlobsDryRun(t *testing.T) {
+	repo := newReconcileRepository()
+	report, err := newTestService(repo).ReconcileBlobs(domain.ReconcileOptions{GracePeriod: 24 * time.Hour, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ScannedBlobs != 3 || report.ScannedImages != 2 || report.DeletedBlobs != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if len(report.OrphanedBlobs) != 1 || report.OrphanedBlobs[0].Filename != "orphan.jpg" {
+		t.Fatalf("orphaned = %+v, the upload within the grace period is not an orphan", report.OrphanedBlobs)
+	}
+	if fmt.Sprint(report.MissingBlobs) != "[missing.jpg]" {
+		t.Fatalf("missing = %v", report.MissingBlobs)
+	}
+	if len(repo.blobs) != 3 {
+		t.Fatalf("dry run deleted blobs: %+v", repo.blobs)
+	}
+}
+
+func TestReconcileBlobsDeletesOrphans(t *testing.T) {
+	repo := newReconcileRepository()
+	report, err := newTestService(repo).ReconcileBlobs(domain.ReconcileOptions{GracePeriod: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedBlobs != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if _, ok := repo.blobs["orphan.jpg"]; ok || len(repo.blobs) != 2 {
+		t.Fatalf("blobs = %+v", repo.blobs)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultRetentionSweepInterval = time.Hour
+	retentionLockName             = "retention-sweeper"
+	retentionBatchSize            = 100
+	retentionMaxBatches           = 50
+)
+
+// parseRetentionRules reads the rules from RETENTION_POLICIES, a JSON array
+// such as [{"name":"originals","tier":"free","action":"delete-original","afterDays":90}].
+// Every rule names its tier, "*" applies it to all images.
+func parseRetentionRules(raw string) ([]domain.RetentionRule, error) {
+	rules := []domain.RetentionRule{}
+	if strings.TrimSpace(raw) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid retention policies: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Name == "" || names[rule.Name] {
+			return nil, fmt.Errorf("retention rule name %q must be set and unique", rule.Name)
+		}
+		if rule.Tier == "" {
+			return nil, fmt.Errorf("retention rule %q needs a tier, use %q for every tier", rule.Name, domain.RetentionAllTiers)
+		}
+		if !rule.Action.IsValid() {
+			return nil, fmt.Errorf("retention rule %q has invalid action %q", rule.Name, rule.Action)
+		}
+		if rule.AfterDays <= 0 {
+			return nil, fmt.Errorf("retention rule %q needs a positive afterDays", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return rules, nil
+}
+
+func applyRetentionAction(i *ImageService, rule domain.RetentionRule, img domain.Image, now int64) error {
+	switch rule.Action {
+	case domain.RetentionActionDeleteOriginal:
+		if img.OriginalDeletedAt > 0 {
+			return nil
+		}
+		return i.repo.DeleteOriginalImage(img.Filename, now)
+	case domain.RetentionActionAnonymize:
+		if strings.HasPrefix(img.Email, "anonymized:") {
+			return nil
+		}
+		return i.repo.AnonymizeImage(img.Filename, "anonymized:"+hashEmail(img.Email))
+	case domain.RetentionActionDelete:
+		return i.repo.DeleteImage(img.Filename)
+	}
+	return fmt.Errorf("unknown retention action %v", rule.Action)
+}
+
+// applyRetentionRule continues from the rule's saved cursor. The cutoff only
+// moves forward, so every image is visited once per rule.
+func applyRetentionRule(i *ImageService, rule domain.RetentionRule, now time.Time) domain.RetentionRuleResult {
+	result := domain.RetentionRuleResult{
+		Rule: rule.Name,
+	}
+	cursor, err := i.repo.GetRetentionCursor(rule.Name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	cutoff := now.AddDate(0, 0, -rule.AfterDays).UnixMilli()
+	for n := 0; n < retentionMaxBatches; n++ {
+		images, err := i.repo.GetRetentionBatch(rule, cutoff, *cursor, retentionBatchSize)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if len(images) == 0 {
+			break
+		}
+		for _, img := range images {
+			err = applyRetentionAction(i, rule, img, now.UnixMilli())
+			if err != nil && !errors.Is(err, domain.ErrImageNotFound) {
+				log.Printf("[ImageService.applyRetentionRule] error when apply %v to %v with error %v \n", rule.Name, img.Filename, err)
+				result.Failed++
+				continue
+			}
+			result.Processed++
+		}
+
+		last := images[len(images)-1]
+		cursor = &domain.RetentionCursor{
+			CreatedAt: last.CreatedAt,
+			Filename:  last.Filename,
+		}
+		if err = i.repo.SaveRetentionCursor(rule.Name, *cursor); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	return result
+}
+
+func sweepRetention(i *ImageService) error {
+	lock, err := acquireLease(i, retentionLockName, i.retentionSweepInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	now := time.Now()
+	sweep := domain.RetentionSweep{
+		ID:        uuid.NewString(),
+		StartedAt: now.UnixMilli(),
+		Results:   []domain.RetentionRuleResult{},
+	}
+	for _, rule := range i.retentionRules {
+		sweep.Results = append(sweep.Results, applyRetentionRule(i, rule, now))
+	}
+	sweep.CompletedAt = time.Now().UnixMilli()
+	return i.repo.SaveRetentionSweep(sweep)
+}
+
+// StartRetentionSweeper applies the configured retention rules until ctx is
+// cancelled.
+func (i *ImageService) StartRetentionSweeper(ctx context.Context) {
+	if len(i.retentionRules) == 0 {
+		return
+	}
+	ticker := time.NewTicker(i.retentionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sweepRetention(i); err != nil {
+				log.Printf("[ImageService.StartRetentionSweeper] error when sweep retention with error %v \n", err)
+			}
+		}
+	}
+}
+
+func (i *ImageService) GetRetentionRules() []domain.RetentionRule {
+	return i.retentionRules
+}
+
+func (i *ImageService) GetRetentionSweeps(limit int) ([]domain.RetentionSweep, error) {
+	res, err := i.repo.GetRetentionSweeps(limit)
+	if err != nil {
+		log.Printf("[ImageService.GetRetentionSweeps] error when retrieve retention sweeps with error %v \n", err)
+		return nil, err
+	}
+	return res, nil
+}
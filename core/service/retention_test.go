@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"strings"
+	"testing"
+)
+
+func TestParseRetentionRules(t *testing.T) {
+	rules, err := parseRetentionRules(`[
+		{"name":"originals","tier":"free","action":"delete-original","afterDays":90},
+		{"name":"everything","tier":"*","action":"delete","afterDays":365}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Tier != "free" || rules[1].Tier != domain.RetentionAllTiers || rules[1].Action != domain.RetentionActionDelete {
+		t.Fatalf("rules = %+v", rules)
+	}
+
+	if rules, err = parseRetentionRules(" "); err != nil || len(rules) != 0 {
+		t.Fatalf("parseRetentionRules(blank) = %v, %v", rules, err)
+	}
+}
+
+func TestParseRetentionRulesRejectsInvalidRules(t *testing.T) {
+	for name, raw := range map[string]string{
+		"malformed":      `{"name":"a"}`,
+		"missing name":   `[{"tier":"free","action":"delete","afterDays":1}]`,
+		"duplicate name": `[{"name":"a","tier":"free","action":"delete","afterDays":1},{"name":"a","tier":"pro","action":"delete","afterDays":1}]`,
+		"missing tier":   `[{"name":"a","action":"delete","afterDays":1}]`,
+		"unknown action": `[{"name":"a","tier":"free","action":"archive","afterDays":1}]`,
+		"no age":         `[{"name":"a","tier":"free","action":"delete","afterDays":0}]`,
+	} {
+		if rules, err := parseRetentionRules(raw); err == nil {
+			t.Errorf("%v: parseRetentionRules = %+v, want an error", name, rules)
+		}
+	}
+}
+
+func TestApplyRetentionAction(t *testing.T) {
+	repo := newFakeRepository()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Email: "user@example.com"}
+	repo.images["b.jpg"] = domain.Image{Filename: "b.jpg", Email: "user@example.com"}
+	i := newTestService(repo)
+	anonymize := domain.RetentionRule{Name: "anonymize", Tier: domain.RetentionAllTiers, Action: domain.RetentionActionAnonymize, AfterDays: 1}
+
+	if err := applyRetentionAction(i, anonymize, repo.images["a.jpg"], 0); err != nil {
+		t.Fatal(err)
+	}
+	owner := repo.images["a.jpg"].Email
+	if !strings.HasPrefix(owner, "anonymized:") || strings.Contains(owner, "user@example.com") {
+		t.Fatalf("owner = %q", owner)
+	}
+	// a second pass keeps the anonymized owner instead of hashing it again
+	if err := applyRetentionAction(i, anonymize, repo.images["a.jpg"], 0); err != nil || repo.images["a.jpg"].Email != owner {
+		t.Fatalf("second pass = %v, owner %q", err, repo.images["a.jpg"].Email)
+	}
+
+	remove := domain.RetentionRule{Name: "delete", Tier: domain.RetentionAllTiers, Action: domain.RetentionActionDelete, AfterDays: 1}
+	if err := applyRetentionAction(i, remove, repo.images["b.jpg"], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.images["b.jpg"]; ok {
+		t.Fatal("image was not deleted")
+	}
+	if err := applyRetentionAction(i, remove, domain.Image{Filename: "b.jpg"}, 0); !errors.Is(err, domain.ErrImageNotFound) {
+		t.Fatalf("applyRetentionAction = %v, want %v", err, domain.ErrImageNotFound)
+	}
+}
@@ -4,21 +4,66 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"image"
 	"image-service/core/domain"
 	"image-service/core/port"
+	"image-service/core/util"
 	"log"
 	"mime/multipart"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/bbrks/go-blurhash"
+	"github.com/google/uuid"
 	"google.golang.org/api/option"
 )
 
+const DefaultMaxDispatchAttempts = 3
+
 type ImageService struct {
-	repo         port.ImageRepository
-	pubsubClient pubsub.Client
+	repo                port.ImageRepository
+	pubsubClient        pubsub.Client
+	maxDispatchAttempts int
+	instanceID          string
+	reaperInterval      time.Duration
+	reaperTimeout       time.Duration
+	outboxRelayInterval time.Duration
+	outboxMaxRetries    int
+	softDeleteWindow    time.Duration
+	trashPurgeInterval  time.Duration
+	exportLinkTTL       time.Duration
+	erasureMode         domain.ErasureMode
+	erasureInterval     time.Duration
+
+	exportWorkerInterval time.Duration
+	exportStaleAfter     time.Duration
+	exportRateLimit      int
+	exportRateWindow     time.Duration
+
+	retentionRules         []domain.RetentionRule
+	retentionSweepInterval time.Duration
+
+	cursorKey       []byte
+	detectionLabels []string
+	statsCache      *statsCache
+
+	broker port.EventBroker
+	hub    *eventHub
+
+	webhookClient      *http.Client
+	webhookKey         []byte
+	webhookInterval    time.Duration
+	webhookMaxAttempts int
+
+	notifier port.Notifier
+
+	idempotencyKeyTTL time.Duration
+
+	idempotencyCleanupInterval time.Duration
 }
 
 func sendToPubsub(i *ImageService, payload domain.SendToMLPayload) error {
@@ -87,7 +132,7 @@ func sendToPubsub(i *ImageService, payload domain.SendToMLPayload) error {
 	return nil
 }
 
-func NewImageService(repo port.ImageRepository) (*ImageService, error) {
+func NewImageService(repo port.ImageRepository, broker port.EventBroker, notifier port.Notifier) (*ImageService, error) {
 	ctx := context.Background()
 	opt := option.WithCredentialsFile("pubsub-sa-key.json")
 	projectId := os.Getenv("CAPSTONE_PROJECT_ID")
@@ -96,18 +141,85 @@ func NewImageService(repo port.ImageRepository) (*ImageService, error) {
 		log.Printf("failed to initialize pubsub client with error %v \n", err)
 		return nil, err
 	}
+	retentionRules, err := parseRetentionRules(os.Getenv("RETENTION_POLICIES"))
+	if err != nil {
+		log.Printf("failed to parse retention policies with error %v \n", err)
+		return nil, err
+	}
+	cursorKey := []byte(os.Getenv("CURSOR_SIGNING_KEY"))
+	if len(cursorKey) == 0 {
+		cursorKey = []byte(os.Getenv("JWT_SIGNATURE_KEY"))
+	}
+	if len(cursorKey) == 0 {
+		// unsigned cursors would let clients forge them
+		return nil, fmt.Errorf("CURSOR_SIGNING_KEY or JWT_SIGNATURE_KEY must be set")
+	}
+	webhookKey, err := parseWebhookKey(os.Getenv("WEBHOOK_SECRET_KEY"))
+	if err != nil {
+		return nil, err
+	}
+	detectionLabels := []string{}
+	if raw := os.Getenv("DETECTION_LABELS"); raw != "" {
+		detectionLabels = strings.Split(raw, ",")
+	}
+	exportLinkTTL, err := exportLinkTTL()
+	if err != nil {
+		return nil, err
+	}
+	erasureMode := domain.ErasureMode(os.Getenv("ACCOUNT_ERASURE_MODE"))
+	if erasureMode != domain.ErasureModeAnonymize {
+		erasureMode = domain.ErasureModeDelete
+	}
 	return &ImageService{
-		repo:         repo,
-		pubsubClient: *pubsubClient,
+		repo:                repo,
+		pubsubClient:        *pubsubClient,
+		maxDispatchAttempts: util.GetEnvInt("ML_MAX_DISPATCH_ATTEMPTS", DefaultMaxDispatchAttempts),
+		instanceID:          uuid.NewString(),
+		reaperInterval:      util.GetEnvDuration("REAPER_INTERVAL", DefaultReaperInterval),
+		reaperTimeout:       util.GetEnvDuration("REAPER_TIMEOUT", DefaultReaperTimeout),
+		outboxRelayInterval: util.GetEnvDuration("OUTBOX_RELAY_INTERVAL", DefaultOutboxRelayInterval),
+		outboxMaxRetries:    util.GetEnvInt("OUTBOX_MAX_RETRIES", DefaultOutboxMaxRetries),
+		softDeleteWindow:    util.GetEnvDuration("IMAGE_SOFT_DELETE_WINDOW", 0),
+		trashPurgeInterval:  util.GetEnvDuration("TRASH_PURGE_INTERVAL", DefaultTrashPurgeInterval),
+		exportLinkTTL:       exportLinkTTL,
+		erasureMode:         erasureMode,
+		erasureInterval:     util.GetEnvDuration("ERASURE_INTERVAL", DefaultErasureInterval),
+
+		exportWorkerInterval: util.GetEnvDuration("EXPORT_WORKER_INTERVAL", DefaultExportWorkerInterval),
+		exportStaleAfter:     util.GetEnvDuration("EXPORT_STALE_AFTER", DefaultExportStaleAfter),
+		exportRateLimit:      util.GetEnvInt("EXPORT_RATE_LIMIT", DefaultExportRateLimit),
+		exportRateWindow:     util.GetEnvDuration("EXPORT_RATE_WINDOW", DefaultExportRateWindow),
+
+		retentionRules:         retentionRules,
+		retentionSweepInterval: util.GetEnvDuration("RETENTION_SWEEP_INTERVAL", DefaultRetentionSweepInterval),
+
+		cursorKey:       cursorKey,
+		detectionLabels: detectionLabels,
+		statsCache:      newStatsCache(util.GetEnvDuration("STATS_CACHE_TTL", DefaultStatsCacheTTL)),
+
+		broker: broker,
+		hub:    newEventHub(util.GetEnvInt("EVENT_BACKLOG", DefaultEventBacklog), DefaultEventBacklogTTL),
+
+		webhookClient:      newWebhookClient(util.GetEnvDuration("WEBHOOK_TIMEOUT", DefaultWebhookTimeout)),
+		webhookKey:         webhookKey,
+		webhookInterval:    util.GetEnvDuration("WEBHOOK_INTERVAL", DefaultWebhookInterval),
+		webhookMaxAttempts: util.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", DefaultWebhookMaxAttempts),
+
+		notifier: notifier,
+
+		idempotencyKeyTTL: util.GetEnvDuration("IDEMPOTENCY_KEY_TTL", DefaultIdempotencyKeyTTL),
+
+		idempotencyCleanupInterval: util.GetEnvDuration("IDEMPOTENCY_CLEANUP_INTERVAL", DefaultIdempotencyCleanupInterval),
 	}, nil
 }
 
-func (i *ImageService) UploadImage(email string, image multipart.File) (*domain.UploadImageResponse, error) {
-	res, err := i.repo.UploadImage(email, image)
+func (i *ImageService) UploadImage(uploader domain.Uploader, image multipart.File) (*domain.UploadImageResponse, error) {
+	res, err := i.repo.UploadImage(uploader, image)
 	if err != nil {
 		log.Printf("[ImageService.UploadImage] error when uploading image with error %v \n", err)
 		return nil, err
 	}
+	publishStatusEvent(i, res.Filename)
 
 	return res, nil
 }
@@ -136,21 +248,175 @@ func (i *ImageService) UpdateBlurHash(filename string, file multipart.File) erro
 	return nil
 }
 
-func (i *ImageService) GetDetectionResults(email string, filter *domain.PageFilter) ([]domain.Image, error) {
-	res, err := i.repo.GetDetectionResults(email, filter)
+// countDetectionResults fills the totals the caller asked for. Labels are
+// counted for the requested labels, or for DETECTION_LABELS when none are
+// given.
+func countDetectionResults(i *ImageService, email string, filter *domain.PageFilter, page *domain.ImagePage) error {
+	if filter.WithTotal {
+		total, err := i.repo.CountDetectionResults(email, filter)
+		if err != nil {
+			log.Printf("[ImageService.GetDetectionResults] error when count detection results with error %v \n", err)
+			return err
+		}
+		page.Total = &total
+	}
+	if filter.WithLabelCounts {
+		labels := filter.Labels
+		if len(labels) == 0 {
+			labels = i.detectionLabels
+		}
+		counts, err := i.repo.CountDetectionResultsByLabel(email, filter, labels)
+		if err != nil {
+			log.Printf("[ImageService.GetDetectionResults] error when count labels with error %v \n", err)
+			return err
+		}
+		page.LabelCounts = counts
+	}
+	return nil
+}
+
+func (i *ImageService) GetDetectionResults(email string, filter *domain.PageFilter) (*domain.ImagePage, error) {
+	if filter.After != "" && filter.Before != "" {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	// one extra image tells whether there is another page in this direction
+	query := *filter
+	query.PerPage = filter.PerPage + 1
+	var err error
+	if filter.After != "" {
+		query.Cursor, err = util.DecodeCursor(i.cursorKey, filter.After, filter.SortBy, filter.SortOrder)
+	}
+	if filter.Before != "" {
+		query.Cursor, err = util.DecodeCursor(i.cursorKey, filter.Before, filter.SortBy, filter.SortOrder)
+		query.Backward = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := i.repo.GetDetectionResults(email, &query)
 	if err != nil {
 		log.Printf("[ImageService.GetDetectionResults] error when retrieve detection results with error %v \n", err)
 		return nil, err
 	}
-	return res, nil
+
+	page := domain.ImagePage{
+		HasMore: len(items) > filter.PerPage,
+		PerPage: filter.PerPage,
+	}
+	if err = countDetectionResults(i, email, filter, &page); err != nil {
+		return nil, err
+	}
+	if page.HasMore {
+		items = items[:filter.PerPage]
+	}
+	if query.Backward {
+		for l, r := 0, len(items)-1; l < r; l, r = l+1, r-1 {
+			items[l], items[r] = items[r], items[l]
+		}
+	}
+	page.Items = items
+	if len(items) == 0 {
+		return &page, nil
+	}
+
+	first := util.EncodeCursor(i.cursorKey, util.CursorForImage(filter.SortBy, filter.SortOrder, items[0]))
+	last := util.EncodeCursor(i.cursorKey, util.CursorForImage(filter.SortBy, filter.SortOrder, items[len(items)-1]))
+	if query.Backward {
+		page.NextCursor = last
+		if page.HasMore {
+			page.PrevCursor = first
+		}
+	} else {
+		if page.HasMore {
+			page.NextCursor = last
+		}
+		if query.Cursor != nil {
+			page.PrevCursor = first
+		}
+	}
+	page.HasNext = page.NextCursor != ""
+	page.HasPrevious = page.PrevCursor != ""
+	return &page, nil
+}
+
+// ExportDetections walks every page of the filtered results with the list
+// cursor, so the full result set is never held in memory.
+func (i *ImageService) ExportDetections(email string, filter domain.PageFilter, fn func(domain.Image) error) error {
+	filter.PerPage = util.MaxPageSize
+	filter.WithTotal = false
+	filter.WithLabelCounts = false
+	filter.After = ""
+	filter.Before = ""
+	for {
+		page, err := i.GetDetectionResults(email, &filter)
+		if err != nil {
+			return err
+		}
+		for _, img := range page.Items {
+			if err = fn(img); err != nil {
+				return err
+			}
+		}
+		if !page.HasMore {
+			return nil
+		}
+		filter.After = page.NextCursor
+	}
 }
 
 func (i *ImageService) UpdateImageResult(payload domain.UpdateImagePayloadData) error {
-	err := i.repo.UpdateImageResult(payload)
+	img, transition, err := newStatusTransition(i, payload.Filename, domain.ImageStatusDetected)
+	if err != nil {
+		return err
+	}
+	err = i.repo.UpdateImageResult(payload, *transition)
 	if err != nil {
 		log.Printf("[ImageService.UpdateImageResult] error update image result with error %v \n", err)
 		return err
 	}
+	i.statsCache.invalidate(img.Email)
+	publishStatusEvent(i, payload.Filename)
+	return nil
+}
+
+func (i *ImageService) ReportImageFailure(payload domain.UpdateImageFailurePayload) error {
+	img, transition, err := newStatusTransition(i, payload.Filename, domain.ImageStatusFailed)
+	if err != nil {
+		return err
+	}
+	failure := domain.DetectionFailure{
+		Code:      payload.ErrorCode,
+		Message:   payload.Message,
+		Retryable: payload.Retryable,
+		FailedAt:  transition.At,
+	}
+	err = i.repo.UpdateImageFailure(payload.Filename, failure, *transition)
+	if err != nil {
+		log.Printf("[ImageService.ReportImageFailure] error update image failure with error %v \n", err)
+		return err
+	}
+	i.statsCache.invalidate(img.Email)
+	publishStatusEvent(i, payload.Filename)
+	if !payload.Retryable {
+		return nil
+	}
+
+	img, err = i.repo.GetImage(payload.Filename)
+	if err != nil {
+		log.Printf("[ImageService.ReportImageFailure] error when retrieve image with error %v \n", err)
+		return err
+	}
+	if img.Attempts >= i.maxDispatchAttempts {
+		log.Printf("[ImageService.ReportImageFailure] %v reached max dispatch attempts, not retrying \n", payload.Filename)
+		return nil
+	}
+	err = dispatchImage(i, payload.Filename)
+	if err != nil {
+		// the failure itself is recorded, the retry can be picked up later
+		log.Printf("[ImageService.ReportImageFailure] error when retry image with error %v \n", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,785 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image-service/core/domain"
+	"image-service/core/port"
+	"io"
+	"mime/multipart"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRepository keeps the documents the tests touch in memory. Methods a
+// test doesn't set up panic through the nil embedded interface.
+type fakeRepository struct {
+	port.ImageRepository
+
+	mu          sync.Mutex
+	locks       map[string]string
+	lockCalls   int
+	images      map[string]domain.Image
+	trash       map[string]domain.Image
+	blobs       map[string]domain.BlobInfo
+	uploads     int
+	scans       int
+	pageQueries int
+	erased      map[string][]string
+	erasures    map[string]domain.ErasureJob
+	exports     map[string]domain.ExportJob
+	archives    map[string][]byte
+	webhooks    map[string]domain.Webhook
+	deliveries  map[string]domain.WebhookDelivery
+	devices     map[string]domain.DeviceToken
+	idempotency map[string]domain.IdempotencyRecord
+	outbox      map[string]domain.OutboxEntry
+
+	// failArchiveWrites makes every export archive upload fail
+	failArchiveWrites bool
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		locks:       map[string]string{},
+		images:      map[string]domain.Image{},
+		trash:       map[string]domain.Image{},
+		blobs:       map[string]domain.BlobInfo{},
+		erased:      map[string][]string{},
+		erasures:    map[string]domain.ErasureJob{},
+		exports:     map[string]domain.ExportJob{},
+		archives:    map[string][]byte{},
+		webhooks:    map[string]domain.Webhook{},
+		deliveries:  map[string]domain.WebhookDelivery{},
+		devices:     map[string]domain.DeviceToken{},
+		idempotency: map[string]domain.IdempotencyRecord{},
+		outbox:      map[string]domain.OutboxEntry{},
+	}
+}
+
+func newTestService(repo *fakeRepository) *ImageService {
+	return &ImageService{
+		repo:                       repo,
+		instanceID:                 "test-instance",
+		erasureMode:                domain.ErasureModeDelete,
+		erasureInterval:            time.Minute,
+		broker:                     nopBroker{},
+		idempotencyKeyTTL:          DefaultIdempotencyKeyTTL,
+		idempotencyCleanupInterval: time.Minute,
+		outboxMaxRetries:           DefaultOutboxMaxRetries,
+		maxDispatchAttempts:        DefaultMaxDispatchAttempts,
+		reaperInterval:             DefaultReaperInterval,
+		reaperTimeout:              DefaultReaperTimeout,
+		statsCache:                 newStatsCache(DefaultStatsCacheTTL),
+	}
+}
+
+type nopBroker struct {
+	port.EventBroker
+}
+
+func (nopBroker) Publish(domain.DetectionEvent) error {
+	return nil
+}
+
+// testFile is an in-memory multipart.File.
+type testFile struct {
+	*bytes.Reader
+}
+
+func (testFile) Close() error {
+	return nil
+}
+
+func newTestFile(data string) multipart.File {
+	return testFile{bytes.NewReader([]byte(data))}
+}
+
+func (f *fakeRepository) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lockCalls++
+	if current, ok := f.locks[name]; ok && current != owner {
+		return false, nil
+	}
+	f.locks[name] = owner
+	return true, nil
+}
+
+func (f *fakeRepository) ReleaseLock(name, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.locks[name] == owner {
+		delete(f.locks, name)
+	}
+	return nil
+}
+
+func (f *fakeRepository) UploadImage(uploader domain.Uploader, file multipart.File) (*domain.UploadImageResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	f.uploads++
+	filename := string(data) + ".jpg"
+	f.images[filename] = domain.Image{Email: uploader.Email, Filename: filename}
+	return &domain.UploadImageResponse{Filename: filename, FileURL: "https://storage.example.com/" + filename}, nil
+}
+
+func (f *fakeRepository) GetImage(filename string) (*domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.images[filename]
+	if !ok {
+		return nil, domain.ErrImageNotFound
+	}
+	return &img, nil
+}
+
+// runStatusTransition checks the current status the way the repository's
+// transaction does.
+func (f *fakeRepository) runStatusTransition(filename string, transition domain.StatusTransition, update func(*domain.Image)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.images[filename]
+	if !ok {
+		return domain.ErrImageNotFound
+	}
+	if img.CurrentStatus() != transition.From {
+		return domain.ErrInvalidStatusTransition
+	}
+	img.Status = transition.To
+	img.StatusUpdatedAt = transition.At
+	if update != nil {
+		update(&img)
+	}
+	f.images[filename] = img
+	return nil
+}
+
+func (f *fakeRepository) UpdateImageStatus(filename string, transition domain.StatusTransition) error {
+	return f.runStatusTransition(filename, transition, nil)
+}
+
+func (f *fakeRepository) UpdateImageResult(payload domain.UpdateImagePayloadData, transition domain.StatusTransition) error {
+	return f.runStatusTransition(payload.Filename, transition, func(img *domain.Image) {
+		img.Label = payload.Label
+		img.Confidence = payload.Confidence
+	})
+}
+
+func (f *fakeRepository) UpdateImageFailure(filename string, failure domain.DetectionFailure, transition domain.StatusTransition) error {
+	return f.runStatusTransition(filename, transition, func(img *domain.Image) {
+		img.Failure = &failure
+	})
+}
+
+func (f *fakeRepository) GetStaleImages(statuses []domain.ImageStatus, before int64, limit int) ([]domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var images []domain.Image
+	for _, img := range f.images {
+		for _, status := range statuses {
+			if img.Status == status && img.StatusUpdatedAt <= before && len(images) < limit {
+				images = append(images, img)
+			}
+		}
+	}
+	sort.Slice(images, func(a, b int) bool { return images[a].StatusUpdatedAt < images[b].StatusUpdatedAt })
+	return images, nil
+}
+
+func (f *fakeRepository) ForEachImageWithoutStatus(fn func(domain.Image) error) error {
+	f.mu.Lock()
+	var images []domain.Image
+	for _, img := range f.images {
+		if img.Status == "" {
+			images = append(images, img)
+		}
+	}
+	f.mu.Unlock()
+	sort.Slice(images, func(a, b int) bool { return images[a].Filename < images[b].Filename })
+	for _, img := range images {
+		if err := fn(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepository) ListWebhooks(email, organization string) ([]domain.Webhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var webhooks []domain.Webhook
+	for _, webhook := range f.webhooks {
+		personal := webhook.Organization == "" && webhook.Email == email
+		if personal || (organization != "" && webhook.Organization == organization) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (f *fakeRepository) GetWebhook(id string) (*domain.Webhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	webhook, ok := f.webhooks[id]
+	if !ok {
+		return nil, domain.ErrWebhookNotFound
+	}
+	return &webhook, nil
+}
+
+func (f *fakeRepository) CreateWebhookDelivery(delivery domain.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (f *fakeRepository) ForEachDetection(email string, since int64, fn func(domain.Image) error) error {
+	f.mu.Lock()
+	f.scans++
+	var images []domain.Image
+	for _, img := range f.images {
+		if img.Email == email && img.CreatedAt >= since {
+			images = append(images, img)
+		}
+	}
+	f.mu.Unlock()
+	sort.Slice(images, func(a, b int) bool { return images[a].Filename < images[b].Filename })
+	for _, img := range images {
+		if err := fn(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDetectionResults lists the images newest first. Filenames are unique in
+// the tests, so the cursor is found by its filename.
+func (f *fakeRepository) GetDetectionResults(email string, query *domain.PageFilter) ([]domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pageQueries++
+	var images []domain.Image
+	for _, img := range f.images {
+		if img.Email == email {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(a, b int) bool {
+		if images[a].CreatedAt != images[b].CreatedAt {
+			return images[a].CreatedAt > images[b].CreatedAt
+		}
+		return images[a].Filename > images[b].Filename
+	})
+
+	if query.Cursor != nil {
+		at := len(images)
+		for n := range images {
+			if images[n].Filename == query.Cursor.Filename {
+				at = n
+			}
+		}
+		if query.Backward {
+			before := make([]domain.Image, 0, at)
+			for n := at - 1; n >= 0; n-- {
+				before = append(before, images[n])
+			}
+			images = before
+		} else {
+			images = images[at+1:]
+		}
+	}
+	if len(images) > query.PerPage {
+		images = images[:query.PerPage]
+	}
+	return images, nil
+}
+
+func (f *fakeRepository) GetUserImageBatch(email string, limit int) ([]domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var batch []domain.Image
+	for _, img := range f.images {
+		if img.Email == email && len(batch) < limit {
+			batch = append(batch, img)
+		}
+	}
+	sort.Slice(batch, func(a, b int) bool { return batch[a].Filename < batch[b].Filename })
+	return batch, nil
+}
+
+func (f *fakeRepository) DeleteImage(filename string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, live := f.images[filename]
+	_, trashed := f.trash[filename]
+	if !live && !trashed {
+		return domain.ErrImageNotFound
+	}
+	delete(f.images, filename)
+	delete(f.trash, filename)
+	return nil
+}
+
+func (f *fakeRepository) SoftDeleteImage(filename string, deletedAt, purgeAt int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.images[filename]
+	if !ok {
+		return domain.ErrImageNotFound
+	}
+	img.DeletedAt = deletedAt
+	img.PurgeAt = purgeAt
+	f.trash[filename] = img
+	delete(f.images, filename)
+	return nil
+}
+
+func (f *fakeRepository) GetDeletedImage(filename string) (*domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.trash[filename]
+	if !ok {
+		return nil, domain.ErrImageNotFound
+	}
+	return &img, nil
+}
+
+func (f *fakeRepository) RestoreImage(filename string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.trash[filename]
+	if !ok {
+		return domain.ErrImageNotFound
+	}
+	img.DeletedAt = 0
+	img.PurgeAt = 0
+	f.images[filename] = img
+	delete(f.trash, filename)
+	return nil
+}
+
+func (f *fakeRepository) GetExpiredDeletedImages(before int64, limit int) ([]domain.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var images []domain.Image
+	for _, img := range f.trash {
+		if img.PurgeAt <= before && len(images) < limit {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+func (f *fakeRepository) ListImageBlobs() ([]domain.BlobInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	blobs := []domain.BlobInfo{}
+	for _, blob := range f.blobs {
+		blobs = append(blobs, blob)
+	}
+	sort.Slice(blobs, func(a, b int) bool { return blobs[a].Filename < blobs[b].Filename })
+	return blobs, nil
+}
+
+func (f *fakeRepository) ListImageFilenames() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filenames := []string{}
+	for filename := range f.images {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+func (f *fakeRepository) DeleteImageBlob(filename string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.blobs, filename)
+	return nil
+}
+
+func (f *fakeRepository) AnonymizeImage(filename, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.images[filename]
+	if !ok {
+		return domain.ErrImageNotFound
+	}
+	img.Email = owner
+	f.images[filename] = img
+	return nil
+}
+
+func (f *fakeRepository) RecordErasedImages(jobID string, filenames []string, removedAt int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.erased[jobID] = append(f.erased[jobID], filenames...)
+	return nil
+}
+
+func (f *fakeRepository) UpdateErasureJob(job domain.ErasureJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.erasures[job.ID] = job
+	return nil
+}
+
+func (f *fakeRepository) ListUserExportJobs(email string) ([]domain.ExportJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var jobs []domain.ExportJob
+	for _, job := range f.exports {
+		if job.Email == email {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (f *fakeRepository) CreateExportJob(job domain.ExportJob, check func([]domain.ExportJob) error) error {
+	jobs, _ := f.ListUserExportJobs(job.Email)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := check(jobs); err != nil {
+		return err
+	}
+	f.exports[job.ID] = job
+	return nil
+}
+
+func (f *fakeRepository) UpdateExportJob(job domain.ExportJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.exports[job.ID] = job
+	return nil
+}
+
+func (f *fakeRepository) CountUserImages(email string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var count int64
+	for _, img := range f.images {
+		if img.Email == email {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeRepository) ForEachUserImage(email string, fn func(domain.Image) error) error {
+	f.mu.Lock()
+	limit := len(f.images)
+	f.mu.Unlock()
+	images, _ := f.GetUserImageBatch(email, limit)
+	for _, img := range images {
+		if err := fn(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenImageBlob serves the filename as the content of every known blob.
+func (f *fakeRepository) OpenImageBlob(filename string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.blobs[filename]; !ok {
+		return nil, domain.ErrImageNotFound
+	}
+	return io.NopCloser(strings.NewReader(filename)), nil
+}
+
+// fakeArchiveWriter stores the archive on Close unless its context was
+// cancelled, like a GCS object writer.
+type fakeArchiveWriter struct {
+	bytes.Buffer
+	repo *fakeRepository
+	ctx  context.Context
+	id   string
+	fail bool
+}
+
+func (w *fakeArchiveWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errors.New("upload failed")
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *fakeArchiveWriter) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	w.repo.mu.Lock()
+	defer w.repo.mu.Unlock()
+	w.repo.archives[w.id] = w.Bytes()
+	return nil
+}
+
+func (f *fakeRepository) NewExportArchiveWriter(ctx context.Context, id string) io.WriteCloser {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &fakeArchiveWriter{repo: f, ctx: ctx, id: id, fail: f.failArchiveWrites}
+}
+
+func (f *fakeRepository) GetStaleExportJobs(before int64, limit int) ([]domain.ExportJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var jobs []domain.ExportJob
+	for _, job := range f.exports {
+		unfinished := job.Status == domain.ExportStatusPending || job.Status == domain.ExportStatusRunning
+		if unfinished && job.UpdatedAt < before && len(jobs) < limit {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (f *fakeRepository) GetExpiredExportJobs(before int64, limit int) ([]domain.ExportJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var jobs []domain.ExportJob
+	for _, job := range f.exports {
+		finished := job.Status == domain.ExportStatusCompleted || job.Status == domain.ExportStatusFailed
+		if finished && job.ExpiresAt <= before && len(jobs) < limit {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (f *fakeRepository) DeleteExportArchive(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.archives, id)
+	return nil
+}
+
+func (f *fakeRepository) DeleteExportJob(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.exports, id)
+	return nil
+}
+
+func (f *fakeRepository) DeleteUserWebhooks(email string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deleted := 0
+	for id, webhook := range f.webhooks {
+		if webhook.Email == email && webhook.Organization == "" {
+			delete(f.webhooks, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) SaveDeviceToken(device domain.DeviceToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices[device.Token] = device
+	return nil
+}
+
+func (f *fakeRepository) GetDeviceToken(token string) (*domain.DeviceToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	device, ok := f.devices[token]
+	if !ok {
+		return nil, domain.ErrDeviceNotFound
+	}
+	return &device, nil
+}
+
+func (f *fakeRepository) GetDeviceTokens(email string) ([]domain.DeviceToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var devices []domain.DeviceToken
+	for _, device := range f.devices {
+		if device.Email == email {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(a, b int) bool { return devices[a].Token < devices[b].Token })
+	return devices, nil
+}
+
+func (f *fakeRepository) DeleteDeviceToken(token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.devices, token)
+	return nil
+}
+
+func (f *fakeRepository) DeleteUserDeviceTokens(email string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deleted := 0
+	for token, device := range f.devices {
+		if device.Email == email {
+			delete(f.devices, token)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func idempotencyID(email, key string) string {
+	return email + "\x00" + key
+}
+
+func (f *fakeRepository) ReserveIdempotencyKey(record domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := idempotencyID(record.Email, record.Key)
+	if current, ok := f.idempotency[id]; ok && current.ExpiresAt.After(time.Now()) {
+		return &current, nil
+	}
+	f.idempotency[id] = record
+	return nil, nil
+}
+
+func (f *fakeRepository) CompleteIdempotencyKey(email, key, response string, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := idempotencyID(email, key)
+	record := f.idempotency[id]
+	record.Status = domain.IdempotencyStatusCompleted
+	record.Response = response
+	record.ExpiresAt = expiresAt
+	f.idempotency[id] = record
+	return nil
+}
+
+func (f *fakeRepository) DeleteIdempotencyKey(email, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.idempotency, idempotencyID(email, key))
+	return nil
+}
+
+func (f *fakeRepository) DeleteUserIdempotencyKeys(email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, record := range f.idempotency {
+		if record.Email == email {
+			delete(f.idempotency, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepository) DeleteExpiredIdempotencyKeys(before time.Time, limit int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deleted := 0
+	for id, record := range f.idempotency {
+		if deleted < limit && !record.ExpiresAt.After(before) {
+			delete(f.idempotency, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepository) CreateOutboxEntry(entry domain.OutboxEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outbox[entry.ID] = entry
+	return nil
+}
+
+func (f *fakeRepository) RecordOutboxFailure(entry domain.OutboxEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outbox[entry.ID] = entry
+	return nil
+}
+
+func newPagingTestService(repo *fakeRepository) *ImageService {
+	i := newTestService(repo)
+	i.cursorKey = []byte("test-cursor-key")
+	for n, filename := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"} {
+		repo.images[filename] = domain.Image{Email: "user@example.com", Filename: filename, CreatedAt: int64(n + 1)}
+	}
+	repo.images["other.jpg"] = domain.Image{Email: "other@example.com", Filename: "other.jpg", CreatedAt: 10}
+	return i
+}
+
+func pageFilenames(page *domain.ImagePage) string {
+	names := make([]string, 0, len(page.Items))
+	for _, img := range page.Items {
+		names = append(names, img.Filename)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestGetDetectionResultsPagesBothWays(t *testing.T) {
+	i := newPagingTestService(newFakeRepository())
+	var page *domain.ImagePage
+	for n, step := range []struct {
+		backward   bool
+		items      string
+		next, prev bool
+		more       bool
+	}{
+		// forward from the newest image to the oldest
+		{items: "e.jpg,d.jpg", next: true, more: true},
+		{items: "c.jpg,b.jpg", next: true, prev: true, more: true},
+		{items: "a.jpg", prev: true},
+		// and back to the start, hasMore now looks backward
+		{backward: true, items: "c.jpg,b.jpg", next: true, prev: true, more: true},
+		{backward: true, items: "e.jpg,d.jpg", next: true},
+	} {
+		filter := domain.PageFilter{PerPage: 2}
+		switch {
+		case page != nil && step.backward:
+			filter.Before = page.PrevCursor
+		case page != nil:
+			filter.After = page.NextCursor
+		}
+		var err error
+		if page, err = i.GetDetectionResults("user@example.com", &filter); err != nil {
+			t.Fatalf("step %v: %v", n, err)
+		}
+		if got := pageFilenames(page); got != step.items {
+			t.Fatalf("step %v: items = %v, want %v", n, got, step.items)
+		}
+		if page.HasNext != step.next || page.HasPrevious != step.prev || page.HasMore != step.more {
+			t.Fatalf("step %v: hasNext = %v, hasPrevious = %v, hasMore = %v, want %v, %v, %v",
+				n, page.HasNext, page.HasPrevious, page.HasMore, step.next, step.prev, step.more)
+		}
+		if (page.NextCursor != "") != page.HasNext || (page.PrevCursor != "") != page.HasPrevious {
+			t.Fatalf("step %v: cursors %q and %q disagree with the flags", n, page.NextCursor, page.PrevCursor)
+		}
+	}
+}
+
+func TestGetDetectionResultsRejectsBothCursors(t *testing.T) {
+	i := newPagingTestService(newFakeRepository())
+	first, err := i.GetDetectionResults("user@example.com", &domain.PageFilter{PerPage: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := domain.PageFilter{PerPage: 2, After: first.NextCursor, Before: first.NextCursor}
+	if _, err = i.GetDetectionResults("user@example.com", &filter); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Fatalf("GetDetectionResults = %v, want %v", err, domain.ErrInvalidCursor)
+	}
+	filter = domain.PageFilter{PerPage: 2, After: first.NextCursor, SortBy: domain.SortByConfidence}
+	if _, err = i.GetDetectionResults("user@example.com", &filter); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Fatalf("cursor of another order = %v, want %v", err, domain.ErrInvalidCursor)
+	}
+}
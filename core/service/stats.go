@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"image-service/core/domain"
+	"log"
+	"sync"
+	"time"
+	_ "time/tzdata"
+)
+
+const DefaultStatsCacheTTL = 5 * time.Minute
+
+type statsCacheEntry struct {
+	email     string
+	stats     *domain.DetectionStats
+	expiresAt time.Time
+}
+
+type statsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]statsCacheEntry
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{
+		ttl:     ttl,
+		entries: map[string]statsCacheEntry{},
+	}
+}
+
+func (c *statsCache) get(key string) *domain.DetectionStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return entry.stats
+}
+
+func (c *statsCache) set(key, email string, stats *domain.DetectionStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = statsCacheEntry{
+		email:     email,
+		stats:     stats,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// invalidate drops every cached filter of the user, so a result that just
+// landed shows up on the next poll instead of after the TTL.
+func (c *statsCache) invalidate(email string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if entry.email == email {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func bucketStart(t time.Time, size domain.StatsBucketSize) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch size {
+	case domain.StatsBucketWeek:
+		// weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case domain.StatsBucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return day
+}
+
+func nextBucket(t time.Time, size domain.StatsBucketSize) time.Time {
+	switch size {
+	case domain.StatsBucketWeek:
+		return t.AddDate(0, 0, 7)
+	case domain.StatsBucketMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func computeDetectionStats(i *ImageService, email string, filter domain.StatsFilter) (*domain.DetectionStats, error) {
+	loc, err := time.LoadLocation(filter.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(loc)
+	since := bucketStart(now.AddDate(0, 0, -filter.Days+1), domain.StatsBucketDay)
+
+	stats := domain.DetectionStats{
+		StatsFilter:              filter,
+		ByLabel:                  map[string]int{},
+		AverageConfidenceByLabel: map[string]float64{},
+		Timeline:                 []domain.StatsBucket{},
+		GeneratedAt:              now.UnixMilli(),
+	}
+	index := map[int64]int{}
+	for start := bucketStart(since, filter.Bucket); !start.After(now); start = nextBucket(start, filter.Bucket) {
+		index[start.UnixMilli()] = len(stats.Timeline)
+		// a week or month bucket may begin before since, but only images from
+		// since are loaded, so the first bucket starts there
+		from := start
+		if from.Before(since) {
+			from = since
+		}
+		stats.Timeline = append(stats.Timeline, domain.StatsBucket{
+			Start:   from.Format("2006-01-02"),
+			StartAt: from.UnixMilli(),
+			ByLabel: map[string]int{},
+		})
+	}
+
+	var confidenceSum float64
+	confidenceByLabel := map[string]float64{}
+	err = i.repo.ForEachDetection(email, since.UnixMilli(), func(img domain.Image) error {
+		stats.Total++
+		switch img.Status {
+		case domain.ImageStatusDetected:
+			stats.Detected++
+			stats.ByLabel[img.Label]++
+			confidenceSum += img.Confidence
+			confidenceByLabel[img.Label] += img.Confidence
+		case domain.ImageStatusFailed, domain.ImageStatusRejected:
+			stats.Failed++
+		default:
+			stats.Pending++
+		}
+
+		start := bucketStart(time.UnixMilli(img.CreatedAt).In(loc), filter.Bucket).UnixMilli()
+		if n, ok := index[start]; ok {
+			stats.Timeline[n].Count++
+			if img.Status == domain.ImageStatusDetected {
+				stats.Timeline[n].ByLabel[img.Label]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.Detected > 0 {
+		stats.AverageConfidence = confidenceSum / float64(stats.Detected)
+	}
+	for label, sum := range confidenceByLabel {
+		stats.AverageConfidenceByLabel[label] = sum / float64(stats.ByLabel[label])
+	}
+	return &stats, nil
+}
+
+// GetDetectionStats aggregates the user's images over the last filter.Days
+// days. Results are cached for a short while so dashboards polling the
+// endpoint do not rescan every image.
+func (i *ImageService) GetDetectionStats(email string, filter domain.StatsFilter) (*domain.DetectionStats, error) {
+	key := fmt.Sprintf("%v|%v|%v|%v", email, filter.Days, filter.Bucket, filter.TimeZone)
+	if stats := i.statsCache.get(key); stats != nil {
+		return stats, nil
+	}
+
+	stats, err := computeDetectionStats(i, email, filter)
+	if err != nil {
+		log.Printf("[ImageService.GetDetectionStats] error when compute detection stats with error %v \n", err)
+		return nil, err
+	}
+	i.statsCache.set(key, email, stats)
+	return stats, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"image-service/core/domain"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a Thursday evening
+	at := time.Date(2024, time.March, 14, 21, 30, 0, 0, loc)
+	for size, want := range map[domain.StatsBucketSize]time.Time{
+		domain.StatsBucketDay:   time.Date(2024, time.March, 14, 0, 0, 0, 0, loc),
+		domain.StatsBucketWeek:  time.Date(2024, time.March, 11, 0, 0, 0, 0, loc),
+		domain.StatsBucketMonth: time.Date(2024, time.March, 1, 0, 0, 0, 0, loc),
+	} {
+		if got := bucketStart(at, size); !got.Equal(want) {
+			t.Errorf("bucketStart(%v) = %v, want %v", size, got, want)
+		}
+	}
+}
+
+func TestGetDetectionStats(t *testing.T) {
+	repo := newFakeRepository()
+	now := time.Now().UnixMilli()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Email: "user@example.com", CreatedAt: now, Status: domain.ImageStatusDetected, Label: "rust", Confidence: 0.8}
+	repo.images["b.jpg"] = domain.Image{Filename: "b.jpg", Email: "user@example.com", CreatedAt: now, Status: domain.ImageStatusDetected, Label: "rust", Confidence: 0.6}
+	repo.images["c.jpg"] = domain.Image{Filename: "c.jpg", Email: "user@example.com", CreatedAt: now, Status: domain.ImageStatusRejected}
+	repo.images["d.jpg"] = domain.Image{Filename: "d.jpg", Email: "user@example.com", CreatedAt: now, Status: domain.ImageStatusQueued}
+	repo.images["old.jpg"] = domain.Image{Filename: "old.jpg", Email: "user@example.com", CreatedAt: time.Now().AddDate(0, 0, -30).UnixMilli(), Status: domain.ImageStatusDetected}
+	repo.images["other.jpg"] = domain.Image{Filename: "other.jpg", Email: "other@example.com", CreatedAt: now, Status: domain.ImageStatusDetected}
+	i := newTestService(repo)
+	i.statsCache = newStatsCache(time.Minute)
+	filter := domain.StatsFilter{Days: 7, Bucket: domain.StatsBucketDay, TimeZone: "UTC"}
+
+	stats, err := i.GetDetectionStats("user@example.com", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 4 || stats.Detected != 2 || stats.Failed != 1 || stats.Pending != 1 || stats.ByLabel["rust"] != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if math.Abs(stats.AverageConfidence-0.7) > 1e-9 || math.Abs(stats.AverageConfidenceByLabel["rust"]-0.7) > 1e-9 {
+		t.Fatalf("average confidence = %v, by label %v", stats.AverageConfidence, stats.AverageConfidenceByLabel)
+	}
+	if len(stats.Timeline) != 7 {
+		t.Fatalf("timeline has %v buckets, want 7", len(stats.Timeline))
+	}
+	if today := stats.Timeline[6]; today.Count != 4 || today.ByLabel["rust"] != 2 {
+		t.Fatalf("today = %+v", today)
+	}
+
+	// dashboards polling the same filter are served from the cache
+	if _, err = i.GetDetectionStats("user@example.com", filter); err != nil {
+		t.Fatal(err)
+	}
+	filter.TimeZone = "Asia/Jakarta"
+	if _, err = i.GetDetectionStats("user@example.com", filter); err != nil {
+		t.Fatal(err)
+	}
+	if repo.scans != 2 {
+		t.Fatalf("scanned images %v times, want 2", repo.scans)
+	}
+}
+
+func TestGetDetectionStatsClampsFirstBucket(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	filter := domain.StatsFilter{Days: 30, Bucket: domain.StatsBucketMonth, TimeZone: "UTC"}
+
+	stats, err := i.GetDetectionStats("user@example.com", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	since := bucketStart(now.AddDate(0, 0, -filter.Days+1), domain.StatsBucketDay)
+	if first := stats.Timeline[0]; first.StartAt != since.UnixMilli() || first.Start != since.Format("2006-01-02") {
+		t.Fatalf("first bucket = %+v, want it to start at %v", first, since)
+	}
+	if len(stats.Timeline) > 1 {
+		if second := stats.Timeline[1]; second.StartAt != bucketStart(now, domain.StatsBucketMonth).UnixMilli() {
+			t.Fatalf("second bucket = %+v, want the start of this month", second)
+		}
+	}
+}
+
+func TestUpdateImageResultInvalidatesStats(t *testing.T) {
+	repo := newFakeRepository()
+	now := time.Now().UnixMilli()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Email: "user@example.com", CreatedAt: now, Status: domain.ImageStatusQueued}
+	repo.images["b.jpg"] = domain.Image{Filename: "b.jpg", Email: "other@example.com", CreatedAt: now, Status: domain.ImageStatusQueued}
+	i := newTestService(repo)
+	filter := domain.StatsFilter{Days: 7, Bucket: domain.StatsBucketDay, TimeZone: "UTC"}
+
+	if _, err := i.GetDetectionStats("user@example.com", filter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.GetDetectionStats("other@example.com", filter); err != nil {
+		t.Fatal(err)
+	}
+	err := i.UpdateImageResult(domain.UpdateImagePayloadData{Filename: "a.jpg", Label: "rust", Confidence: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := i.GetDetectionStats("user@example.com", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Detected != 1 || stats.Pending != 0 {
+		t.Fatalf("stats = %+v, want the new result counted", stats)
+	}
+	if _, err = i.GetDetectionStats("other@example.com", filter); err != nil {
+		t.Fatal(err)
+	}
+	if repo.scans != 3 {
+		t.Fatalf("scanned images %v times, want only the user's stats recomputed", repo.scans)
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"log"
+	"time"
+)
+
+var allowedStatusTransitions = map[domain.ImageStatus][]domain.ImageStatus{
+	domain.ImageStatusUploaded: {
+		domain.ImageStatusQueued,
+		domain.ImageStatusProcessing,
+		domain.ImageStatusDetected,
+		domain.ImageStatusFailed,
+		domain.ImageStatusRejected,
+	},
+	domain.ImageStatusQueued: {
+		domain.ImageStatusQueued,
+		domain.ImageStatusProcessing,
+		domain.ImageStatusDetected,
+		domain.ImageStatusFailed,
+		domain.ImageStatusRejected,
+	},
+	domain.ImageStatusProcessing: {
+		domain.ImageStatusQueued,
+		domain.ImageStatusDetected,
+		domain.ImageStatusFailed,
+		domain.ImageStatusRejected,
+	},
+	domain.ImageStatusFailed: {
+		domain.ImageStatusQueued,
+	},
+}
+
+func canTransition(from, to domain.ImageStatus) bool {
+	for _, next := range allowedStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func newStatusTransition(i *ImageService, filename string, to domain.ImageStatus) (*domain.Image, *domain.StatusTransition, error) {
+	if !to.IsValid() {
+		return nil, nil, domain.ErrInvalidStatus
+	}
+	img, err := i.repo.GetImage(filename)
+	if err != nil {
+		log.Printf("[ImageService.newStatusTransition] error when retrieve image with error %v \n", err)
+		return nil, nil, err
+	}
+	from := img.CurrentStatus()
+	if !canTransition(from, to) {
+		log.Printf("[ImageService.newStatusTransition] transition from %v to %v is not allowed for %v \n", from, to, filename)
+		return nil, nil, domain.ErrInvalidStatusTransition
+	}
+	return img, &domain.StatusTransition{
+		From: from,
+		To:   to,
+		At:   time.Now().UnixMilli(),
+	}, nil
+}
+
+func (i *ImageService) UpdateImageStatus(payload domain.UpdateImageStatusPayload) error {
+	img, transition, err := newStatusTransition(i, payload.Filename, payload.Status)
+	if err != nil {
+		return err
+	}
+	err = i.repo.UpdateImageStatus(payload.Filename, *transition)
+	if err != nil {
+		log.Printf("[ImageService.UpdateImageStatus] error update image status with error %v \n", err)
+		return err
+	}
+	i.statsCache.invalidate(img.Email)
+	publishStatusEvent(i, payload.Filename)
+	return nil
+}
+
+// BackfillImageStatuses stores the status of images written before the
+// status field existed, so status filters, includePending and the reaper
+// see them. The status is derived the way CurrentStatus reads it.
+func (i *ImageService) BackfillImageStatuses(dryRun bool) (*domain.StatusBackfillReport, error) {
+	report := domain.StatusBackfillReport{
+		DryRun: dryRun,
+	}
+	err := i.repo.ForEachImageWithoutStatus(func(img domain.Image) error {
+		report.ScannedImages++
+		if dryRun {
+			return nil
+		}
+
+		current := img.CurrentStatus()
+		at := img.CreatedAt
+		if current == domain.ImageStatusDetected && img.DetectedAt > 0 {
+			at = img.DetectedAt
+		}
+		err := i.repo.UpdateImageStatus(img.Filename, domain.StatusTransition{
+			From: current,
+			To:   current,
+			At:   at,
+		})
+		if errors.Is(err, domain.ErrInvalidStatusTransition) {
+			// a writer stored a status since the scan read the document
+			return nil
+		}
+		if err != nil {
+			log.Printf("[ImageService.BackfillImageStatuses] error when backfill status of %v with error %v \n", img.Filename, err)
+			return err
+		}
+		report.Backfilled++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
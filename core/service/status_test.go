@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	for _, tt := range []struct {
+		from, to domain.ImageStatus
+		want     bool
+	}{
+		{domain.ImageStatusUploaded, domain.ImageStatusQueued, true},
+		{domain.ImageStatusQueued, domain.ImageStatusQueued, true},
+		{domain.ImageStatusProcessing, domain.ImageStatusDetected, true},
+		{domain.ImageStatusFailed, domain.ImageStatusQueued, true},
+		{domain.ImageStatusFailed, domain.ImageStatusDetected, false},
+		{domain.ImageStatusDetected, domain.ImageStatusQueued, false},
+		{domain.ImageStatusRejected, domain.ImageStatusProcessing, false},
+		{domain.ImageStatusProcessing, domain.ImageStatusUploaded, false},
+	} {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%v, %v) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateImageStatus(t *testing.T) {
+	repo := newFakeRepository()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Status: domain.ImageStatusQueued}
+	repo.images["b.jpg"] = domain.Image{Filename: "b.jpg", Status: domain.ImageStatusDetected}
+	i := newTestService(repo)
+
+	err := i.UpdateImageStatus(domain.UpdateImageStatusPayload{Filename: "a.jpg", Status: domain.ImageStatusProcessing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img := repo.images["a.jpg"]; img.Status != domain.ImageStatusProcessing || img.StatusUpdatedAt == 0 {
+		t.Fatalf("image = %+v", img)
+	}
+
+	err = i.UpdateImageStatus(domain.UpdateImageStatusPayload{Filename: "b.jpg", Status: domain.ImageStatusProcessing})
+	if !errors.Is(err, domain.ErrInvalidStatusTransition) {
+		t.Fatalf("UpdateImageStatus = %v, want %v", err, domain.ErrInvalidStatusTransition)
+	}
+	err = i.UpdateImageStatus(domain.UpdateImageStatusPayload{Filename: "a.jpg", Status: "unknown"})
+	if !errors.Is(err, domain.ErrInvalidStatus) {
+		t.Fatalf("UpdateImageStatus = %v, want %v", err, domain.ErrInvalidStatus)
+	}
+}
+
+func newBackfillRepository() *fakeRepository {
+	repo := newFakeRepository()
+	repo.images["legacy.jpg"] = domain.Image{Filename: "legacy.jpg", CreatedAt: 100}
+	repo.images["detected.jpg"] = domain.Image{Filename: "detected.jpg", CreatedAt: 100, IsDetected: true, DetectedAt: 200}
+	repo.images["current.jpg"] = domain.Image{Filename: "current.jpg", CreatedAt: 100, Status: domain.ImageStatusQueued, StatusUpdatedAt: 300}
+	return repo
+}
+
+func TestBackfillImageStatusesDryRun(t *testing.T) {
+	repo := newBackfillRepository()
+	report, err := newTestService(repo).BackfillImageStatuses(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (domain.StatusBackfillReport{DryRun: true, ScannedImages: 2}) {
+		t.Fatalf("report = %+v", report)
+	}
+	if repo.images["legacy.jpg"].Status != "" {
+		t.Fatal("dry run stored a status")
+	}
+}
+
+func TestBackfillImageStatuses(t *testing.T) {
+	repo := newBackfillRepository()
+	report, err := newTestService(repo).BackfillImageStatuses(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *report != (domain.StatusBackfillReport{ScannedImages: 2, Backfilled: 2}) {
+		t.Fatalf("report = %+v", report)
+	}
+	for filename, want := range map[string]domain.Image{
+		"legacy.jpg":   {Status: domain.ImageStatusUploaded, StatusUpdatedAt: 100},
+		"detected.jpg": {Status: domain.ImageStatusDetected, StatusUpdatedAt: 200},
+		"current.jpg":  {Status: domain.ImageStatusQueued, StatusUpdatedAt: 300},
+	} {
+		img := repo.images[filename]
+		if img.Status != want.Status || img.StatusUpdatedAt != want.StatusUpdatedAt {
+			t.Errorf("%v has status %v at %v, want %v at %v", filename, img.Status, img.StatusUpdatedAt, want.Status, want.StatusUpdatedAt)
+		}
+	}
+}
+
+// staleScanRepository hands the backfill a document read before another
+// writer stored its status.
+type staleScanRepository struct {
+	*fakeRepository
+}
+
+func (r staleScanRepository) ForEachImageWithoutStatus(fn func(domain.Image) error) error {
+	return fn(domain.Image{Filename: "current.jpg", CreatedAt: 100})
+}
+
+func TestBackfillImageStatusesSkipsConcurrentWrites(t *testing.T) {
+	repo := newBackfillRepository()
+	i := newTestService(repo)
+	i.repo = staleScanRepository{repo}
+
+	report, err := i.BackfillImageStatuses(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ScannedImages != 1 || report.Backfilled != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if img := repo.images["current.jpg"]; img.Status != domain.ImageStatusQueued || img.StatusUpdatedAt != 300 {
+		t.Fatalf("backfill overwrote %+v", img)
+	}
+}
+
+func TestReportImageFailureRetries(t *testing.T) {
+	repo := newFakeRepository()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Status: domain.ImageStatusProcessing, Attempts: 1}
+	i := newTestService(repo)
+
+	err := i.ReportImageFailure(domain.UpdateImageFailurePayload{Filename: "a.jpg", ErrorCode: "oom", Message: "out of memory", Retryable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := repo.images["a.jpg"]
+	if img.Status != domain.ImageStatusFailed || img.Failure == nil || img.Failure.Code != "oom" || !img.Failure.Retryable {
+		t.Fatalf("image = %+v", img)
+	}
+	if _, ok := repo.outbox["a.jpg-2"]; !ok {
+		t.Fatalf("outbox = %+v, want a second dispatch", repo.outbox)
+	}
+}
+
+func TestReportImageFailureStopsRetrying(t *testing.T) {
+	for name, tt := range map[string]struct {
+		attempts  int
+		retryable bool
+	}{
+		"not retryable":   {1, false},
+		"out of attempts": {DefaultMaxDispatchAttempts, true},
+	} {
+		repo := newFakeRepository()
+		repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Status: domain.ImageStatusProcessing, Attempts: tt.attempts}
+		i := newTestService(repo)
+
+		err := i.ReportImageFailure(domain.UpdateImageFailurePayload{Filename: "a.jpg", ErrorCode: "corrupt", Retryable: tt.retryable})
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if repo.images["a.jpg"].Status != domain.ImageStatusFailed || len(repo.outbox) != 0 {
+			t.Fatalf("%v: image %+v, outbox %+v", name, repo.images["a.jpg"], repo.outbox)
+		}
+	}
+}
+
+func TestReportImageFailureAfterResult(t *testing.T) {
+	repo := newFakeRepository()
+	repo.images["a.jpg"] = domain.Image{Filename: "a.jpg", Status: domain.ImageStatusDetected}
+	i := newTestService(repo)
+
+	err := i.ReportImageFailure(domain.UpdateImageFailurePayload{Filename: "a.jpg", ErrorCode: "late", Retryable: true})
+	if !errors.Is(err, domain.ErrInvalidStatusTransition) {
+		t.Fatalf("ReportImageFailure = %v, want %v", err, domain.ErrInvalidStatusTransition)
+	}
+	if repo.images["a.jpg"].Failure != nil {
+		t.Fatal("a late failure overwrote the result")
+	}
+}
@@ -0,0 +1,475 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-service/core/domain"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultWebhookInterval    = 10 * time.Second
+	DefaultWebhookMaxAttempts = 6
+	DefaultWebhookTimeout     = 10 * time.Second
+	webhookBaseBackoff        = 30 * time.Second
+	webhookLockName           = "webhook-dispatcher"
+	webhookBatchSize          = 50
+	webhookDeliveryLogSize    = 100
+)
+
+var webhookEventTypes = map[string]bool{
+	domain.EventDetectionCompleted: true,
+	domain.EventImageStatusChanged: true,
+	"*":                            true,
+}
+
+type webhookPayload struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	CreatedAt int64        `json:"createdAt"`
+	Data      webhookImage `json:"data"`
+}
+
+// webhookImage is the part of an image a webhook receives: which image, its
+// status and its result. The file URL and owner stay behind the API.
+type webhookImage struct {
+	Filename      string                   `json:"filename"`
+	Status        domain.ImageStatus       `json:"status"`
+	Label         string                   `json:"label,omitempty"`
+	Confidence    float64                  `json:"confidence,omitempty"`
+	ModelVersion  string                   `json:"modelVersion,omitempty"`
+	InferenceTime int64                    `json:"inferenceTime,omitempty"`
+	DetectedAt    int64                    `json:"detectedAt,omitempty"`
+	Failure       *domain.DetectionFailure `json:"failure,omitempty"`
+}
+
+func webhookImageFromEvent(event domain.DetectionEvent) webhookImage {
+	data := webhookImage{
+		Filename: event.Filename,
+		Status:   event.Status,
+	}
+	if img := event.Image; img != nil {
+		data.Label = img.Label
+		data.Confidence = img.Confidence
+		data.ModelVersion = img.ModelVersion
+		data.InferenceTime = img.InferenceTime
+		data.DetectedAt = img.DetectedAt
+		data.Failure = img.Failure
+	}
+	return data
+}
+
+// signWebhookPayload signs "<timestamp>.<body>" so receivers can reject
+// replayed payloads by checking the timestamp.
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// metadataAddress is the instance metadata server of the cloud providers.
+var metadataAddress = net.IPv4(169, 254, 169, 254)
+
+// sharedAddressSpace is the carrier-grade NAT range, not reachable from the
+// internet either.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicAddress reports whether ip may be the target of a webhook. Anything
+// inside the cluster network would let a user probe internal services.
+func isPublicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		ip.Equal(metadataAddress) || sharedAddressSpace.Contains(ip))
+}
+
+// newWebhookClient checks the address every connection is made to, after the
+// host was resolved, so a DNS name can't point it at an internal address.
+// Redirects are not followed, the response to the first request counts.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicAddress(ip) {
+				return fmt.Errorf("webhook address %v is not allowed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// validateWebhookURL rejects what can be told from the url alone, the
+// resolved address is checked again on every delivery.
+func validateWebhookURL(raw string) (*url.URL, error) {
+	target, err := url.Parse(raw)
+	if err != nil || target.Scheme != "https" || target.Hostname() == "" {
+		return nil, domain.ErrInvalidWebhook.Errorf("invalid webhook: url should be an absolute https url")
+	}
+	host := strings.ToLower(target.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return nil, domain.ErrInvalidWebhook.Errorf("invalid webhook: url should point to a public host")
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicAddress(ip) {
+		return nil, domain.ErrInvalidWebhook.Errorf("invalid webhook: url should point to a public host")
+	}
+	return target, nil
+}
+
+// sealWebhookSecret encrypts the signing secret with AES-GCM, the nonce is
+// kept in front of the ciphertext.
+func sealWebhookSecret(key []byte, secret string) (string, error) {
+	gcm, err := newWebhookCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func openWebhookSecret(key []byte, sealed string) (string, error) {
+	gcm, err := newWebhookCipher(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("malformed webhook secret")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// parseWebhookKey reads the hex encoded AES-256 key webhook secrets are
+// encrypted with. Without one no webhook can be created.
+func parseWebhookKey(raw string) ([]byte, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("WEBHOOK_SECRET_KEY should be 64 hex characters")
+	}
+	return key, nil
+}
+
+func newWebhookCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, domain.ErrWebhooksDisabled
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// webhookSecret returns the secret deliveries of the webhook are signed with.
+func webhookSecret(i *ImageService, webhook *domain.Webhook) (string, error) {
+	return openWebhookSecret(i.webhookKey, webhook.EncryptedSecret)
+}
+
+func canManageWebhook(caller domain.Uploader, webhook *domain.Webhook) bool {
+	if webhook.Organization != "" {
+		return webhook.Organization == caller.Organization
+	}
+	return webhook.Email == caller.Email
+}
+
+func (i *ImageService) CreateWebhook(caller domain.Uploader, payload domain.CreateWebhookPayload) (*domain.CreatedWebhook, error) {
+	if len(i.webhookKey) == 0 {
+		return nil, domain.ErrWebhooksDisabled
+	}
+	target, err := validateWebhookURL(payload.URL)
+	if err != nil {
+		return nil, err
+	}
+	events := payload.Events
+	if len(events) == 0 {
+		events = []string{domain.EventDetectionCompleted}
+	}
+	for _, event := range events {
+		if !webhookEventTypes[event] {
+			return nil, domain.ErrInvalidWebhook.Errorf("invalid webhook: unknown event %q", event)
+		}
+	}
+	organization := ""
+	if payload.Organization {
+		if caller.Organization == "" {
+			return nil, domain.ErrInvalidWebhook.Errorf("invalid webhook: caller does not belong to an organization")
+		}
+		organization = caller.Organization
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encryptedSecret, err := sealWebhookSecret(i.webhookKey, hex.EncodeToString(secret))
+	if err != nil {
+		log.Printf("[ImageService.CreateWebhook] error when encrypt secret with error %v \n", err)
+		return nil, err
+	}
+	webhook := domain.Webhook{
+		ID:              uuid.NewString(),
+		Email:           caller.Email,
+		Organization:    organization,
+		URL:             target.String(),
+		Events:          events,
+		EncryptedSecret: encryptedSecret,
+		CreatedAt:       time.Now().UnixMilli(),
+	}
+	if err = i.repo.CreateWebhook(webhook); err != nil {
+		log.Printf("[ImageService.CreateWebhook] error when create webhook with error %v \n", err)
+		return nil, err
+	}
+	return &domain.CreatedWebhook{
+		Webhook: webhook,
+		Secret:  hex.EncodeToString(secret),
+	}, nil
+}
+
+func (i *ImageService) ListWebhooks(caller domain.Uploader) ([]domain.Webhook, error) {
+	webhooks, err := i.repo.ListWebhooks(caller.Email, caller.Organization)
+	if err != nil {
+		log.Printf("[ImageService.ListWebhooks] error when retrieve webhooks with error %v \n", err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func getManagedWebhook(i *ImageService, caller domain.Uploader, id string) (*domain.Webhook, error) {
+	webhook, err := i.repo.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canManageWebhook(caller, webhook) {
+		return nil, domain.ErrWebhookForbidden
+	}
+	return webhook, nil
+}
+
+func (i *ImageService) DeleteWebhook(caller domain.Uploader, id string) error {
+	if _, err := getManagedWebhook(i, caller, id); err != nil {
+		return err
+	}
+	return i.repo.DeleteWebhook(id)
+}
+
+func (i *ImageService) ListWebhookDeliveries(caller domain.Uploader, id string) ([]domain.WebhookDelivery, error) {
+	if _, err := getManagedWebhook(i, caller, id); err != nil {
+		return nil, err
+	}
+	return i.repo.ListWebhookDeliveries(id, webhookDeliveryLogSize)
+}
+
+// RedeliverWebhook queues a new delivery with the payload of an earlier one,
+// the original stays in the log untouched.
+func (i *ImageService) RedeliverWebhook(caller domain.Uploader, deliveryID string) (*domain.WebhookDelivery, error) {
+	original, err := i.repo.GetWebhookDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = getManagedWebhook(i, caller, original.WebhookID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	delivery := domain.WebhookDelivery{
+		ID:            uuid.NewString(),
+		WebhookID:     original.WebhookID,
+		Email:         original.Email,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        domain.WebhookDeliveryPending,
+		NextAttemptAt: now,
+		RedeliveryOf:  original.ID,
+		CreatedAt:     now,
+	}
+	if err = i.repo.CreateWebhookDelivery(delivery); err != nil {
+		log.Printf("[ImageService.RedeliverWebhook] error when create delivery with error %v \n", err)
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// enqueueWebhookDeliveries records a pending delivery for every webhook
+// interested in the event. Delivery IDs are derived from the event so a
+// repeated publish doesn't send twice.
+func enqueueWebhookDeliveries(i *ImageService, event domain.DetectionEvent) {
+	webhooks, err := i.repo.ListWebhooks(event.Email, event.Image.Organization)
+	if err != nil {
+		log.Printf("[ImageService.enqueueWebhookDeliveries] error when retrieve webhooks with error %v \n", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.At,
+		Data:      webhookImageFromEvent(event),
+	})
+	if err != nil {
+		log.Printf("[ImageService.enqueueWebhookDeliveries] error when encode payload with error %v \n", err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(event.Type) {
+			continue
+		}
+		err = i.repo.CreateWebhookDelivery(domain.WebhookDelivery{
+			ID:            fmt.Sprintf("%v-%v", webhook.ID, event.ID),
+			WebhookID:     webhook.ID,
+			Email:         event.Email,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(body),
+			Status:        domain.WebhookDeliveryPending,
+			NextAttemptAt: event.At,
+			CreatedAt:     event.At,
+		})
+		if err != nil {
+			log.Printf("[ImageService.enqueueWebhookDeliveries] error when create delivery for webhook %v with error %v \n", webhook.ID, err)
+		}
+	}
+}
+
+func sendWebhook(i *ImageService, webhook *domain.Webhook, delivery domain.WebhookDelivery) (int, error) {
+	secret, err := webhookSecret(i, webhook)
+	if err != nil {
+		return 0, err
+	}
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", webhook.ID)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhookPayload(secret, timestamp, body))
+
+	res, err := i.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+func attemptWebhookDelivery(i *ImageService, delivery domain.WebhookDelivery) error {
+	now := time.Now()
+	webhook, err := i.repo.GetWebhook(delivery.WebhookID)
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		delivery.Status = domain.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+		return i.repo.UpdateWebhookDelivery(delivery)
+	}
+	if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode, err = sendWebhook(i, webhook, delivery)
+	switch {
+	case err == nil:
+		delivery.Status = domain.WebhookDeliverySucceeded
+		delivery.DeliveredAt = now.UnixMilli()
+		delivery.LastError = ""
+	case delivery.Attempts >= i.webhookMaxAttempts:
+		delivery.Status = domain.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(redispatchDelay(webhookBaseBackoff, delivery.Attempts-1)).UnixMilli()
+		delivery.LastError = err.Error()
+	}
+	return i.repo.UpdateWebhookDelivery(delivery)
+}
+
+func deliverWebhooks(i *ImageService) error {
+	lock, err := acquireLease(i, webhookLockName, i.webhookInterval)
+	if err != nil || lock == nil {
+		return err
+	}
+	defer lock.Release()
+
+	deliveries, err := i.repo.GetDueWebhookDeliveries(time.Now().UnixMilli(), webhookBatchSize)
+	if err != nil {
+		log.Printf("[ImageService.deliverWebhooks] error when retrieve deliveries with error %v \n", err)
+		return err
+	}
+	for _, delivery := range deliveries {
+		if err = attemptWebhookDelivery(i, delivery); err != nil {
+			log.Printf("[ImageService.deliverWebhooks] error when deliver %v with error %v \n", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+func (i *ImageService) StartWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(i.webhookInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := deliverWebhooks(i); err != nil {
+				log.Printf("[ImageService.StartWebhookDispatcher] error when deliver webhooks with error %v \n", err)
+			}
+		}
+	}
+}
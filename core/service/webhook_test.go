@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"image-service/core/domain"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	for _, raw := range []string{
+		"https://hooks.example.com/detections",
+		"https://203.0.113.7:8443/hook",
+	} {
+		if _, err := validateWebhookURL(raw); err != nil {
+			t.Errorf("validateWebhookURL(%q) = %v", raw, err)
+		}
+	}
+	for _, raw := range []string{
+		"http://hooks.example.com/detections",
+		"https:///path",
+		"ftp://hooks.example.com",
+		"https://localhost/hook",
+		"https://metadata.google.internal/computeMetadata/v1/",
+		"https://127.0.0.1/hook",
+		"https://10.0.0.5/hook",
+		"https://192.168.1.1/hook",
+		"https://169.254.169.254/latest/meta-data/",
+		"https://[::1]/hook",
+		"https://[fe80::1]/hook",
+		"https://0.0.0.0/hook",
+		"https://100.64.0.1/hook",
+	} {
+		if _, err := validateWebhookURL(raw); !errors.Is(err, domain.ErrInvalidWebhook) {
+			t.Errorf("validateWebhookURL(%q) = %v, want %v", raw, err, domain.ErrInvalidWebhook)
+		}
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	_, err := newWebhookClient(time.Second).Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("post to %v = %v, want the address refused", server.URL, err)
+	}
+	if called {
+		t.Fatal("request reached the loopback server")
+	}
+}
+
+func TestWebhookClientDoesNotFollowRedirects(t *testing.T) {
+	client := newWebhookClient(time.Second)
+	// the dial check is covered above, here only the redirect policy matters
+	client.Transport = http.DefaultTransport
+	followed := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := client.Post(server.URL+"/hook", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if followed || res.StatusCode != http.StatusFound {
+		t.Fatalf("status = %v, followed = %v, want the redirect returned as is", res.StatusCode, followed)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	if !isPublicAddress(net.ParseIP("8.8.8.8")) || !isPublicAddress(net.ParseIP("2001:4860:4860::8888")) {
+		t.Fatal("public address rejected")
+	}
+	if isPublicAddress(net.ParseIP("::ffff:127.0.0.1")) {
+		t.Fatal("ipv4 mapped loopback accepted")
+	}
+}
+
+func TestWebhookSecretRoundTrip(t *testing.T) {
+	key, err := parseWebhookKey(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealWebhookSecret(key, "signing-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "signing-secret") {
+		t.Fatal("sealed secret contains the plaintext")
+	}
+	secret, err := openWebhookSecret(key, sealed)
+	if err != nil || secret != "signing-secret" {
+		t.Fatalf("openWebhookSecret = %q, %v", secret, err)
+	}
+
+	other, _ := parseWebhookKey(strings.Repeat("cd", 32))
+	if _, err = openWebhookSecret(other, sealed); err == nil {
+		t.Fatal("secret opened with another key")
+	}
+	if _, err = parseWebhookKey("short"); err == nil {
+		t.Fatal("invalid key accepted")
+	}
+}
+
+func TestWebhookSecretNeedsTheKey(t *testing.T) {
+	i := &ImageService{}
+	if _, err := webhookSecret(i, &domain.Webhook{EncryptedSecret: "c2VhbGVk"}); !errors.Is(err, domain.ErrWebhooksDisabled) {
+		t.Fatalf("webhookSecret without key = %v, want %v", err, domain.ErrWebhooksDisabled)
+	}
+}
+
+func TestWebhookPayloadLeavesOutFileURLAndOwner(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	repo.webhooks["webhook-1"] = domain.Webhook{ID: "webhook-1", Email: "user@example.com", Events: []string{"*"}}
+
+	enqueueWebhookDeliveries(i, domain.DetectionEvent{
+		ID:       "event-1",
+		Type:     domain.EventDetectionCompleted,
+		Email:    "user@example.com",
+		Filename: "a.jpg",
+		Status:   domain.ImageStatusDetected,
+		Image: &domain.Image{
+			Email:      "user@example.com",
+			Filename:   "a.jpg",
+			FileURL:    "https://storage.example.com/a.jpg?X-Goog-Signature=secret",
+			Label:      "rust",
+			Confidence: 0.9,
+			Status:     domain.ImageStatusDetected,
+		},
+		At: 1,
+	})
+
+	delivery, ok := repo.deliveries["webhook-1-event-1"]
+	if !ok {
+		t.Fatalf("deliveries = %v, want one for the webhook", repo.deliveries)
+	}
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data["filename"] != "a.jpg" || payload.Data["status"] != string(domain.ImageStatusDetected) || payload.Data["label"] != "rust" {
+		t.Fatalf("data = %v, want the id, status and result", payload.Data)
+	}
+	for _, field := range []string{"fileURL", "email"} {
+		if _, ok := payload.Data[field]; ok {
+			t.Errorf("payload carries %v: %v", field, delivery.Payload)
+		}
+	}
+}
+
+func TestManagingAnotherUsersWebhookIsForbidden(t *testing.T) {
+	repo := newFakeRepository()
+	i := newTestService(repo)
+	repo.webhooks["webhook-1"] = domain.Webhook{ID: "webhook-1", Email: "owner@example.com"}
+	repo.webhooks["webhook-2"] = domain.Webhook{ID: "webhook-2", Email: "owner@example.com", Organization: "acme"}
+
+	caller := domain.Uploader{Email: "other@example.com", Organization: "other"}
+	for _, id := range []string{"webhook-1", "webhook-2"} {
+		if err := i.DeleteWebhook(caller, id); !errors.Is(err, domain.ErrWebhookForbidden) {
+			t.Errorf("DeleteWebhook(%v) = %v, want %v", id, err, domain.ErrWebhookForbidden)
+		}
+	}
+	if len(repo.webhooks) != 2 {
+		t.Fatalf("webhooks = %v, want both kept", repo.webhooks)
+	}
+}
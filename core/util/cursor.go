@@ -0,0 +1,83 @@
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"image-service/core/domain"
+	"strings"
+)
+
+func signCursor(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// EncodeCursor returns an opaque token of the form payload.signature so
+// clients cannot craft positions of their own.
+func EncodeCursor(key []byte, cursor domain.PageCursor) string {
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signCursor(key, payload))
+}
+
+// DecodeCursor verifies the token and that it was issued for the same sort
+// order as the current request.
+func DecodeCursor(key []byte, token string, sortBy domain.SortField, sortOrder domain.SortOrder) (*domain.PageCursor, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, domain.ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signCursor(key, payload)) {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var cursor domain.PageCursor
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err = decoder.Decode(&cursor); err != nil || cursor.Filename == "" {
+		return nil, domain.ErrInvalidCursor
+	}
+	if cursor.SortBy != sortBy || cursor.SortOrder != sortOrder {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	number, ok := cursor.Value.(json.Number)
+	if !ok {
+		return nil, domain.ErrInvalidCursor
+	}
+	if sortBy == domain.SortByConfidence {
+		cursor.Value, err = number.Float64()
+	} else {
+		cursor.Value, err = number.Int64()
+	}
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func CursorForImage(sortBy domain.SortField, sortOrder domain.SortOrder, img domain.Image) domain.PageCursor {
+	cursor := domain.PageCursor{
+		SortBy:    sortBy,
+		SortOrder: sortOrder,
+		Filename:  img.Filename,
+	}
+	switch sortBy {
+	case domain.SortByDetectedAt:
+		cursor.Value = img.DetectedAt
+	case domain.SortByConfidence:
+		cursor.Value = img.Confidence
+	default:
+		cursor.Value = img.CreatedAt
+	}
+	return cursor
+}
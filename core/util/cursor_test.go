@@ -0,0 +1,58 @@
+package util
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"net/http/httptest"
+	"testing"
+)
+
+var testCursorKey = []byte("test-cursor-key")
+
+func TestCursorRoundTrip(t *testing.T) {
+	img := domain.Image{Filename: "a.jpg", CreatedAt: 1700000000000, Confidence: 0.75}
+	for _, sortBy := range []domain.SortField{domain.SortByCreatedAt, domain.SortByConfidence} {
+		want := CursorForImage(sortBy, domain.SortDesc, img)
+		got, err := DecodeCursor(testCursorKey, EncodeCursor(testCursorKey, want), sortBy, domain.SortDesc)
+		if err != nil {
+			t.Fatalf("%v: %v", sortBy, err)
+		}
+		if *got != want {
+			t.Fatalf("%v: cursor = %#v, want %#v", sortBy, *got, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsForeignTokens(t *testing.T) {
+	token := EncodeCursor(testCursorKey, CursorForImage(domain.SortByCreatedAt, domain.SortDesc, domain.Image{Filename: "a.jpg", CreatedAt: 1}))
+	for name, tt := range map[string]struct {
+		key       []byte
+		token     string
+		sortOrder domain.SortOrder
+	}{
+		"other key":   {[]byte("other-key"), token, domain.SortDesc},
+		"other order": {testCursorKey, token, domain.SortAsc},
+		"tampered":    {testCursorKey, "e30" + token[3:], domain.SortDesc},
+		"malformed":   {testCursorKey, "not-a-cursor", domain.SortDesc},
+	} {
+		if _, err := DecodeCursor(tt.key, tt.token, domain.SortByCreatedAt, tt.sortOrder); !errors.Is(err, domain.ErrInvalidCursor) {
+			t.Errorf("%v: DecodeCursor = %v, want %v", name, err, domain.ErrInvalidCursor)
+		}
+	}
+}
+
+func TestPageFilterCursors(t *testing.T) {
+	filter, err := PageFilter(httptest.NewRequest("GET", "/v1/images?after=abc", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.After != "abc" || filter.PerPage != MinPageSize || filter.SortBy != domain.SortByCreatedAt || filter.SortOrder != domain.SortDesc {
+		t.Fatalf("filter = %+v", filter)
+	}
+
+	for _, query := range []string{"page=2", "after=abc&before=def"} {
+		if _, err = PageFilter(httptest.NewRequest("GET", "/v1/images?"+query, nil)); !errors.Is(err, domain.ErrInvalidFilter) {
+			t.Errorf("PageFilter(%v) = %v, want %v", query, err, domain.ErrInvalidFilter)
+		}
+	}
+}
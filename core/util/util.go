@@ -1,23 +1,46 @@
 package util
 
 import (
+	"fmt"
 	"image-service/core/domain"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	MinPageSize      = 20
-	DefaultFirstPage = 1
+	MinPageSize = 20
+	MaxPageSize = 100
+
+	DefaultStatsDays = 30
+	MaxStatsDays     = 366
 )
 
 func ToInt64Ptr(i int64) *int64 {
 	return &i
 }
 
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
 func ParseQueryParam(param string) string {
 	reg, err := regexp.Compile(`[!?;{}<>%'=]`)
 	if err != nil {
@@ -27,34 +50,232 @@ func ParseQueryParam(param string) string {
 	return res
 }
 
-func PageFilter(req *http.Request) domain.PageFilter {
-	page, _ := strconv.Atoi(ParseQueryParam(req.URL.Query().Get("page")))
-	perPage, _ := strconv.Atoi(ParseQueryParam(req.URL.Query().Get("perPage")))
-	startDate, _ := strconv.Atoi(req.URL.Query().Get("startDate"))
-	endDate, _ := strconv.Atoi(req.URL.Query().Get("endDate"))
-	after := req.URL.Query().Get("after")
+func invalidFilter(format string, args ...interface{}) error {
+	return domain.ErrInvalidFilter.Errorf("invalid filter: %v", fmt.Sprintf(format, args...))
+}
 
-	labels := make([]string, 0)
-	rawLabels := req.URL.Query().Get("labels")
-	if rawLabels != "" {
-		labels = strings.Split(rawLabels, ",")
+func parseIntParam(query url.Values, name string) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, invalidFilter("%v must be a non-negative integer", name)
 	}
-	var filterData = domain.PageFilter{}
+	return value, nil
+}
 
-	filterData.Page = page
-	filterData.PerPage = perPage
-	filterData.StartDate = startDate
-	filterData.EndDate = endDate
-	filterData.Labels = labels
-	filterData.After = after
+func parseConfidenceParam(query url.Values, name string) (*float64, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 || value > 1 {
+		return nil, invalidFilter("%v must be a number between 0 and 1", name)
+	}
+	return &value, nil
+}
+
+func parseBoolParam(query url.Values, name string) (bool, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, invalidFilter("%v must be true or false", name)
+	}
+	return value, nil
+}
+
+// parseStatusParam accepts a single status or "pending", which covers every
+// status that is still waiting for a result.
+func parseStatusParam(raw string) ([]domain.ImageStatus, error) {
+	switch {
+	case raw == "":
+		return nil, nil
+	case raw == "pending":
+		return domain.PendingImageStatuses, nil
+	case domain.ImageStatus(raw).IsValid():
+		return []domain.ImageStatus{domain.ImageStatus(raw)}, nil
+	}
+	return nil, invalidFilter("unknown status %q", raw)
+}
+
+// PageFilter parses and validates the list query. Firestore only allows range
+// filters on the field a query is sorted by, so date ranges need
+// sort=createdAt and confidence ranges need sort=confidence.
+func PageFilter(req *http.Request) (domain.PageFilter, error) {
+	query := req.URL.Query()
+	if query.Has("page") {
+		// offset pages were replaced by cursors, ignoring the parameter
+		// would silently return the first page again
+		return domain.PageFilter{}, invalidFilter("page is no longer supported, use the after and before cursors")
+	}
+	filterData := domain.PageFilter{
+		After:     query.Get("after"),
+		Before:    query.Get("before"),
+		SortBy:    domain.SortField(query.Get("sort")),
+		SortOrder: domain.SortOrder(query.Get("order")),
+		Labels:    make([]string, 0),
+	}
+	var err error
+
+	if filterData.PerPage, err = parseIntParam(query, "perPage"); err != nil {
+		return filterData, err
+	}
+	if filterData.StartDate, err = parseIntParam(query, "startDate"); err != nil {
+		return filterData, err
+	}
+	if filterData.EndDate, err = parseIntParam(query, "endDate"); err != nil {
+		return filterData, err
+	}
+	if filterData.MinConfidence, err = parseConfidenceParam(query, "minConfidence"); err != nil {
+		return filterData, err
+	}
+	if filterData.MaxConfidence, err = parseConfidenceParam(query, "maxConfidence"); err != nil {
+		return filterData, err
+	}
+	if filterData.Statuses, err = parseStatusParam(query.Get("status")); err != nil {
+		return filterData, err
+	}
+	if filterData.WithTotal, err = parseBoolParam(query, "withTotal"); err != nil {
+		return filterData, err
+	}
+	if filterData.WithLabelCounts, err = parseBoolParam(query, "withLabelCounts"); err != nil {
+		return filterData, err
+	}
+	filterData.ModelVersion = query.Get("modelVersion")
 
-	if perPage == 0 {
+	if filterData.IncludePending, err = parseBoolParam(query, "includePending"); err != nil {
+		return filterData, err
+	}
+
+	if rawLabels := query.Get("labels"); rawLabels != "" {
+		filterData.Labels = strings.Split(rawLabels, ",")
+	}
+
+	err = ValidatePageFilter(&filterData)
+	return filterData, err
+}
+
+// ValidatePageFilter fills in the defaults of filter and checks the
+// combinations Firestore can't query, for transports that don't parse the
+// filter from a query string.
+func ValidatePageFilter(filterData *domain.PageFilter) error {
+	if filterData.PerPage < 0 {
+		return invalidFilter("perPage must be a non-negative integer")
+	}
+	if filterData.PerPage == 0 {
 		filterData.PerPage = MinPageSize
 	}
+	if filterData.PerPage > MaxPageSize {
+		return invalidFilter("perPage must not be greater than %v", MaxPageSize)
+	}
+	if filterData.StartDate < 0 || filterData.EndDate < 0 {
+		return invalidFilter("startDate and endDate must be non-negative integers")
+	}
+	if filterData.EndDate != 0 && filterData.StartDate > filterData.EndDate {
+		return invalidFilter("startDate must not be after endDate")
+	}
+	for _, bound := range []*float64{filterData.MinConfidence, filterData.MaxConfidence} {
+		if bound != nil && (*bound < 0 || *bound > 1) {
+			return invalidFilter("minConfidence and maxConfidence must be numbers between 0 and 1")
+		}
+	}
+	if filterData.MinConfidence != nil && filterData.MaxConfidence != nil && *filterData.MinConfidence > *filterData.MaxConfidence {
+		return invalidFilter("minConfidence must not be greater than maxConfidence")
+	}
+	for _, status := range filterData.Statuses {
+		if !status.IsValid() {
+			return invalidFilter("unknown status %q", status)
+		}
+	}
+
+	labels := make([]string, 0, len(filterData.Labels))
+	seen := map[string]bool{}
+	for _, label := range filterData.Labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return invalidFilter("labels must not contain empty values")
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		labels = append(labels, label)
+	}
+	filterData.Labels = labels
+
+	switch filterData.SortBy {
+	case "":
+		filterData.SortBy = domain.SortByCreatedAt
+	case domain.SortByCreatedAt, domain.SortByDetectedAt, domain.SortByConfidence:
+	default:
+		return invalidFilter("sort must be one of createdAt, detectedAt or confidence")
+	}
+	switch filterData.SortOrder {
+	case "":
+		filterData.SortOrder = domain.SortDesc
+	case domain.SortAsc, domain.SortDesc:
+	default:
+		return invalidFilter("order must be asc or desc")
+	}
+
+	if (filterData.StartDate != 0 || filterData.EndDate != 0) && filterData.SortBy != domain.SortByCreatedAt {
+		return invalidFilter("startDate and endDate require sort=createdAt")
+	}
+	if (filterData.MinConfidence != nil || filterData.MaxConfidence != nil) && filterData.SortBy != domain.SortByConfidence {
+		return invalidFilter("minConfidence and maxConfidence require sort=confidence")
+	}
+	if len(filterData.Labels) > 0 && len(filterData.Statuses) > 1 {
+		return invalidFilter("labels cannot be combined with status=pending")
+	}
+	if filterData.IncludePending && (len(filterData.Labels) == 0 || len(filterData.Statuses) > 0) {
+		return invalidFilter("includePending requires labels and cannot be combined with status")
+	}
+	if filterData.After != "" && filterData.Before != "" {
+		return invalidFilter("after and before cannot be used together")
+	}
+
+	return nil
+}
 
-	if page == 0 {
-		filterData.Page = DefaultFirstPage
+// StatsFilter parses the stats query, days defaults to 30 and bucket to day.
+func StatsFilter(req *http.Request) (domain.StatsFilter, error) {
+	query := req.URL.Query()
+	filterData := domain.StatsFilter{
+		Days:     DefaultStatsDays,
+		Bucket:   domain.StatsBucketSize(query.Get("bucket")),
+		TimeZone: query.Get("tz"),
 	}
 
-	return filterData
+	days, err := parseIntParam(query, "days")
+	if err != nil {
+		return filterData, err
+	}
+	if days > MaxStatsDays {
+		return filterData, invalidFilter("days must not be greater than %v", MaxStatsDays)
+	}
+	if days > 0 {
+		filterData.Days = days
+	}
+
+	switch filterData.Bucket {
+	case "":
+		filterData.Bucket = domain.StatsBucketDay
+	case domain.StatsBucketDay, domain.StatsBucketWeek, domain.StatsBucketMonth:
+	default:
+		return filterData, invalidFilter("bucket must be one of day, week or month")
+	}
+
+	if filterData.TimeZone == "" {
+		filterData.TimeZone = "UTC"
+	}
+	if _, err = time.LoadLocation(filterData.TimeZone); err != nil {
+		return filterData, invalidFilter("unknown time zone %q", filterData.TimeZone)
+	}
+	return filterData, nil
 }
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"errors"
+	"image-service/core/domain"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPageFilter(t *testing.T) {
+	filter, err := PageFilter(httptest.NewRequest("GET", "/v1/images?perPage=50&sort=confidence&order=asc&minConfidence=0.5&maxConfidence=0.9&status=detected&labels=leaf,+rust,leaf&modelVersion=v2", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.PerPage != 50 || filter.SortBy != domain.SortByConfidence || filter.SortOrder != domain.SortAsc || filter.ModelVersion != "v2" {
+		t.Fatalf("filter = %+v", filter)
+	}
+	if *filter.MinConfidence != 0.5 || *filter.MaxConfidence != 0.9 {
+		t.Fatalf("confidence = %v..%v", *filter.MinConfidence, *filter.MaxConfidence)
+	}
+	if len(filter.Statuses) != 1 || filter.Statuses[0] != domain.ImageStatusDetected {
+		t.Fatalf("statuses = %v", filter.Statuses)
+	}
+	if len(filter.Labels) != 2 || filter.Labels[0] != "leaf" || filter.Labels[1] != "rust" {
+		t.Fatalf("labels = %q", filter.Labels)
+	}
+
+	filter, err = PageFilter(httptest.NewRequest("GET", "/v1/images?status=pending", nil))
+	if err != nil || len(filter.Statuses) != len(domain.PendingImageStatuses) {
+		t.Fatalf("status=pending = %v, %v", filter.Statuses, err)
+	}
+}
+
+func TestPageFilterRejectsInvalidQueries(t *testing.T) {
+	for _, query := range []string{
+		"perPage=-1",
+		"perPage=101",
+		"perPage=ten",
+		"startDate=20&endDate=10",
+		"startDate=10&sort=confidence",
+		"minConfidence=1.5&sort=confidence",
+		"minConfidence=0.9&maxConfidence=0.1&sort=confidence",
+		"minConfidence=0.5",
+		"status=unknown",
+		"labels=leaf,,rust",
+		"labels=leaf&status=pending",
+		"includePending=true",
+		"includePending=true&labels=leaf&status=detected",
+		"sort=filename",
+		"order=up",
+		"withTotal=maybe",
+	} {
+		if _, err := PageFilter(httptest.NewRequest("GET", "/v1/images?"+query, nil)); !errors.Is(err, domain.ErrInvalidFilter) {
+			t.Errorf("PageFilter(%v) = %v, want %v", query, err, domain.ErrInvalidFilter)
+		}
+	}
+}
+
+func TestStatsFilter(t *testing.T) {
+	filter, err := StatsFilter(httptest.NewRequest("GET", "/v1/images/stats", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Days != DefaultStatsDays || filter.Bucket != domain.StatsBucketDay || filter.TimeZone != "UTC" {
+		t.Fatalf("filter = %+v", filter)
+	}
+
+	for _, query := range []string{"days=1000", "bucket=year", "tz=Mars/Olympus"} {
+		if _, err = StatsFilter(httptest.NewRequest("GET", "/v1/images/stats?"+query, nil)); !errors.Is(err, domain.ErrInvalidFilter) {
+			t.Errorf("StatsFilter(%v) = %v, want %v", query, err, domain.ErrInvalidFilter)
+		}
+	}
+}
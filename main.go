@@ -2,28 +2,116 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"image-service/adapter/broker"
 	"image-service/adapter/handler"
+	"image-service/adapter/notifier"
 	"image-service/adapter/repository"
+	"image-service/adapter/rpc"
+	"image-service/core/domain"
+	"image-service/core/port"
 	"image-service/core/service"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
+func reconcileBlobs(imageService *service.ImageService, args []string) {
+	flags := flag.NewFlagSet("reconcile-blobs", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", true, "only report orphaned blobs and missing blobs")
+	grace := flags.Duration("grace", 24*time.Hour, "minimum age of a blob before it is considered orphaned")
+	_ = flags.Parse(args)
+
+	report, err := imageService.ReconcileBlobs(domain.ReconcileOptions{
+		GracePeriod: *grace,
+		DryRun:      *dryRun,
+	})
+	if err != nil {
+		log.Fatalf("error reconcile blobs with error %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+}
+
+func backfillStatus(imageService *service.ImageService, args []string) {
+	flags := flag.NewFlagSet("backfill-status", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", true, "only count images without a status")
+	_ = flags.Parse(args)
+
+	report, err := imageService.BackfillImageStatuses(*dryRun)
+	if err != nil {
+		log.Fatalf("error backfill image status with error %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+}
+
 func main() {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	store, err := repository.NewImageRepository(ctx)
 	if err != nil {
 		log.Fatalf("error initialize NewImageRepository with error %v", err)
 	}
-	imageService, err := service.NewImageService(store)
+	var eventBroker port.EventBroker = broker.NewMemoryBroker()
+	if os.Getenv("EVENT_BROKER") == "pubsub" {
+		eventBroker, err = broker.NewPubsubBroker(ctx, "detection-events")
+		if err != nil {
+			log.Fatalf("error initialize NewPubsubBroker with error %v", err)
+		}
+	}
+	var pushNotifier port.Notifier = notifier.NewNoopNotifier()
+	if os.Getenv("PUSH_NOTIFIER") == "fcm" {
+		pushNotifier, err = notifier.NewFCMNotifier(ctx, os.Getenv("FCM_ENDPOINT"), os.Getenv("FCM_PROJECT_ID"), os.Getenv("FCM_CREDENTIALS_FILE"))
+		if err != nil {
+			log.Fatalf("error initialize NewFCMNotifier with error %v", err)
+		}
+	}
+	imageService, err := service.NewImageService(store, eventBroker, pushNotifier)
 	if err != nil {
 		log.Fatalf("error initialize NewImageService with error %v", err)
 	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-blobs" {
+		reconcileBlobs(imageService, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backfill-status" {
+		backfillStatus(imageService, os.Args[2:])
+		return
+	}
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	go handler.InitHttpServer(*imageService)
+	var servers sync.WaitGroup
+	servers.Add(2)
+	go func() {
+		defer servers.Done()
+		handler.InitHttpServer(ctx, imageService)
+	}()
+	go func() {
+		defer servers.Done()
+		rpc.InitGrpcServer(ctx, imageService)
+	}()
+	go imageService.StartReaper(ctx)
+	go imageService.StartOutboxRelay(ctx)
+	go imageService.StartTrashPurger(ctx)
+	go imageService.StartErasureWorker(ctx)
+	go imageService.StartExportWorker(ctx)
+	go imageService.StartRetentionSweeper(ctx)
+	go imageService.StartEventHub(ctx)
+	go imageService.StartWebhookDispatcher(ctx)
+	go imageService.StartIdempotencyCleanup(ctx)
 	<-done
+
+	// stop the workers and let both servers finish their open calls
+	cancel()
+	servers.Wait()
 }